@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/randomizedcoder/goIGMP"
+)
+
+// loadConfig decodes the TOML config file over conf, so the keys in the file override the flags
+//
+// The keys are the goIGMP.Config field names, e.g. QueryTime = "30s" and [Testing], and the
+// modes are their names, e.g. Mode = "link".  Unknown keys are an error, to catch typos.
+func loadConfig(path string, conf *goIGMP.Config) error {
+
+	md, err := toml.DecodeFile(path, conf)
+	if err != nil {
+		return err
+	}
+
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, 0, len(undecoded))
+		for _, k := range undecoded {
+			keys = append(keys, k.String())
+		}
+		return fmt.Errorf("%s unknown keys: %s", path, strings.Join(keys, ", "))
+	}
+
+	return nil
+}
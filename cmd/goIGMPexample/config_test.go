@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/randomizedcoder/goIGMP"
+)
+
+func TestLoadConfig(t *testing.T) {
+
+	// the file overrides the flags, and keeps what it doesn't set
+	conf := &goIGMP.Config{ChannelSize: channelSizeCst, ProxyInToOut: true}
+	if err := loadConfig("goIGMPexample.toml", conf); err != nil {
+		t.Fatal(err)
+	}
+
+	if conf.InIntName != "lo" || conf.ChannelSize != channelSizeCst || conf.SocketReadDeadLine != 10*time.Second {
+		t.Errorf("conf:%v", conf)
+	}
+	if conf.UnicastQueries != goIGMP.UnicastQueryAnswer || conf.SSM.Mode != goIGMP.SSMReject ||
+		conf.MembershipReportsPolicy.Policy != goIGMP.Coalesce || conf.Policy.Rules[0].Action != goIGMP.PolicyDeny {
+		t.Errorf("modes:%v", conf)
+	}
+	if len(conf.StaticJoins) != 1 || conf.StaticJoins[0].Sources[0] != netip.MustParseAddr("10.1.1.1") {
+		t.Errorf("StaticJoins:%v", conf.StaticJoins)
+	}
+
+	// ProxyInToOut from the flags, and UnicastProxyInToOut from the file
+	if err := conf.Validate(); err == nil || !strings.Contains(err.Error(), "UnicastProxyInToOut") {
+		t.Errorf("Validate err:%v", err)
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.toml")
+	if err := os.WriteFile(bad, []byte("InIntName = \"lo\"\n[SSM]\nMode = \"mapped\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfig(bad, &goIGMP.Config{}); err == nil || !strings.Contains(err.Error(), "mapped") {
+		t.Errorf("bad mode err:%v", err)
+	}
+	if err := os.WriteFile(bad, []byte("InsideName = \"lo\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfig(bad, &goIGMP.Config{}); err == nil || !strings.Contains(err.Error(), "InsideName") {
+		t.Errorf("unknown key err:%v", err)
+	}
+}
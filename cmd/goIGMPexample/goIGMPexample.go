@@ -1,13 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -15,7 +20,10 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/randomizedcoder/goIGMP"
+	"github.com/randomizedcoder/goIGMP/igmpcontrol"
 	"github.com/vishvananda/netlink"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 const (
@@ -70,8 +78,15 @@ func main() {
 
 	go initSignalHandler(cancel)
 
+	if len(os.Args) > 1 && os.Args[1] == replayCmdCst {
+		os.Exit(replayMain(ctx, os.Args[2:]))
+	}
+
 	version := flag.Bool("version", false, "version")
 
+	configFile := flag.String("config", "", "TOML config file, with the goIGMP.Config field names as the keys. The keys in the file override the flags")
+	checkConfig := flag.Bool("check-config", false, "validate the flags and -config, print the config, and exit")
+
 	// https://pkg.go.dev/net#Listen
 	promListen := flag.String("promListen", promListenCst, "Prometheus http listening socket")
 	promPath := flag.String("promPath", promPathCst, "Prometheus http path")
@@ -82,6 +97,14 @@ func main() {
 	outName := flag.String("outName", outNameCst, "outside interface to listen & send on")
 	altName := flag.String("altName", altNameCst, "alternative outside interface to listen & send on. leave blank for none")
 
+	outSelection := flag.String("outSelection", goIGMP.OutSelectManual.String(), "outside interface selection with -altName: manual, link or querier")
+	preferred := flag.String("preferred", "", "preferred outside interface for -outSelection link. Defaults to -outName")
+	holdDown := flag.Duration("holdDown", 0, "-outSelection link, how long the active interface must be down before failing over. 0 for the default")
+	holdUp := flag.Duration("holdUp", 0, "-outSelection link, how long the preferred interface must be up before failing back. 0 for the default")
+	leaveOnSwitch := flag.Bool("leaveOnSwitch", false, "send leaves on the old outside interface, when the outside interface changes")
+	disableReannounce := flag.Bool("disableReannounce", false, "do not send membership reports on the new outside interface, when the outside interface changes")
+	queryWindow := flag.Duration("queryWindow", 0, "-outSelection querier, how long without a query on the active interface before switching. 0 for the default")
+
 	unicastDst := flag.String("unicastDst", unicastDstCst, "Fallback unicast destination for the unicast membership reports")
 
 	proxyOutIn := flag.Bool("proxyOutIn", false, "Proxy IGMP from the outside to the inside")
@@ -97,12 +120,42 @@ func main() {
 	membershipReportsToNetwork := flag.Bool("membershipReportsToNetwork", false, "Read from MembershipReportToNetworkCh and send IGMP membership reports")
 	//membershipReportsToNetwork := flag.Bool("membershipReportsToNetwork", MembershipReportsToNetworkCst, "Read from MembershipReportToNetworkCh and send IGMP membership reports")
 	unicastMembershipReports := flag.Bool("unicastMembershipReports", false, "Send IGMP membership reports as unicast")
+	unicastAllow := flag.String("unicastAllow", "", "comma separated client source prefixes allowed to send unicast IGMP or UDP encapsulated memberships. Leave blank for any")
+	unicastQueries := flag.String("unicastQueries", goIGMP.UnicastQueryIgnore.String(), "unicast queries from the inside: ignore, multicast to send them on the inside, or answer")
 	//unicastMembershipReports := flag.Bool("unicastMembershipReports", UnicastMembershipReportsCst, "Send IGMP membership reports as unicast")
 	connectQueryToReport := flag.Bool("connectQueryToReport", false, "Testing Option. Connect the query notify channel to the membership report channel.  This is for testing only.")
 	//connectQueryToReport := flag.Bool("connectQueryToReport", ConnectQueryToReportCst, "Connect the query notify channel to the membership report channel.  This is for testing only.")
 	membershipReportsReader := flag.Bool("membershipReportsReader", false, "Testing Option. Start a goroutine to read the membership report channel to stop is getting full and blocking.")
 	leaveToNetwork := flag.Bool("leaveToNetwork", false, "LeaveToNetwork channel and sender")
 
+	maxGroupsPerInterface := flag.Int("maxGroupsPerInterface", 0, "maximum groups learned on the inside interface. 0 for unlimited")
+	maxGroupsPerHost := flag.Int("maxGroupsPerHost", 0, "maximum groups per inside host. 0 for unlimited")
+	maxSourcesPerGroup := flag.Int("maxSourcesPerGroup", 0, "maximum sources per group. 0 for unlimited")
+
+	rateInterface := flag.Float64("rateInterface", 0, "IGMP messages per second, per output interface. 0 for unlimited")
+	rateHost := flag.Float64("rateHost", 0, "proxied IGMP messages per second, per source host. 0 for unlimited")
+
+	forwarding := flag.String("forwarding", goIGMP.ForwardingOff.String(), "multicast data forwarding: off, kernel to program the linux multicast routing table, or smcroute to drive smcrouted")
+	strictHeaders := flag.String("strictHeaders", "", "comma separated interface names to apply the strict RFC 3376 header checks: TTL 1, router alert for IGMPv3, checksum and local subnet reports")
+	outDSCP := flag.Int("outDSCP", 0, "DSCP of the IGMP sent on the outside interfaces. 0 for the default CS6, -1 for best effort")
+	outNoRouterAlert := flag.Bool("outNoRouterAlert", false, "omit the router alert option from the IGMP sent on the outside interfaces")
+	outSrc := flag.String("outSrc", "", "source address of the IGMP sent on -outName. Leave blank for the kernel to choose")
+	altSrc := flag.String("altSrc", "", "source address of the IGMP sent on -altName. Leave blank for the kernel to choose")
+	mld := flag.Bool("mld", false, "also run MLD for IPv6 on the same interfaces")
+	groupMetrics := flag.Bool("groupMetrics", false, "per-group prometheus metrics of the members, reports, leaves and last report age")
+	groupMetricsGroups := flag.String("groupMetricsGroups", "", "comma separated group prefixes for -groupMetrics. Leave blank for any group")
+	groupMetricsMax := flag.Int("groupMetricsMax", 0, "maximum groups per interface for -groupMetrics. 0 for the default 1000")
+	smcrouteSocket := flag.String("smcrouteSocket", "/run/smcroute.sock", "smcrouted IPC socket, for -forwarding smcroute")
+	udpEncapListen := flag.String("udpEncapListen", "", "proxy, listen for UDP encapsulated memberships on host:port. An empty host is the inside interface address")
+	udpEncapDst := flag.String("udpEncapDst", "", "client, send the membership reports and leaves to the proxy host:port as UDP, instead of IGMP")
+	udpEncapKeyFile := flag.String("udpEncapKeyFile", "", "file holding the shared HMAC key for -udpEncapListen and -udpEncapDst. Leave blank for no authentication")
+	httpAdminPath := flag.String("httpAdminPath", "", "serve the JSON status and admin API under this path on -promListen, e.g. /igmp/. Leave blank to disable")
+	httpAdminTokenFile := flag.String("httpAdminTokenFile", "", "file with the bearer token for the admin API POSTs. Without it, only /status is served")
+	grpcListen := flag.String("grpcListen", "", "serve the igmpcontrol gRPC service on host:port. Leave blank to disable")
+	grpcCert := flag.String("grpcCert", "", "TLS certificate file for -grpcListen. Without it, the service is plaintext")
+	grpcKey := flag.String("grpcKey", "", "TLS key file for -grpcCert")
+	udpEncapMaxSkew := flag.Duration("udpEncapMaxSkew", 0, "with -udpEncapKeyFile, the allowed clock difference between client and proxy. 0 for the default")
+
 	channelSize := flag.Int("channelSize", channelSizeCst, "channel size")
 
 	readDeadline := flag.Duration("readDeadline", readDeadlineCst, "readDeadline sets the socket read deadline.  This impacts how quickly an IGMPReporter will detect context.Cancel and shutdown")
@@ -113,7 +166,10 @@ func main() {
 
 	mloopback := flag.Bool("mloopback", loopbackCst, "Enable loopback on the multicast send sockets")
 
-	dl := flag.Int("dl", debugLevelCst, "nasty debugLevel")
+	dl := flag.Int("dl", debugLevelCst, "nasty debugLevel.  Ignored when -logLevel or -logJSON are set")
+
+	logLevel := flag.String("logLevel", "", "slog level: DEBUG-4 (trace), DEBUG, INFO, WARN, ERROR")
+	logJSON := flag.Bool("logJSON", false, "log as JSON")
 
 	flag.Parse()
 
@@ -122,8 +178,6 @@ func main() {
 		os.Exit(0)
 	}
 
-	go initPromHandler(*promPath, *promListen)
-
 	testing := &goIGMP.TestingOptions{
 		MulticastLoopback:       *mloopback,
 		ConnectQueryToReport:    *connectQueryToReport,
@@ -138,6 +192,79 @@ func main() {
 		outName = &di
 	}
 
+	var mode goIGMP.OutSelectionMode
+	if err := mode.UnmarshalText([]byte(*outSelection)); err != nil {
+		log.Fatal("-outSelection err:", err)
+	}
+
+	var uqMode goIGMP.UnicastQueryMode
+	if err := uqMode.UnmarshalText([]byte(*unicastQueries)); err != nil {
+		log.Fatal("-unicastQueries err:", err)
+	}
+
+	var allow []netip.Prefix
+	for _, a := range strings.Split(*unicastAllow, ",") {
+		if a = strings.TrimSpace(a); a == "" {
+			continue
+		}
+		p, err := netip.ParsePrefix(a)
+		if err != nil {
+			log.Fatal("-unicastAllow err:", err)
+		}
+		allow = append(allow, p)
+	}
+
+	var metricsGroups []netip.Prefix
+	for _, a := range strings.Split(*groupMetricsGroups, ",") {
+		if a = strings.TrimSpace(a); a == "" {
+			continue
+		}
+		p, err := netip.ParsePrefix(a)
+		if err != nil {
+			log.Fatal("-groupMetricsGroups err:", err)
+		}
+		metricsGroups = append(metricsGroups, p)
+	}
+
+	headerValidation := make(map[string]goIGMP.HeaderValidation)
+	for _, n := range strings.Split(*strictHeaders, ",") {
+		if n = strings.TrimSpace(n); n != "" {
+			headerValidation[n] = goIGMP.StrictHeaderValidation
+		}
+	}
+
+	ipHeaders := make(map[string]goIGMP.IPHeader)
+	for name, src := range map[string]string{*outName: *outSrc, *altName: *altSrc} {
+		if name == "" {
+			continue
+		}
+		h := goIGMP.IPHeader{DSCP: *outDSCP, NoRouterAlert: *outNoRouterAlert}
+		if src != "" {
+			a, err := netip.ParseAddr(src)
+			if err != nil {
+				log.Fatal("-outSrc/-altSrc err:", err)
+			}
+			h.Src = a
+		}
+		if h != (goIGMP.IPHeader{}) {
+			ipHeaders[name] = h
+		}
+	}
+
+	var fwdMode goIGMP.ForwardingMode
+	if err := fwdMode.UnmarshalText([]byte(*forwarding)); err != nil {
+		log.Fatal("-forwarding err:", err)
+	}
+
+	var udpEncapKey []byte
+	if *udpEncapKeyFile != "" {
+		k, err := os.ReadFile(*udpEncapKeyFile)
+		if err != nil {
+			log.Fatal("-udpEncapKeyFile err:", err)
+		}
+		udpEncapKey = bytes.TrimSpace(k)
+	}
+
 	conf := &goIGMP.Config{
 		InIntName:                    *inName,
 		OutIntName:                   *outName,
@@ -150,19 +277,101 @@ func main() {
 		MembershipReportsFromNetwork: *membershipReportsFromNetwork,
 		MembershipReportsToNetwork:   *membershipReportsToNetwork,
 		UnicastMembershipReports:     *unicastMembershipReports,
+		UnicastQueries:               uqMode,
+		UnicastClients:               goIGMP.UnicastClients{Allow: allow},
+		HeaderValidation:             headerValidation,
+		IPHeaders:                    ipHeaders,
+		GroupMetrics:                 goIGMP.GroupMetrics{Enabled: *groupMetrics, Groups: metricsGroups, MaxGroups: *groupMetricsMax},
 		LeaveToNetwork:               *leaveToNetwork,
 		SocketReadDeadLine:           *readDeadline,
 		ChannelSize:                  *channelSize,
 		Gratuitous:                   *gratuitous,
 		QueryTime:                    *selfQuery,
 		DebugLevel:                   *dl,
-		Testing:                      *testing,
+		OutSelection: goIGMP.OutSelection{
+			Mode:              mode,
+			Preferred:         *preferred,
+			HoldDown:          *holdDown,
+			HoldUp:            *holdUp,
+			QueryWindow:       *queryWindow,
+			LeaveOnSwitch:     *leaveOnSwitch,
+			DisableReannounce: *disableReannounce,
+		},
+		Limits: goIGMP.Limits{
+			MaxGroupsPerInterface: *maxGroupsPerInterface,
+			MaxGroupsPerHost:      *maxGroupsPerHost,
+			MaxSourcesPerGroup:    *maxSourcesPerGroup,
+		},
+		RateLimits: goIGMP.RateLimits{
+			PerInterface: goIGMP.RateLimit{Rate: *rateInterface},
+			PerHost:      goIGMP.RateLimit{Rate: *rateHost},
+		},
+		Forwarding: goIGMP.Forwarding{
+			Mode:           fwdMode,
+			SMCRouteSocket: *smcrouteSocket,
+		},
+		MLD: *mld,
+		UDPEncap: goIGMP.UDPEncap{
+			Listen:  *udpEncapListen,
+			Dst:     *udpEncapDst,
+			Key:     udpEncapKey,
+			MaxSkew: *udpEncapMaxSkew,
+		},
+		Testing: *testing,
+	}
+
+	if *configFile != "" {
+		if err := loadConfig(*configFile, conf); err != nil {
+			log.Fatal("-config err:", err)
+		}
+	}
+
+	// report all the config problems before any sockets are opened
+	if err := conf.Validate(); err != nil {
+		if *checkConfig {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		log.Fatal("config err:\n", err)
+	}
+
+	if *checkConfig {
+		fmt.Println(conf)
+		fmt.Println("config ok")
+		os.Exit(0)
+	}
+
+	go initPromHandler(*promPath, *promListen)
+
+	if *logLevel != "" || *logJSON {
+		logger, err := newLogger(*logLevel, *logJSON)
+		if err != nil {
+			log.Fatal("newLogger err:", err)
+		}
+		conf.Logger = logger
 	}
 
 	r := goIGMP.NewIGMPReporter(*conf)
 
 	log.Println("goIGMPExample.go r created")
 
+	if *grpcListen != "" {
+		initGRPCServer(ctx, r, *grpcListen, *grpcCert, *grpcKey)
+	}
+
+	if *httpAdminPath != "" {
+		var token []byte
+		if *httpAdminTokenFile != "" {
+			t, err := os.ReadFile(*httpAdminTokenFile)
+			if err != nil {
+				log.Fatal("-httpAdminTokenFile err:", err)
+			}
+			token = bytes.TrimSpace(t)
+		}
+		prefix := strings.TrimSuffix(*httpAdminPath, "/")
+		http.Handle(prefix+"/", http.StripPrefix(prefix, r.HTTPHandler(goIGMP.HTTPAdmin{Token: string(token)})))
+	}
+
 	w := new(sync.WaitGroup)
 
 	w.Add(1)
@@ -174,6 +383,22 @@ func main() {
 	log.Println("goIGMPExample.go all done bye")
 }
 
+// newLogger builds the slog.Logger passed to the IGMPReporter
+// The default level is INFO, and goIGMP.LevelTrace is "DEBUG-4"
+func newLogger(level string, json bool) (*slog.Logger, error) {
+	var l slog.Level
+	if level != "" {
+		if err := l.UnmarshalText([]byte(level)); err != nil {
+			return nil, err
+		}
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	if json {
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts)), nil
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, opts)), nil
+}
+
 // initSignalHandler sets up signal handling for the process, and
 // will call cancel() when recieved
 func initSignalHandler(cancel context.CancelFunc) {
@@ -210,6 +435,38 @@ func initPromHandler(promPath string, promListen string) {
 	}()
 }
 
+// initGRPCServer starts the igmpcontrol service, and stops it when ctx is done
+func initGRPCServer(ctx context.Context, r *goIGMP.IGMPReporter, listen string, cert string, key string) {
+
+	var opts []grpc.ServerOption
+	if cert != "" {
+		creds, err := credentials.NewServerTLSFromFile(cert, key)
+		if err != nil {
+			log.Fatal("-grpcCert err:", err)
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+
+	l, err := net.Listen("tcp", listen)
+	if err != nil {
+		log.Fatal("-grpcListen err:", err)
+	}
+
+	s := grpc.NewServer(opts...)
+	igmpcontrol.RegisterControlServer(s, igmpcontrol.NewServer(r))
+
+	go func() {
+		<-ctx.Done()
+		s.GracefulStop()
+	}()
+
+	go func() {
+		if err := s.Serve(l); err != nil {
+			log.Fatal("grpc error", err)
+		}
+	}()
+}
+
 // getDefaultRouteInterface find the default route interface name
 func getDefaultRouteInterface() (string, error) {
 
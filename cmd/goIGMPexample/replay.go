@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/randomizedcoder/goIGMP"
+)
+
+const (
+	replayCmdCst = "replay"
+
+	replayIntNameCst     = "lo"
+	replayChannelSizeCst = 1000
+)
+
+// replayMain is the "replay" subcommand, which reads a pcap and feeds the IGMP packets
+// through the IGMPReporter receive pipeline, printing what the reporter emits
+//
+//	./goIGMPexample replay -pcap ../../pcaps/igmpv2_leaves_2024_03_11.pcap
+func replayMain(ctx context.Context, args []string) int {
+
+	fs := flag.NewFlagSet(replayCmdCst, flag.ExitOnError)
+
+	pcap := fs.String("pcap", "", "pcap file to replay")
+	inName := fs.String("inName", replayIntNameCst, "inside interface. Only used to build the reporter, no sockets are opened")
+	outName := fs.String("outName", replayIntNameCst, "outside interface. Only used to build the reporter, no sockets are opened")
+	channelSize := fs.Int("channelSize", replayChannelSizeCst, "channel size")
+	dl := fs.Int("dl", 0, "nasty debugLevel")
+
+	if err := fs.Parse(args); err != nil {
+		log.Println("replay Parse err:", err)
+		return 1
+	}
+
+	if *pcap == "" {
+		fmt.Fprintln(os.Stderr, "replay requires -pcap")
+		fs.Usage()
+		return 1
+	}
+
+	r := goIGMP.NewIGMPReporter(goIGMP.Config{
+		InIntName:                    *inName,
+		OutIntName:                   *outName,
+		UnicastDst:                   unicastDstCst,
+		QueryNotify:                  true,
+		MembershipReportsFromNetwork: true,
+		ChannelSize:                  *channelSize,
+		DebugLevel:                   *dl,
+		Testing: goIGMP.TestingOptions{
+			ReplayOnly: true,
+		},
+	})
+
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go replayPrinter(&wg, done, r)
+
+	replayed, err := r.ReplayPcap(ctx, *pcap)
+
+	close(done)
+	wg.Wait()
+
+	if err != nil {
+		log.Println("replay ReplayPcap err:", err)
+		return 1
+	}
+
+	fmt.Printf("replayed:%d packets from:%s\n", replayed, *pcap)
+
+	return 0
+}
+
+// replayPrinter prints what the reporter sends on the notification channels.
+// When done is closed, whatever is still buffered in the channels is printed before returning.
+func replayPrinter(wg *sync.WaitGroup, done <-chan struct{}, r *goIGMP.IGMPReporter) {
+
+	defer wg.Done()
+
+	for {
+		select {
+		case <-r.QueryNotifyCh:
+			fmt.Println("query")
+		case mitems := <-r.MembershipReportFromNetworkCh:
+			fmt.Printf("membership report:%v\n", mitems)
+		case <-done:
+			for {
+				select {
+				case <-r.QueryNotifyCh:
+					fmt.Println("query")
+				case mitems := <-r.MembershipReportFromNetworkCh:
+					fmt.Printf("membership report:%v\n", mitems)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
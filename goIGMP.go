@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net"
 	"net/netip"
 	"sync"
@@ -13,6 +14,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
 )
 
 const (
@@ -89,12 +91,30 @@ type Config struct {
 	MembershipReportsFromNetwork bool
 	MembershipReportsToNetwork   bool
 	UnicastMembershipReports     bool
+	UnicastQueries               UnicastQueryMode            // unicast queries received by UnicastProxyInToOut
+	UnicastClients               UnicastClients              // UnicastProxyInToOut and UDPEncap.Listen
+	HeaderValidation             map[string]HeaderValidation // by interface name
+	IPHeaders                    map[string]IPHeader         // by interface name
+	GroupMetrics                 GroupMetrics
 	LeaveToNetwork               bool
 	SocketReadDeadLine           time.Duration
 	ChannelSize                  int
+	QueryNotifyPolicy            ChannelPolicy
+	MembershipReportsPolicy      ChannelPolicy // MembershipReportFromNetworkCh
+	OutSelection                 OutSelection
+	Policy                       Policy
+	SSM                          SSM
+	Limits                       Limits
+	RateLimits                   RateLimits
+	StaticJoins                  []StaticJoin
+	Forwarding                   Forwarding
+	MLD                          bool // also run MLD for IPv6 on the same interfaces
+	UDPEncap                     UDPEncap
 	Gratuitous                   time.Duration
 	QueryTime                    time.Duration
-	DebugLevel                   int
+	DebugLevel                   int // Deprecated: use Logger.  Only used to set the level when Logger is nil
+	Logger                       *slog.Logger
+	Observers                    []Observer
 	Testing                      TestingOptions
 }
 
@@ -102,6 +122,7 @@ type TestingOptions struct {
 	MulticastLoopback       bool
 	ConnectQueryToReport    bool
 	MembershipReportsReader bool
+	ReplayOnly              bool
 }
 
 func (c Config) String() string {
@@ -117,12 +138,36 @@ func (c Config) String() string {
 		fmt.Sprintf("MembershipReportsFromNetwork:%t, ", c.MembershipReportsFromNetwork) + "\n" +
 		fmt.Sprintf("MembershipReportsToNetwork:%t, ", c.MembershipReportsToNetwork) + "\n" +
 		fmt.Sprintf("UnicastMembershipReports:%t, ", c.UnicastMembershipReports) + "\n" +
+		fmt.Sprintf("UnicastQueries:%s, ", c.UnicastQueries) + "\n" +
+		fmt.Sprintf("UnicastClients.Allow:%s, ", c.UnicastClients.Allow) + "\n" +
+		fmt.Sprintf("UnicastClients.Clients:%d, ", len(c.UnicastClients.Clients)) + "\n" +
 		fmt.Sprintf("Testing.MulticastLoopback:%t, ", c.Testing.MulticastLoopback) + "\n" +
 		fmt.Sprintf("Testing.ConnectQueryToReport:%t, ", c.Testing.ConnectQueryToReport) + "\n" +
 		fmt.Sprintf("Testing.MembershipReportsReader:%t, ", c.Testing.MembershipReportsReader) + "\n" +
+		fmt.Sprintf("Testing.ReplayOnly:%t, ", c.Testing.ReplayOnly) + "\n" +
+		fmt.Sprintf("Observers:%d, ", len(c.Observers)) + "\n" +
+		fmt.Sprintf("OutSelection.Mode:%s, ", c.OutSelection.Mode) + "\n" +
+		fmt.Sprintf("HeaderValidation:%v, ", c.HeaderValidation) + "\n" +
+		fmt.Sprintf("IPHeaders:%v, ", c.IPHeaders) + "\n" +
+		fmt.Sprintf("GroupMetrics:%+v, ", c.GroupMetrics) + "\n" +
+		fmt.Sprintf("Policy.Rules:%d, ", len(c.Policy.Rules)) + "\n" +
+		fmt.Sprintf("Policy.Default:%s, ", c.Policy.Default) + "\n" +
+		fmt.Sprintf("SSM.Mode:%s, ", c.SSM.Mode) + "\n" +
+		fmt.Sprintf("SSM.ASMSources:%s, ", c.SSM.ASMSources) + "\n" +
+		fmt.Sprintf("Limits:%+v, ", c.Limits) + "\n" +
+		fmt.Sprintf("RateLimits:%+v, ", c.RateLimits) + "\n" +
+		fmt.Sprintf("StaticJoins:%d, ", len(c.StaticJoins)) + "\n" +
+		fmt.Sprintf("Forwarding.Mode:%s, ", c.Forwarding.Mode) + "\n" +
+		fmt.Sprintf("MLD:%t, ", c.MLD) + "\n" +
+		fmt.Sprintf("UDPEncap.Listen:%s, ", c.UDPEncap.Listen) + "\n" +
+		fmt.Sprintf("UDPEncap.Dst:%s, ", c.UDPEncap.Dst) + "\n" +
+		fmt.Sprintf("UDPEncap.Key:%t, ", len(c.UDPEncap.Key) > 0) + "\n" +
+		fmt.Sprintf("QueryNotifyPolicy:%s, ", c.QueryNotifyPolicy.Policy) + "\n" +
+		fmt.Sprintf("MembershipReportsPolicy:%s, ", c.MembershipReportsPolicy.Policy) + "\n" +
 		fmt.Sprintf("ChannelSize:%d,", c.ChannelSize) + "\n"
 }
 
+// IGMPReporter has value receivers, so the state changed after NewIGMPReporter is held by pointer
 type IGMPReporter struct {
 	conf Config
 
@@ -132,6 +177,7 @@ type IGMPReporter struct {
 
 	AltOutExists      bool
 	OutsideInterfaces map[side]bool
+	outPreferred      side
 
 	TimerDuration map[ttlType]time.Duration
 
@@ -148,6 +194,17 @@ type IGMPReporter struct {
 	mConIGMP map[side]map[netip.Addr]*ipv4.PacketConn
 	// Raw for sending
 	conRaw map[side]*ipv4.RawConn
+	// Raw for receiving, with HeaderValidation.  Wraps the anyCon socket to read the IP header
+	recvRaw    map[side]map[netip.Addr]*ipv4.RawConn
+	validation map[side]HeaderValidation
+	subnets    map[side][]netip.Prefix // LocalSubnet
+	ipHeaders  map[side]IPHeader       // sending
+	// MLD sends and receives on the same socket
+	mldConn  map[side]*ipv6.PacketConn
+	NetAddr6 map[side]netip.Addr // link local
+	// UDPEncap
+	udpListener net.PacketConn
+	udpClient   net.Conn
 
 	ContMsg map[side]*ipv4.ControlMessage
 
@@ -164,18 +221,29 @@ type IGMPReporter struct {
 	//mapNetIPtoIP   map[net.IP]destIP - you can't use net.IP as a key, so use netip.Addr
 	mapNetAddrtoIP map[netip.Addr]destIP
 
-	querierSourceIP netip.Addr
-	unicastDst      netip.Addr
+	querier    *querierState
+	joins      *membershipState // MembershipReportToNetworkCh
+	downstream *hostMemberships // reports proxied from the inside, by host
+	rate       *rateLimiter     // nil without RateLimits
+	udpReplay  *udpEncapReplay  // nil without UDPEncap.Key
+	static     *staticJoins     // nil without StaticJoins
+	groupStats *groupMetrics    // nil without GroupMetrics.Enabled
+	fwd        forwarder        // nil with ForwardingOff
+	unicastDst netip.Addr
+
+	observers *observers
 
 	pC         *prometheus.CounterVec
 	pH         *prometheus.SummaryVec
 	pCrecvIGMP *prometheus.CounterVec
 	pHrecvIGMP *prometheus.SummaryVec
+	pCpolicy   *prometheus.CounterVec
+	pCclients  *prometheus.CounterVec
 	pG         prometheus.Gauge
 
 	WG *sync.WaitGroup
 
-	debugLevel int
+	log *slog.Logger
 }
 
 // NewIGMPReporter
@@ -184,12 +252,12 @@ func NewIGMPReporter(conf Config) *IGMPReporter {
 	r := new(IGMPReporter)
 
 	r.conf = conf
+	r.conf.QueryNotifyPolicy = conf.QueryNotifyPolicy.resolve()
+	r.conf.MembershipReportsPolicy = conf.MembershipReportsPolicy.resolve()
 
-	r.debugLevel = conf.DebugLevel
+	r.log = newLogger(conf)
 
-	if r.debugLevel > 10 {
-		debugLog(r.debugLevel > 10, fmt.Sprintf("NewIGMPReporter() r.conf:%s", r.conf))
-	}
+	r.log.Debug("NewIGMPReporter()", "conf", r.conf.String())
 
 	r.pC = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -238,6 +306,22 @@ func NewIGMPReporter(conf Config) *IGMPReporter {
 		},
 		[]string{"function", "interface", "group", "type"},
 	)
+	r.pCpolicy = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: "counters",
+			Name:      "policy",
+			Help:      "goIGMP policy rule hits",
+		},
+		[]string{"rule", "action"},
+	)
+	r.pCclients = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Subsystem: "counters",
+			Name:      "unicastClients",
+			Help:      "goIGMP rejected unicast clients",
+		},
+		[]string{"client", "reason"},
+	)
 	r.pG = promauto.NewGauge(prometheus.GaugeOpts{
 		Subsystem: "guage",
 		Name:      "outInterfaceSelector",
@@ -254,30 +338,75 @@ func NewIGMPReporter(conf Config) *IGMPReporter {
 	m.Store(IN, OUT)
 	r.IntOutName = &m
 
+	r.OutsideInterfaces = make(map[side]bool)
+	r.OutsideInterfaces[OUT] = true
+
 	if len(r.conf.AltOutIntName) > 0 {
 		r.AltOutExists = true
 
 		r.IntName[ALTOUT] = r.conf.AltOutIntName
 		r.Interfaces = append(r.Interfaces, ALTOUT)
+		r.IntOutName.Store(ALTOUT, IN)
 
 		r.OutInterfaceSelectorCh = make(chan side, r.conf.ChannelSize)
 
-		r.OutsideInterfaces = make(map[side]bool)
-		r.OutsideInterfaces[OUT] = true
 		r.OutsideInterfaces[ALTOUT] = true
+
+		var err error
+		if r.outPreferred, err = r.outSelectionDefaults(); err != nil {
+			log.Fatal("NewIGMPReporter() outSelectionDefaults err:", err)
+		}
+		r.IntOutName.Store(IN, r.outPreferred)
 	}
 
-	if r.debugLevel > 10 {
+	if r.conf.OutSelection.Mode != OutSelectManual && !r.AltOutExists {
+		log.Fatal("NewIGMPReporter() OutSelection.Mode:", r.conf.OutSelection.Mode, " requires AltOutIntName")
+	}
+
+	if r.debugOn() {
 		for key, val := range r.IntName {
-			debugLog(r.debugLevel > 10, fmt.Sprintf("NewIGMPReporter() IntName Key: %v, Value: %v", key, val))
+			r.log.Debug("NewIGMPReporter() IntName", "key", key, "value", val)
 		}
-		for key, val := range r.IntName {
-			debugLog(r.debugLevel > 10, fmt.Sprintf("NewIGMPReporter() IntOutName Key: %v, Value: %v", key, val))
+		r.IntOutName.Range(func(key, val any) bool {
+			r.log.Debug("NewIGMPReporter() IntOutName", "key", key, "value", val)
+			return true
+		})
+	}
+
+	if r.conf.SSM.active() {
+		if err := r.conf.SSM.defaults(); err != nil {
+			log.Fatal("NewIGMPReporter() SSM err:", err)
 		}
 	}
 
 	r.unicastDst = netip.MustParseAddr(r.conf.UnicastDst)
 
+	r.querier = newQuerierState()
+	r.joins = newMembershipState(0)
+	r.downstream = newHostMemberships()
+	if len(r.conf.UDPEncap.Key) > 0 {
+		r.udpReplay = newUDPEncapReplay()
+	}
+	if len(r.conf.StaticJoins) > 0 {
+		var err error
+		if r.static, err = r.newStaticJoins(r.conf.StaticJoins); err != nil {
+			log.Fatal("NewIGMPReporter() StaticJoins err:", err)
+		}
+	}
+	if r.conf.RateLimits.active() {
+		r.rate = newRateLimiter(r.conf.RateLimits, time.Now())
+	}
+
+	if r.conf.GroupMetrics.Enabled {
+		r.groupStats = newGroupMetrics(r.conf.GroupMetrics)
+		prometheus.MustRegister(r.groupStats)
+	}
+
+	r.observers = new(observers)
+	for _, o := range r.conf.Observers {
+		r.AddObserver(o)
+	}
+
 	r.TimerDuration = make(map[ttlType]time.Duration)
 	r.TimerDuration[GRATUITOUS] = conf.Gratuitous
 	r.TimerDuration[QUERY] = conf.QueryTime
@@ -292,6 +421,12 @@ func NewIGMPReporter(conf Config) *IGMPReporter {
 	r.anyCon = make(map[side]map[netip.Addr]net.PacketConn)
 	r.mConIGMP = make(map[side]map[netip.Addr]*ipv4.PacketConn)
 	r.conRaw = make(map[side]*ipv4.RawConn)
+	r.recvRaw = make(map[side]map[netip.Addr]*ipv4.RawConn)
+	r.validation = make(map[side]HeaderValidation)
+	r.subnets = make(map[side][]netip.Prefix)
+	r.ipHeaders = make(map[side]IPHeader)
+	r.mldConn = make(map[side]*ipv6.PacketConn)
+	r.NetAddr6 = make(map[side]netip.Addr)
 
 	r.ContMsg = make(map[side]*ipv4.ControlMessage)
 
@@ -303,17 +438,19 @@ func NewIGMPReporter(conf Config) *IGMPReporter {
 		r.LeaveToNetworkCh = make(chan []MembershipItem, r.conf.ChannelSize)
 	}
 
+	r.registerChannelDepthGauges()
+
 	r.mapIPtoNetIP, r.mapIPtoNetAddr, r.mapNetAddrtoIP = r.makeIPMaps()
 
-	if r.debugLevel > 10 {
+	if r.debugOn() {
 		for key, val := range r.mapIPtoNetIP {
-			debugLog(r.debugLevel > 10, fmt.Sprintf("NewIGMPReporter() mapIPtoNetIP Key: %v, Value: %v", key, val))
+			r.log.Debug("NewIGMPReporter() mapIPtoNetIP", "key", key, "value", val)
 		}
 		for key, val := range r.mapIPtoNetAddr {
-			debugLog(r.debugLevel > 10, fmt.Sprintf("NewIGMPReporter() mapIPtoNetAddr Key: %v, Value: %v", key, val))
+			r.log.Debug("NewIGMPReporter() mapIPtoNetAddr", "key", key, "value", val)
 		}
 		for key, val := range r.mapNetAddrtoIP {
-			debugLog(r.debugLevel > 10, fmt.Sprintf("NewIGMPReporter() mapNetAddrtoIP Key: %v, Value: %v", key, val))
+			r.log.Debug("NewIGMPReporter() mapNetAddrtoIP", "key", key, "value", val)
 		}
 	}
 
@@ -323,26 +460,58 @@ func NewIGMPReporter(conf Config) *IGMPReporter {
 		r.ContMsg[i] = &ipv4.ControlMessage{IfIndex: r.NetIF[i].Index}
 	}
 
-	debugLog(r.debugLevel > 10, "NewIGMPReporter() Opening sockets")
+	r.headerValidationDefaults()
+	r.ipHeadersDefaults()
+
+	if r.conf.Testing.ReplayOnly {
+		// packets are fed in via ReplayPcap, so there are no sockets to open
+		r.log.Debug("NewIGMPReporter() Testing.ReplayOnly, not opening sockets")
+		r.WG = new(sync.WaitGroup)
+		return r
+	}
+
+	r.log.Debug("NewIGMPReporter() Opening sockets")
 
 	if r.conf.UnicastProxyInToOut {
-		debugLog(r.debugLevel > 10, "NewIGMPReporter() UnicastProxyInToOut")
+		r.log.Debug("NewIGMPReporter() UnicastProxyInToOut")
 
 		r.uCon[IN] = r.openUnicastPacketConn(IN)
 
 		if r.conRaw[OUT] == nil {
 			r.conRaw[OUT] = r.openRawConnection(OUT)
 		}
+
+		// the unicast queries are sent on, or answered, on the inside
+		if r.conf.UnicastQueries != UnicastQueryIgnore && r.conRaw[IN] == nil {
+			r.conRaw[IN] = r.openRawConnection(IN)
+		}
+	}
+
+	if r.conf.UDPEncap.Listen != "" {
+		r.log.Debug("NewIGMPReporter() UDPEncap.Listen")
+
+		r.udpListener = r.openUDPEncapListener()
+
+		if r.conRaw[OUT] == nil {
+			r.conRaw[OUT] = r.openRawConnection(OUT)
+		}
+	}
+
+	if r.conf.UDPEncap.Dst != "" {
+		r.log.Debug("NewIGMPReporter() UDPEncap.Dst")
+
+		// the reports and leaves go to the proxy, so no raw socket is needed to send them
+		r.udpClient = r.openUDPEncapClient()
 	}
 
 	if r.conf.QueryNotify || r.conf.MembershipReportsFromNetwork {
-		debugLog(r.debugLevel > 10, "NewIGMPReporter() r.conf.QueryNotify || r.conf.MembershipReportsFromNetwork")
+		r.log.Debug("NewIGMPReporter() QueryNotify || MembershipReportsFromNetwork")
 
 		r.createPacketConns(OUT)
 	}
 
 	if r.conf.ProxyOutToIn {
-		debugLog(r.debugLevel > 10, "NewIGMPReporter() ProxyOutToIn")
+		r.log.Debug("NewIGMPReporter() ProxyOutToIn")
 
 		r.createPacketConns(OUT)
 
@@ -351,23 +520,90 @@ func NewIGMPReporter(conf Config) *IGMPReporter {
 		}
 
 		if r.AltOutExists {
-			debugLog(r.debugLevel > 10, "NewIGMPReporter() ProxyOutToIn with alternative output")
+			r.log.Debug("NewIGMPReporter() ProxyOutToIn with alternative output")
 			r.createPacketConns(ALTOUT)
 		}
 	}
 
-	if r.conf.ProxyInToOut || r.conf.MembershipReportsToNetwork {
-		debugLog(r.debugLevel > 10, "NewIGMPReporter() r.conf.ProxyInToOut || r.conf.MembershipReportsToNetwork")
+	if r.conf.ProxyInToOut || (r.conf.MembershipReportsToNetwork && r.udpClient == nil) {
+		r.log.Debug("NewIGMPReporter() ProxyInToOut || MembershipReportsToNetwork")
 
 		r.createPacketConns(IN)
 
 		if r.conRaw[OUT] == nil {
-			debugLog(r.debugLevel > 10, "openRawConnection(OUT)")
+			r.log.Debug("NewIGMPReporter() openRawConnection", "iface", OUT)
 			r.conRaw[OUT] = r.openRawConnection(OUT)
 		}
 
 		if r.AltOutExists {
-			debugLog(r.debugLevel > 10, "openRawConnection(ALTOUT)")
+			r.log.Debug("NewIGMPReporter() createPacketConns", "iface", ALTOUT)
+			r.createPacketConns(ALTOUT)
+		}
+	}
+
+	if r.conf.OutSelection.Mode == OutSelectQuerier {
+		r.log.Debug("NewIGMPReporter() OutSelectQuerier")
+
+		// queries are needed from both outside interfaces
+		r.createPacketConns(OUT)
+		r.createPacketConns(ALTOUT)
+
+		if r.conRaw[OUT] == nil {
+			r.conRaw[OUT] = r.openRawConnection(OUT)
+		}
+	}
+
+	if r.static != nil {
+		r.log.Debug("NewIGMPReporter() StaticJoins")
+
+		// queries are answered for the static joins
+		r.createPacketConns(OUT)
+
+		if r.conRaw[OUT] == nil {
+			r.conRaw[OUT] = r.openRawConnection(OUT)
+		}
+	}
+
+	if r.conf.Forwarding.Mode != ForwardingOff {
+		r.log.Debug("NewIGMPReporter() Forwarding", "mode", r.conf.Forwarding.Mode)
+
+		if !r.conf.ProxyInToOut && !r.conf.UnicastProxyInToOut && r.conf.UDPEncap.Listen == "" {
+			log.Fatal("NewIGMPReporter() Forwarding requires ProxyInToOut, UnicastProxyInToOut or UDPEncap.Listen, to learn the inside memberships")
+		}
+
+		var err error
+		switch r.conf.Forwarding.Mode {
+		case ForwardingKernel:
+			r.fwd, err = r.newKernelForwarder()
+		case ForwardingSMCRoute:
+			r.fwd, err = r.newSMCRouteForwarder()
+		default:
+			log.Fatal("NewIGMPReporter() unknown Forwarding.Mode:", r.conf.Forwarding.Mode)
+		}
+		if err != nil {
+			log.Fatal("NewIGMPReporter() Forwarding err:", err)
+		}
+	}
+
+	if r.conf.MLD {
+		r.log.Debug("NewIGMPReporter() MLD")
+
+		for _, i := range r.Interfaces {
+			var err error
+			if r.NetAddr6[i], err = r.getLinkLocal6(i); err != nil {
+				log.Fatal("NewIGMPReporter() MLD err:", err)
+			}
+			r.mldConn[i] = r.openMLDConn(i)
+		}
+	}
+
+	if r.AltOutExists {
+		// either outside interface can become active, so they need the same sockets
+		if r.conRaw[OUT] != nil && r.conRaw[ALTOUT] == nil {
+			r.log.Debug("NewIGMPReporter() openRawConnection", "iface", ALTOUT)
+			r.conRaw[ALTOUT] = r.openRawConnection(ALTOUT)
+		}
+		if r.conf.QueryNotify || r.conf.MembershipReportsFromNetwork || r.static != nil {
 			r.createPacketConns(ALTOUT)
 		}
 	}
@@ -375,11 +611,11 @@ func NewIGMPReporter(conf Config) *IGMPReporter {
 	var wg sync.WaitGroup
 	r.WG = &wg
 
-	debugLog(r.debugLevel > 10, "NewIGMPReporter() setup complete")
+	r.log.Debug("NewIGMPReporter() setup complete")
 
-	if r.debugLevel > 10 {
+	if r.debugOn() {
 		for key, val := range r.NetIFIndex {
-			debugLog(r.debugLevel > 10, fmt.Sprintf("NewIGMPReporter() NetIFIndex Key: %v, Value: %v", key, val))
+			r.log.Debug("NewIGMPReporter() NetIFIndex", "key", key, "value", val)
 		}
 	}
 
@@ -390,15 +626,15 @@ func (r IGMPReporter) Run(ctx context.Context, wg *sync.WaitGroup) {
 
 	defer wg.Done()
 
-	debugLog(r.debugLevel > 10, "IGMPReporter.Run()")
+	r.log.Debug("IGMPReporter.Run()")
 
 	var added int
 
-	if r.conf.ProxyOutToIn || r.conf.QueryNotify || r.conf.MembershipReportsFromNetwork {
+	if r.conf.ProxyOutToIn || r.conf.QueryNotify || r.conf.MembershipReportsFromNetwork || r.conf.OutSelection.Mode == OutSelectQuerier || r.static != nil {
 		for _, g := range r.multicastGroups {
 			r.WG.Add(1)
 			go r.recvIGMP(r.WG, ctx, OUT, g)
-			debugLog(r.debugLevel > 10, fmt.Sprintf("IGMPReporter.Run() recvIGMP OUT started, g:%s", r.mapIPtoNetAddr[g]))
+			r.log.Debug("IGMPReporter.Run() recvIGMP started", "iface", OUT, "group", r.mapIPtoNetAddr[g])
 			added++
 		}
 
@@ -406,22 +642,71 @@ func (r IGMPReporter) Run(ctx context.Context, wg *sync.WaitGroup) {
 			for _, g := range r.multicastGroups {
 				r.WG.Add(1)
 				go r.recvIGMP(r.WG, ctx, ALTOUT, g)
-				debugLog(r.debugLevel > 10, fmt.Sprintf("IGMPReporter.Run() recvIGMP ALTOUT started, g:%s", r.mapIPtoNetAddr[g]))
+				r.log.Debug("IGMPReporter.Run() recvIGMP started", "iface", ALTOUT, "group", r.mapIPtoNetAddr[g])
 				added++
 			}
+		}
+	}
 
+	if r.AltOutExists {
+		// IntOutName is also used by the unicast proxy, so the selector always runs
+		r.WG.Add(1)
+		go r.outInterfaceSelector(r.WG, ctx)
+		r.log.Debug("IGMPReporter.Run() outInterfaceSelector started")
+		added++
+
+		switch r.conf.OutSelection.Mode {
+		case OutSelectLink:
+			r.WG.Add(1)
+			go r.outInterfaceFailover(r.WG, ctx)
+			r.log.Debug("IGMPReporter.Run() outInterfaceFailover started")
+			added++
+		case OutSelectQuerier:
 			r.WG.Add(1)
-			go r.outInterfaceSelector(r.WG)
-			debugLog(r.debugLevel > 10, "IGMPReporter.Run() outInterfaceSelector started()")
+			go r.outInterfaceQuerier(r.WG, ctx)
+			r.log.Debug("IGMPReporter.Run() outInterfaceQuerier started")
 			added++
 		}
 	}
 
+	if r.static != nil {
+		r.WG.Add(1)
+		go r.staticJoinReporter(r.WG, ctx)
+		r.log.Debug("IGMPReporter.Run() staticJoinReporter started")
+		added++
+	}
+
+	if r.fwd != nil {
+		r.WG.Add(1)
+		go r.forwardingManager(r.WG, ctx, r.fwd)
+		r.log.Debug("IGMPReporter.Run() forwardingManager started")
+		added++
+	}
+
+	if r.rate != nil {
+		// not counted in added, as it only sends what the other goroutines queue
+		r.WG.Add(1)
+		go r.rateLimitFlusher(r.WG, ctx)
+		r.log.Debug("IGMPReporter.Run() rateLimitFlusher started")
+	}
+
 	if r.conf.ProxyInToOut {
 		for _, g := range r.multicastGroups {
 			r.WG.Add(1)
 			go r.recvIGMP(r.WG, ctx, IN, g)
-			debugLog(r.debugLevel > 10, fmt.Sprintf("IGMPReporter.Run() recvIGMP IN started, g:%s", r.mapIPtoNetAddr[g]))
+			r.log.Debug("IGMPReporter.Run() recvIGMP started", "iface", IN, "group", r.mapIPtoNetAddr[g])
+			added++
+		}
+	}
+
+	if r.conf.MLD {
+		for _, i := range r.Interfaces {
+			if !r.mldRecv(i) {
+				continue
+			}
+			r.WG.Add(1)
+			go r.recvMLD(r.WG, ctx, i)
+			r.log.Debug("IGMPReporter.Run() recvMLD started", "iface", i)
 			added++
 		}
 	}
@@ -429,45 +714,52 @@ func (r IGMPReporter) Run(ctx context.Context, wg *sync.WaitGroup) {
 	if r.conf.UnicastProxyInToOut {
 		r.WG.Add(1)
 		go r.recvUnicastIGMP(r.WG, ctx, IN)
-		debugLog(r.debugLevel > 10, "IGMPReporter.Run() UnicastProxyInToOut started")
+		r.log.Debug("IGMPReporter.Run() UnicastProxyInToOut started")
+		added++
+	}
+
+	if r.udpListener != nil {
+		r.WG.Add(1)
+		go r.recvUDPEncap(r.WG, ctx)
+		r.log.Debug("IGMPReporter.Run() recvUDPEncap started")
 		added++
 	}
 
 	if r.conf.MembershipReportsToNetwork {
 		r.WG.Add(1)
 		go r.readMembershipReportToNetworkCh(r.WG, ctx)
-		debugLog(r.debugLevel > 10, "IGMPReporter.Run() readMembershipReportToNetworkCh started")
+		r.log.Debug("IGMPReporter.Run() readMembershipReportToNetworkCh started")
 		added++
 	}
 
 	if r.conf.LeaveToNetwork {
 		r.WG.Add(1)
 		go r.leaveToNetworkWorker(r.WG, ctx)
-		debugLog(r.debugLevel > 10, "IGMPReporter.Run() leaveToNetworkWorker started")
+		r.log.Debug("IGMPReporter.Run() leaveToNetworkWorker started")
 		added++
 	}
 
 	if r.conf.Testing.ConnectQueryToReport {
 		r.WG.Add(1)
 		go r.connectQueryToReport(r.WG, ctx)
-		debugLog(r.debugLevel > 10, "IGMPReporter.Run() connectQueryToReport started")
+		r.log.Debug("IGMPReporter.Run() connectQueryToReport started")
 		added++
 	}
 
 	if r.conf.Testing.MembershipReportsReader {
 		r.WG.Add(1)
 		go r.testingReadMembershipReportsFromNetwork(r.WG, ctx)
-		debugLog(r.debugLevel > 10, "IGMPReporter.Run() testingReadMembershipReportsFromNetwork started")
+		r.log.Debug("IGMPReporter.Run() testingReadMembershipReportsFromNetwork started")
 		added++
 	}
 
-	debugLog(r.debugLevel > 10, "IGMPReporter.Run() r.WG.Wait()")
+	r.log.Debug("IGMPReporter.Run() r.WG.Wait()")
 	r.WG.Wait()
 
 	if added == 0 {
-		debugLog(r.debugLevel > 10, "IGMPReporter.Run() added == 0.  Recommend enabling some features")
+		r.log.Warn("IGMPReporter.Run() added == 0.  Recommend enabling some features")
 	} else {
-		debugLog(r.debugLevel > 10, fmt.Sprintf("IGMPReporter.Run() complete (added:%d)", added))
+		r.log.Debug("IGMPReporter.Run() complete", "added", added)
 	}
 
 }
@@ -497,25 +789,25 @@ func (r IGMPReporter) makeIPMaps() (
 	mapIPtoNetIP[allRouters] = net.ParseIP(allRoutersQuad).To4()
 	mapIPtoNetIP[IGMPHosts] = net.ParseIP(IGMPHostsQuad).To4()
 
-	debugLog(r.debugLevel > 100, fmt.Sprintf("makeIPMaps() mapIPtoNetIP[allZerosHosts]:%s", mapIPtoNetIP[allZerosHosts]))
+	r.trace("makeIPMaps()", "allZerosHosts", mapIPtoNetIP[allZerosHosts])
 	az, err := r.netip2Addr(mapIPtoNetIP[allZerosHosts])
 	if err != nil {
 		log.Fatal("makeIPMaps() netip2Addr allZerosHosts err:", err)
 	}
 
-	debugLog(r.debugLevel > 100, fmt.Sprintf("makeIPMaps() mapIPtoNetIP[allHosts]:%s", mapIPtoNetIP[allHosts]))
+	r.trace("makeIPMaps()", "allHosts", mapIPtoNetIP[allHosts])
 	ah, err := r.netip2Addr(mapIPtoNetIP[allHosts])
 	if err != nil {
 		log.Fatal("makeIPMaps() netip2Addr allHosts err:", err)
 	}
 
-	debugLog(r.debugLevel > 100, fmt.Sprintf("makeIPMaps() mapIPtoNetIP[allRouters]:%s", mapIPtoNetIP[allRouters]))
+	r.trace("makeIPMaps()", "allRouters", mapIPtoNetIP[allRouters])
 	ar, err := r.netip2Addr(mapIPtoNetIP[allRouters])
 	if err != nil {
 		log.Fatal("makeIPMaps() netip2Addr allRouters err:", err)
 	}
 
-	debugLog(r.debugLevel > 100, fmt.Sprintf("makeIPMaps() mapIPtoNetIP[IGMPHosts]:%s", mapIPtoNetIP[IGMPHosts]))
+	r.trace("makeIPMaps()", "IGMPHosts", mapIPtoNetIP[IGMPHosts])
 	ih, err := r.netip2Addr(mapIPtoNetIP[IGMPHosts])
 	if err != nil {
 		log.Fatal("makeIPMaps() netip2Addr IGMPHosts err:", err)
@@ -538,7 +830,9 @@ func (r IGMPReporter) makeIPMaps() (
 // https://djosephsen.github.io/posts/ipnet/
 func (r IGMPReporter) netip2Addr(ip net.IP) (netip.Addr, error) {
 
-	debugLog(r.debugLevel > 100, fmt.Sprintf("netip2Addr() ip:%s, multicast:%t", ip.String(), ip.IsMulticast()))
+	if r.traceOn() {
+		r.trace("netip2Addr()", "ip", ip, "multicast", ip.IsMulticast())
+	}
 
 	if addr, ok := netip.AddrFromSlice(ip); ok {
 		return addr, nil
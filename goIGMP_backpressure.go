@@ -0,0 +1,212 @@
+package goIGMP
+
+import (
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// BackpressurePolicy is what happens when a notification channel is full
+type BackpressurePolicy int
+
+const (
+	// BackpressureDefault is DropOldest, so a slow consumer loses stale data rather than the latest event
+	BackpressureDefault BackpressurePolicy = iota
+	// DropNewest discards the new event, which was the original behaviour
+	DropNewest
+	// DropOldest discards the oldest queued event to make room for the new one
+	DropOldest
+	// Coalesce merges the new event with the oldest queued event
+	// For MembershipReportFromNetworkCh the membership lists are merged.
+	// For QueryNotifyCh a notification is already pending, so the new one is not needed.
+	Coalesce
+	// BlockWithTimeout waits up to ChannelPolicy.Timeout, and then drops the new event
+	// This blocks the receive goroutine, so keep the timeout short
+	BlockWithTimeout
+)
+
+const (
+	defaultBlockTimeoutCst = 10 * time.Millisecond
+)
+
+func (p BackpressurePolicy) String() string {
+	switch p {
+	case BackpressureDefault:
+		return "default"
+	case DropNewest:
+		return "dropNewest"
+	case DropOldest:
+		return "dropOldest"
+	case Coalesce:
+		return "coalesce"
+	case BlockWithTimeout:
+		return "blockWithTimeout"
+	default:
+		return "unknown"
+	}
+}
+
+// ChannelPolicy is the backpressure policy for one notification channel
+// Timeout is only used by BlockWithTimeout, and defaults to 10ms
+type ChannelPolicy struct {
+	Policy  BackpressurePolicy
+	Timeout time.Duration
+}
+
+// resolve fills in the defaults
+func (c ChannelPolicy) resolve() ChannelPolicy {
+	if c.Policy == BackpressureDefault {
+		c.Policy = DropOldest
+	}
+	if c.Policy == BlockWithTimeout && c.Timeout <= 0 {
+		c.Timeout = defaultBlockTimeoutCst
+	}
+	return c
+}
+
+// sendResult is what happened to the event
+type sendResult int
+
+const (
+	sendOK sendResult = iota
+	sendDroppedNewest
+	sendDroppedOldest
+	sendCoalesced
+	sendTimeout
+)
+
+func (s sendResult) String() string {
+	switch s {
+	case sendOK:
+		return "sent"
+	case sendDroppedNewest:
+		return "droppedNewest"
+	case sendDroppedOldest:
+		return "droppedOldest"
+	case sendCoalesced:
+		return "coalesced"
+	case sendTimeout:
+		return "timeout"
+	default:
+		return "unknown"
+	}
+}
+
+// sendWithPolicy sends v to ch following the policy
+// merge combines the oldest queued event with v for Coalesce.  If merge is nil
+// the queued event already covers v, so v is discarded.
+//
+// There are multiple recvIGMP goroutines sending, so after making room the send
+// can still lose the race, in which case the new event is dropped.
+func sendWithPolicy[T any](ch chan T, v T, p ChannelPolicy, merge func(oldest, v T) T) sendResult {
+
+	select {
+	case ch <- v:
+		return sendOK
+	default:
+	}
+
+	switch p.Policy {
+
+	case DropOldest:
+		select {
+		case <-ch:
+		default:
+		}
+		select {
+		case ch <- v:
+			return sendDroppedOldest
+		default:
+			return sendDroppedNewest
+		}
+
+	case Coalesce:
+		if merge == nil {
+			return sendCoalesced
+		}
+		select {
+		case oldest := <-ch:
+			v = merge(oldest, v)
+		default:
+		}
+		select {
+		case ch <- v:
+			return sendCoalesced
+		default:
+			return sendDroppedNewest
+		}
+
+	case BlockWithTimeout:
+		t := time.NewTimer(p.Timeout)
+		defer t.Stop()
+		select {
+		case ch <- v:
+			return sendOK
+		case <-t.C:
+			return sendTimeout
+		}
+	}
+
+	return sendDroppedNewest
+}
+
+// mergeMembershipItems is the union of two membership lists
+// Sources for the same group are merged, keeping the order they were first seen.
+// A (*,G) item has no sources, and any source includes them all, so (*,G) merged with (S,G) is (*,G).
+func mergeMembershipItems(oldest, v []MembershipItem) []MembershipItem {
+
+	merged := make([]MembershipItem, 0, len(oldest)+len(v))
+	index := make(map[netip.Addr]int, len(oldest)+len(v))
+
+	for _, list := range [][]MembershipItem{oldest, v} {
+		for _, mi := range list {
+			i, ok := index[mi.Group]
+			if !ok {
+				index[mi.Group] = len(merged)
+				merged = append(merged, MembershipItem{
+					Group:   mi.Group,
+					Sources: slices.Clone(mi.Sources),
+				})
+				continue
+			}
+			if len(merged[i].Sources) == 0 || len(mi.Sources) == 0 {
+				merged[i].Sources = nil
+				continue
+			}
+			for _, s := range mi.Sources {
+				if !slices.Contains(merged[i].Sources, s) {
+					merged[i].Sources = append(merged[i].Sources, s)
+				}
+			}
+		}
+	}
+
+	return merged
+}
+
+// registerChannelDepthGauges exposes the queue depth of the notification channels
+// The depth is read when prometheus scrapes, so it is always current
+func (r *IGMPReporter) registerChannelDepthGauges() {
+
+	channels := map[string]func() int{
+		"QueryNotifyCh":                 func() int { return len(r.QueryNotifyCh) },
+		"MembershipReportFromNetworkCh": func() int { return len(r.MembershipReportFromNetworkCh) },
+		"MembershipReportToNetworkCh":   func() int { return len(r.MembershipReportToNetworkCh) },
+		"LeaveToNetworkCh":              func() int { return len(r.LeaveToNetworkCh) },
+		"OutInterfaceSelectorCh":        func() int { return len(r.OutInterfaceSelectorCh) },
+	}
+
+	for name, depth := range channels {
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Subsystem:   "guage",
+			Name:        "channelDepth",
+			Help:        "goIGMP notification channel queue depth",
+			ConstLabels: prometheus.Labels{"channel": name},
+		}, func() float64 {
+			return float64(depth())
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package goIGMP
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSendWithPolicy(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		policy ChannelPolicy
+		want   sendResult
+		queued []int
+	}{
+		{name: "default", policy: ChannelPolicy{}, want: sendDroppedOldest, queued: []int{2, 3}},
+		{name: "dropNewest", policy: ChannelPolicy{Policy: DropNewest}, want: sendDroppedNewest, queued: []int{1, 2}},
+		{name: "dropOldest", policy: ChannelPolicy{Policy: DropOldest}, want: sendDroppedOldest, queued: []int{2, 3}},
+		{name: "coalesce", policy: ChannelPolicy{Policy: Coalesce}, want: sendCoalesced, queued: []int{2, 4}},
+		{name: "block", policy: ChannelPolicy{Policy: BlockWithTimeout, Timeout: time.Millisecond}, want: sendTimeout, queued: []int{1, 2}},
+	}
+
+	sum := func(oldest, v int) int { return oldest + v }
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := make(chan int, 2)
+			p := tc.policy.resolve()
+
+			for _, v := range []int{1, 2} {
+				if res := sendWithPolicy(ch, v, p, sum); res != sendOK {
+					t.Fatalf("sendWithPolicy(%d) res:%s want:%s", v, res, sendOK)
+				}
+			}
+
+			if res := sendWithPolicy(ch, 3, p, sum); res != tc.want {
+				t.Errorf("sendWithPolicy(3) res:%s want:%s", res, tc.want)
+			}
+
+			close(ch)
+			var got []int
+			for v := range ch {
+				got = append(got, v)
+			}
+			if !reflect.DeepEqual(got, tc.queued) {
+				t.Errorf("queued:%v want:%v", got, tc.queued)
+			}
+		})
+	}
+}
+
+func TestSendWithPolicyBlock(t *testing.T) {
+
+	ch := make(chan struct{}, 1)
+	ch <- struct{}{}
+
+	go func() {
+		time.Sleep(time.Millisecond)
+		<-ch
+	}()
+
+	p := ChannelPolicy{Policy: BlockWithTimeout, Timeout: time.Second}
+	if res := sendWithPolicy(ch, struct{}{}, p, nil); res != sendOK {
+		t.Errorf("res:%s want:%s", res, sendOK)
+	}
+}
+
+func TestMergeMembershipItems(t *testing.T) {
+
+	g1 := netip.MustParseAddr("232.0.0.1")
+	g2 := netip.MustParseAddr("232.0.0.2")
+	s1 := netip.MustParseAddr("172.17.200.10")
+	s2 := netip.MustParseAddr("172.17.200.11")
+
+	oldest := []MembershipItem{{Group: g1, Sources: []netip.Addr{s1}}}
+	v := []MembershipItem{
+		{Group: g1, Sources: []netip.Addr{s1, s2}},
+		{Group: g2},
+	}
+
+	want := []MembershipItem{
+		{Group: g1, Sources: []netip.Addr{s1, s2}},
+		{Group: g2, Sources: nil},
+	}
+
+	got := mergeMembershipItems(oldest, v)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got:%v want:%v", got, want)
+	}
+
+	// the queued list must not be modified, the consumer may hold a reference
+	if len(oldest[0].Sources) != 1 {
+		t.Errorf("oldest modified:%v", oldest)
+	}
+
+	// (*,G) is any source, so merging it with (S,G), either way around, must stay (*,G)
+	anySource := []MembershipItem{{Group: g1, Sources: nil}}
+	for _, got := range [][]MembershipItem{
+		mergeMembershipItems(anySource, oldest),
+		mergeMembershipItems(oldest, anySource),
+	} {
+		if !reflect.DeepEqual(got, anySource) {
+			t.Errorf("got:%v want:%v", got, anySource)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package goIGMP
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// Validate checks the config for the mistakes that NewIGMPReporter stops on, and for the
+// incompatible combinations, without opening any sockets.  The interfaces must exist.
+// All the problems are returned, joined with errors.Join.
+func (c Config) Validate() error {
+
+	var errs []error
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	names := make(map[string]bool)
+	for _, n := range []struct {
+		field    string
+		name     string
+		required bool
+	}{
+		{"InIntName", c.InIntName, true},
+		{"OutIntName", c.OutIntName, true},
+		{"AltOutIntName", c.AltOutIntName, false},
+	} {
+		if n.name == "" {
+			if n.required {
+				add("%s is required", n.field)
+			}
+			continue
+		}
+		if _, err := net.InterfaceByName(n.name); err != nil {
+			add("%s:%s %w", n.field, n.name, err)
+		}
+		names[n.name] = true
+	}
+	outside := map[string]bool{"": true, c.OutIntName: true}
+	if c.AltOutIntName != "" {
+		outside[c.AltOutIntName] = true
+		if c.AltOutIntName == c.OutIntName {
+			add("AltOutIntName must not be OutIntName:%s", c.OutIntName)
+		}
+	}
+
+	if c.ProxyInToOut && c.UnicastProxyInToOut {
+		// the raw socket also receives the unicast IGMP, so the reports would be proxied twice
+		add("ProxyInToOut and UnicastProxyInToOut both proxy the reports received on InIntName:%s", c.InIntName)
+	}
+	if c.UnicastQueries != UnicastQueryIgnore && !c.UnicastProxyInToOut {
+		add("UnicastQueries:%s requires UnicastProxyInToOut", c.UnicastQueries)
+	}
+	if _, err := netip.ParseAddr(c.UnicastDst); err != nil {
+		add("UnicastDst: %w", err)
+	}
+
+	if c.QueryTime != 0 && c.QueryTime < minQueryDurationCst {
+		add("QueryTime:%s must be 0 for none, or at least %s", c.QueryTime, minQueryDurationCst)
+	}
+	if c.Gratuitous < 0 {
+		add("Gratuitous:%s must not be negative", c.Gratuitous)
+	}
+	if c.SocketReadDeadLine <= 0 && !c.Testing.ReplayOnly {
+		add("SocketReadDeadLine:%s must be positive", c.SocketReadDeadLine)
+	}
+	if c.ChannelSize < 0 {
+		add("ChannelSize:%d must not be negative", c.ChannelSize)
+	}
+
+	for _, e := range []fmt.Stringer{
+		c.UnicastQueries, c.QueryNotifyPolicy.Policy, c.MembershipReportsPolicy.Policy, c.OutSelection.Mode,
+		c.Policy.Default, c.SSM.Mode, c.SSM.ASMSources, c.Forwarding.Mode,
+	} {
+		if e.String() == "unknown" {
+			add("unknown %T:%v", e, e)
+		}
+	}
+	for i, rule := range c.Policy.Rules {
+		if rule.Action.String() == "unknown" {
+			add("Policy.Rules[%d] unknown Action:%d", i, rule.Action)
+		}
+	}
+
+	if c.OutSelection.Mode != OutSelectManual && c.AltOutIntName == "" {
+		add("OutSelection.Mode:%s requires AltOutIntName", c.OutSelection.Mode)
+	}
+	if !outside[c.OutSelection.Preferred] {
+		add("OutSelection.Preferred:%s must be OutIntName or AltOutIntName", c.OutSelection.Preferred)
+	}
+
+	for name := range c.HeaderValidation {
+		if !names[name] {
+			add("HeaderValidation unknown interface:%s", name)
+		}
+	}
+	for name, h := range c.IPHeaders {
+		if !names[name] {
+			add("IPHeaders unknown interface:%s", name)
+		}
+		if err := h.check(); err != nil {
+			add("IPHeaders(%s): %w", name, err)
+		}
+	}
+
+	if c.SSM.active() {
+		ssm := c.SSM
+		if err := ssm.defaults(); err != nil {
+			add("SSM: %w", err)
+		}
+	}
+	for i, j := range c.StaticJoins {
+		if !j.Group.Is4() || !j.Group.IsMulticast() {
+			add("StaticJoins[%d]: %w", i, errStaticJoinGroup)
+		}
+		for _, src := range j.Sources {
+			if !src.Is4() || src.IsMulticast() || src.IsUnspecified() {
+				add("StaticJoins[%d]: %w", i, errStaticJoinSource)
+			}
+		}
+		if !outside[j.Interface] {
+			add("StaticJoins[%d]: %w", i, errStaticJoinInterface)
+		}
+	}
+
+	if c.Limits.MaxGroupsPerInterface < 0 || c.Limits.MaxGroupsPerHost < 0 || c.Limits.MaxSourcesPerGroup < 0 {
+		add("Limits must not be negative")
+	}
+	if c.RateLimits.PerInterface.Rate < 0 || c.RateLimits.PerHost.Rate < 0 {
+		add("RateLimits Rate must not be negative")
+	}
+	if c.GroupMetrics.MaxGroups < 0 {
+		add("GroupMetrics.MaxGroups:%d must not be negative", c.GroupMetrics.MaxGroups)
+	}
+
+	if c.Forwarding.Mode != ForwardingOff && !c.ProxyInToOut && !c.UnicastProxyInToOut && c.UDPEncap.Listen == "" {
+		add("Forwarding requires ProxyInToOut, UnicastProxyInToOut or UDPEncap.Listen, to learn the inside memberships")
+	}
+
+	return errors.Join(errs...)
+}
+
+// The UnmarshalText methods let the modes be set by name, e.g. from a config file
+
+func (m *UnicastQueryMode) UnmarshalText(text []byte) error   { return unmarshalMode(m, text) }
+func (p *BackpressurePolicy) UnmarshalText(text []byte) error { return unmarshalMode(p, text) }
+func (m *OutSelectionMode) UnmarshalText(text []byte) error   { return unmarshalMode(m, text) }
+func (a *PolicyAction) UnmarshalText(text []byte) error       { return unmarshalMode(a, text) }
+func (m *SSMMode) UnmarshalText(text []byte) error            { return unmarshalMode(m, text) }
+func (m *ASMSourcesMode) UnmarshalText(text []byte) error     { return unmarshalMode(m, text) }
+func (m *ForwardingMode) UnmarshalText(text []byte) error     { return unmarshalMode(m, text) }
+
+// unmarshalMode finds the mode by its String(), as the modes count up from 0 until "unknown"
+func unmarshalMode[T interface {
+	~int
+	String() string
+}](m *T, text []byte) error {
+	for v := T(0); v.String() != "unknown"; v++ {
+		if v.String() == string(text) {
+			*m = v
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown %T:%q", *m, text)
+}
@@ -0,0 +1,83 @@
+package goIGMP
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigValidate(t *testing.T) {
+
+	if _, err := net.InterfaceByName(testIntNameCst); err != nil {
+		t.Skipf("interface %s is required: %v", testIntNameCst, err)
+	}
+
+	valid := func() Config {
+		return Config{
+			InIntName:          testIntNameCst,
+			OutIntName:         testIntNameCst,
+			UnicastDst:         "127.0.0.1",
+			ProxyInToOut:       true,
+			SocketReadDeadLine: time.Second,
+			QueryTime:          30 * time.Second,
+		}
+	}
+
+	if err := valid().Validate(); err != nil {
+		t.Fatalf("valid config err:%v", err)
+	}
+
+	tests := []struct {
+		name string
+		mod  func(c *Config)
+		want []string
+	}{
+		{"no interfaces", func(c *Config) { c.InIntName, c.OutIntName = "", "" }, []string{"InIntName is required", "OutIntName is required"}},
+		{"missing interface", func(c *Config) { c.AltOutIntName = "nope0" }, []string{"AltOutIntName:nope0"}},
+		{"both proxies", func(c *Config) { c.UnicastProxyInToOut = true }, []string{"ProxyInToOut and UnicastProxyInToOut"}},
+		{"fast query", func(c *Config) { c.QueryTime = 100 * time.Millisecond }, []string{"QueryTime:100ms"}},
+		{"selection without alt", func(c *Config) { c.OutSelection.Mode = OutSelectLink }, []string{"requires AltOutIntName"}},
+		{"unknown mode", func(c *Config) { c.Forwarding.Mode = 7 }, []string{"unknown goIGMP.ForwardingMode:unknown"}},
+		{"static join", func(c *Config) { c.StaticJoins = []StaticJoin{{Group: netip.MustParseAddr("10.1.1.1")}} }, []string{"StaticJoins[0]"}},
+		{"header names", func(c *Config) {
+			c.IPHeaders = map[string]IPHeader{"eth9": {DSCP: 64}}
+		}, []string{"IPHeaders unknown interface:eth9", "IPHeaders(eth9): DSCP:64"}},
+		{"all reported", func(c *Config) {
+			c.UnicastDst = ""
+			c.SocketReadDeadLine = 0
+			c.Limits.MaxGroupsPerHost = -1
+		}, []string{"UnicastDst", "SocketReadDeadLine", "Limits"}},
+	}
+	for _, tt := range tests {
+		c := valid()
+		tt.mod(&c)
+		err := c.Validate()
+		if err == nil {
+			t.Errorf("%s passed", tt.name)
+			continue
+		}
+		for _, w := range tt.want {
+			if !strings.Contains(err.Error(), w) {
+				t.Errorf("%s err:%v want:%s", tt.name, err, w)
+			}
+		}
+	}
+}
+
+func TestModeUnmarshalText(t *testing.T) {
+
+	var m SSMMode
+	if err := m.UnmarshalText([]byte("map")); err != nil || m != SSMMap {
+		t.Errorf("SSMMode:%s err:%v", m, err)
+	}
+	var b BackpressurePolicy
+	if err := b.UnmarshalText([]byte("blockWithTimeout")); err != nil || b != BlockWithTimeout {
+		t.Errorf("BackpressurePolicy:%s err:%v", b, err)
+	}
+	var f ForwardingMode
+	if err := f.UnmarshalText([]byte("unknown")); err == nil {
+		t.Errorf("ForwardingMode unknown passed:%s", f)
+	}
+}
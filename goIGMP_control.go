@@ -0,0 +1,170 @@
+package goIGMP
+
+import (
+	"errors"
+	"net/netip"
+	"time"
+)
+
+// The control API is for the applications driving the reporter remotely, e.g. the HTTPHandler
+// and the igmpcontrol gRPC service.  Joins and leaves are queued for the same workers as
+// MembershipReportToNetworkCh and LeaveToNetworkCh, so the policy, SSM and static joins still apply.
+
+var (
+	ErrJoinsOff         = errors.New("MembershipReportsToNetwork is off")
+	ErrLeavesOff        = errors.New("LeaveToNetwork is off")
+	ErrChannelFull      = errors.New("channel is full")
+	ErrNoGroups         = errors.New("no groups")
+	ErrControlGroup     = errors.New("group must be a multicast address, and IPv6 needs MLD")
+	ErrControlSource    = errors.New("sources must be unicast addresses of the group family")
+	ErrUnknownInterface = errors.New("unknown interface")
+	ErrNotOutside       = errors.New("not an outside interface")
+	ErrNoAltOut         = errors.New("there is no AltOutIntName to switch to")
+)
+
+// Querier is the source of the last query seen on an interface
+type Querier struct {
+	Interface string
+	Side      string
+	Addr      netip.Addr
+	Seen      time.Time
+}
+
+// MembershipTables are the memberships by where they came from
+type MembershipTables struct {
+	Joins      []MembershipItem // MembershipReportToNetworkCh and Join
+	Downstream []MembershipItem // reports proxied from the inside
+	Static     []MembershipItem // Config.StaticJoins on the active outside interface
+}
+
+// Join queues membership reports on the active outside interface
+// It does not block, returning ErrChannelFull instead
+func (r IGMPReporter) Join(items []MembershipItem) error {
+	if !r.conf.MembershipReportsToNetwork {
+		return ErrJoinsOff
+	}
+	return r.controlSend("Join", r.MembershipReportToNetworkCh, items)
+}
+
+// Leave queues leaves on the active outside interface
+func (r IGMPReporter) Leave(items []MembershipItem) error {
+	if !r.conf.LeaveToNetwork {
+		return ErrLeavesOff
+	}
+	return r.controlSend("Leave", r.LeaveToNetworkCh, items)
+}
+
+func (r IGMPReporter) controlSend(function string, ch chan []MembershipItem, items []MembershipItem) error {
+
+	if err := r.checkControlItems(items); err != nil {
+		r.pC.WithLabelValues(function, "invalid", "error").Inc()
+		return err
+	}
+
+	select {
+	case ch <- items:
+	default:
+		r.pC.WithLabelValues(function, "channelFull", "error").Inc()
+		return ErrChannelFull
+	}
+
+	r.pC.WithLabelValues(function, "items", "count").Add(float64(len(items)))
+	r.log.Info(function+"()", "items", items)
+
+	return nil
+}
+
+// checkControlItems checks the memberships from outside the process
+func (r IGMPReporter) checkControlItems(items []MembershipItem) error {
+
+	if len(items) == 0 {
+		return ErrNoGroups
+	}
+
+	for _, mi := range items {
+		g := mi.Group
+		if !g.IsMulticast() || g.Is4In6() || (g.Is6() && !r.conf.MLD) {
+			return ErrControlGroup
+		}
+		for _, src := range mi.Sources {
+			if !src.IsValid() || src.IsMulticast() || src.IsUnspecified() || src.Is4() != g.Is4() {
+				return ErrControlSource
+			}
+		}
+	}
+
+	return nil
+}
+
+// MembershipTables returns a copy of the memberships, sorted by group
+func (r IGMPReporter) MembershipTables() MembershipTables {
+	active := r.activeOutInterface()
+	return MembershipTables{
+		Joins:      r.joins.items(),
+		Downstream: r.downstream.items(),
+		Static:     r.static.items(active, active),
+	}
+}
+
+// Queriers returns the querier on each interface where a query has been seen
+func (r IGMPReporter) Queriers() []Querier {
+
+	r.querier.mu.RLock()
+	defer r.querier.mu.RUnlock()
+
+	var qs []Querier
+	for _, i := range r.Interfaces {
+		if q := r.querier.addr[i]; q.IsValid() {
+			qs = append(qs, Querier{Interface: r.IntName[i], Side: i.String(), Addr: q, Seen: r.querier.seen[i]})
+		}
+	}
+
+	return qs
+}
+
+// ActiveOutInterface returns the name of the active outside interface
+func (r IGMPReporter) ActiveOutInterface() string {
+	return r.IntName[r.activeOutInterface()]
+}
+
+// SelectOutInterface makes the named outside interface active, with OutInterfaceChangeEvent reason "admin"
+// It returns the previously active interface
+func (r IGMPReporter) SelectOutInterface(name string) (old string, err error) {
+
+	if !r.AltOutExists {
+		return "", ErrNoAltOut
+	}
+
+	interf, ok := r.outsideSide(name)
+	if !ok {
+		if _, ok := r.interfaceSide(name); ok {
+			return "", ErrNotOutside
+		}
+		return "", ErrUnknownInterface
+	}
+
+	old = r.ActiveOutInterface()
+	r.setOutInterface(interf, outReasonAdmin)
+
+	return old, nil
+}
+
+// interfaceSide finds the interface by name
+func (r IGMPReporter) interfaceSide(name string) (side, bool) {
+	for _, i := range r.Interfaces {
+		if r.IntName[i] == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// outsideSide is interfaceSide for the outside interfaces, as the inside may have the same name
+func (r IGMPReporter) outsideSide(name string) (side, bool) {
+	for _, i := range []side{OUT, ALTOUT} {
+		if r.OutsideInterfaces[i] && r.IntName[i] == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
@@ -1,9 +0,0 @@
-package goIGMP
-
-import "log"
-
-func debugLog(logIt bool, str string) {
-	if logIt {
-		log.Print(str)
-	}
-}
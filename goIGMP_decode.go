@@ -0,0 +1,136 @@
+package goIGMP
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/randomizedcoder/gopacket"
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+const (
+	minIGMPPayloadBytesCst = 8
+)
+
+var (
+	ErrIGMPTooShort     = errors.New("igmp payload too short")
+	ErrIGMPNotDecoded   = errors.New("igmp payload did not decode to IGMP")
+	ErrIGMPInvalidGroup = errors.New("igmp invalid group address")
+	ErrIGMPTruncated    = errors.New("igmp payload truncated")
+)
+
+// IGMPMessage is the decoded form of a single IGMP payload
+//
+// Group is the group address from the IGMP header, which is the group being
+// reported or left for v1/v2, or the group being queried for a group specific query.
+// MembershipItems is the list of groups carried by reports and leaves,
+// and is empty for queries.
+type IGMPMessage struct {
+	Type            layers.IGMPType
+	Version         uint8
+	Group           netip.Addr
+	GroupRecords    []layers.IGMPv3GroupRecord
+	MembershipItems []MembershipItem
+	Layer           gopacket.Layer
+}
+
+// DecodeIGMP decodes an IGMP payload ( the bytes after the IPv4 header )
+// This is used by recvIGMP, recvUnicastIGMP, the pcap replay, and the tests
+//
+// Anyone on the LAN can send us IGMP, so DecodeIGMP never trusts the payload.
+// gopacket ignores the errors from truncated IGMPv3 reports and queries,
+// so the record and source counts are checked here, and reported/left groups
+// must be multicast addresses.
+// https://github.com/randomizedcoder/gopacket/blob/master/layers/igmp.go#L224
+func DecodeIGMP(payload []byte) (msg IGMPMessage, err error) {
+
+	if len(payload) < minIGMPPayloadBytesCst {
+		return msg, ErrIGMPTooShort
+	}
+
+	msg.Type = layers.IGMPType(payload[0])
+
+	packet := gopacket.NewPacket(payload, layers.LayerTypeIGMP, gopacket.Default)
+
+	msg.Layer = packet.Layer(layers.LayerTypeIGMP)
+	if msg.Layer == nil {
+		return msg, ErrIGMPNotDecoded
+	}
+
+	switch l := msg.Layer.(type) {
+
+	case *layers.IGMPv1or2:
+		msg.Version = l.Version
+		if msg.Group, err = ipToAddr(l.GroupAddress); err != nil {
+			return msg, err
+		}
+		switch msg.Type {
+		case layers.IGMPMembershipReportV1, layers.IGMPMembershipReportV2, layers.IGMPLeaveGroup:
+			if !msg.Group.IsMulticast() {
+				return msg, fmt.Errorf("%w:%s", ErrIGMPInvalidGroup, msg.Group)
+			}
+			msg.MembershipItems = []MembershipItem{{Group: msg.Group}}
+		}
+
+	case *layers.IGMP:
+		msg.Version = l.Version
+		if msg.Type == layers.IGMPMembershipQuery {
+			if int(l.NumberOfSources) != len(l.SourceAddresses) {
+				return msg, ErrIGMPTruncated
+			}
+			if msg.Group, err = ipToAddr(l.GroupAddress); err != nil {
+				return msg, err
+			}
+			break
+		}
+		if int(l.NumberOfGroupRecords) != len(l.GroupRecords) {
+			return msg, ErrIGMPTruncated
+		}
+		msg.GroupRecords = l.GroupRecords
+		if msg.MembershipItems, err = groupRecordsToMembershipItems(l.GroupRecords); err != nil {
+			return msg, err
+		}
+
+	default:
+		return msg, ErrIGMPNotDecoded
+	}
+
+	return msg, nil
+}
+
+// groupRecordsToMembershipItems converts the IGMPv3 group records into []MembershipItem
+func groupRecordsToMembershipItems(groupRecords []layers.IGMPv3GroupRecord) (mitems []MembershipItem, err error) {
+
+	for _, gr := range groupRecords {
+		var mi MembershipItem
+		for _, sa := range gr.SourceAddresses {
+			na, errA := ipToAddr(sa)
+			if errA != nil {
+				return mitems, errA
+			}
+			mi.Sources = append(mi.Sources, na)
+		}
+
+		if mi.Group, err = ipToAddr(gr.MulticastAddress); err != nil {
+			return mitems, err
+		}
+		if !mi.Group.IsMulticast() {
+			return mitems, fmt.Errorf("%w:%s", ErrIGMPInvalidGroup, mi.Group)
+		}
+
+		mitems = append(mitems, mi)
+	}
+
+	return mitems, nil
+}
+
+// ipToAddr converts the IPv4 addresses gopacket returns into netip.Addr
+func ipToAddr(ip net.IP) (netip.Addr, error) {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return netip.Addr{}, fmt.Errorf("%w:%v", ErrIGMPInvalidGroup, []byte(ip))
+	}
+	return addr.Unmap(), nil
+}
@@ -0,0 +1,144 @@
+package goIGMP
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// go test -run Golden -update
+var update = flag.Bool("update", false, "update the golden files in testdata/golden")
+
+const (
+	pcapsDirCst  = "pcaps"
+	goldenDirCst = "testdata/golden"
+)
+
+// formatMessage renders a decoded IGMP message as a stable single line for the golden files
+func formatMessage(msg IGMPMessage, err error) string {
+	if err != nil {
+		return fmt.Sprintf("err:%v", err)
+	}
+
+	items := make([]string, 0, len(msg.MembershipItems))
+	for i, mi := range msg.MembershipItems {
+		var rt string
+		if i < len(msg.GroupRecords) {
+			rt = msg.GroupRecords[i].Type.String() + " "
+		}
+		srcs := make([]string, 0, len(mi.Sources))
+		for _, s := range mi.Sources {
+			srcs = append(srcs, s.String())
+		}
+		items = append(items, fmt.Sprintf("{%sG:%s S:[%s]}", rt, mi.Group, strings.Join(srcs, ",")))
+	}
+
+	group := "-"
+	if msg.Group.IsValid() {
+		group = msg.Group.String()
+	}
+
+	return fmt.Sprintf("type:%q version:%d group:%s items:[%s]",
+		msg.Type.String(), msg.Version, group, strings.Join(items, " "))
+}
+
+func checkGolden(t *testing.T, name string, got string) {
+	t.Helper()
+
+	golden := filepath.Join(goldenDirCst, name+".golden")
+
+	if *update {
+		if err := os.MkdirAll(goldenDirCst, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("ReadFile(%s) err:%v.  Run with -update to create it", golden, err)
+	}
+
+	if got != string(want) {
+		t.Errorf("%s mismatch\ngot:\n%s\nwant:\n%s", golden, got, want)
+	}
+}
+
+func TestDecodeIGMPGoldenPayloads(t *testing.T) {
+
+	files, err := filepath.Glob(filepath.Join(pcapsDirCst, "*.payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no payload files found")
+	}
+
+	for _, f := range files {
+		f := f
+		t.Run(filepath.Base(f), func(t *testing.T) {
+			payload, err := os.ReadFile(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			msg, err := DecodeIGMP(payload)
+
+			checkGolden(t, filepath.Base(f), formatMessage(msg, err)+"\n")
+		})
+	}
+}
+
+func TestDecodeIGMPGoldenPcaps(t *testing.T) {
+
+	files, err := filepath.Glob(filepath.Join(pcapsDirCst, "*.pcap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no pcap files found")
+	}
+
+	for _, f := range files {
+		f := f
+		t.Run(filepath.Base(f), func(t *testing.T) {
+			packets, err := ReadIGMPPcap(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var b strings.Builder
+			for i, p := range packets {
+				msg, err := DecodeIGMP(p.Payload)
+				fmt.Fprintf(&b, "%d %s > %s %s\n", i, p.Src, p.Dst, formatMessage(msg, err))
+			}
+
+			checkGolden(t, filepath.Base(f), b.String())
+		})
+	}
+}
+
+func TestDecodeIGMPShort(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		payload []byte
+	}{
+		{name: "nil", payload: nil},
+		{name: "one", payload: []byte{0x16}},
+		{name: "seven", payload: []byte{0x16, 0, 0, 0, 0xe8, 0, 0}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := DecodeIGMP(tc.payload); err != ErrIGMPTooShort {
+				t.Errorf("DecodeIGMP(%v) err:%v, want:%v", tc.payload, err, ErrIGMPTooShort)
+			}
+		})
+	}
+}
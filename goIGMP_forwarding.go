@@ -0,0 +1,294 @@
+package goIGMP
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ForwardingMode is how goIGMP forwards the multicast data, if at all
+type ForwardingMode int
+
+const (
+	// ForwardingOff is the original behaviour, the multicast data is forwarded by something else, e.g. SMCRoute
+	ForwardingOff ForwardingMode = iota
+	// ForwardingKernel programs the linux kernel multicast routing table (MRT_INIT, VIFs and MFC entries) directly
+	ForwardingKernel
+	// ForwardingSMCRoute adds and removes the routes via the smcrouted IPC socket
+	ForwardingSMCRoute
+)
+
+func (m ForwardingMode) String() string {
+	switch m {
+	case ForwardingOff:
+		return "off"
+	case ForwardingKernel:
+		return "kernel"
+	case ForwardingSMCRoute:
+		return "smcroute"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	forwardingIntervalCst = time.Second
+	// how long an upstream source is remembered after the kernel last asked for a route
+	sourceSeenTTLCst = groupMembershipIntervalCst
+)
+
+var errForwardingUnsupported = errors.New("kernel multicast forwarding is only supported on linux")
+
+// Forwarding configures the multicast data forwarding from the active outside interface to the inside
+//
+// The routes follow the memberships reported by the inside hosts, so the static joins and the
+// joins from MembershipReportToNetworkCh are not forwarded.  Routes are removed when the memberships
+// expire or are left, and moved when the active outside interface changes.
+//
+// On startup, the existing routes from the inside hosts' groups are adopted, and only removed
+// if they are not reported again within StartupGrace.  This avoids interrupting the traffic
+// when goIGMP is restarted.
+type Forwarding struct {
+	Mode           ForwardingMode
+	Interval       time.Duration // how often the routes are reconciled.  Defaults to 1s
+	StartupGrace   time.Duration // Defaults to 260s, the RFC 3376 Group Membership Interval
+	SMCRouteSocket string        // Defaults to /run/smcroute.sock
+}
+
+// route is a multicast route.  source is invalid for a (*,G) route
+type route struct {
+	source netip.Addr
+	group  netip.Addr
+	in     side
+	outs   []side
+}
+
+type routeKey struct {
+	source netip.Addr
+	group  netip.Addr
+}
+
+func (rt route) key() routeKey {
+	return routeKey{source: rt.source, group: rt.group}
+}
+
+func (rt route) equal(o route) bool {
+	return rt.source == o.source && rt.group == o.group && rt.in == o.in && slices.Equal(rt.outs, o.outs)
+}
+
+// forwarder is a forwarding backend
+type forwarder interface {
+	// anySource is true if the backend can install (*,G) routes,
+	// otherwise the sources are learned from the upstream traffic
+	anySource() bool
+	addRoute(rt route) error
+	delRoute(rt route) error
+	// upcalls are the (S,G)s arriving upstream without a route.  nil if anySource
+	upcalls() <-chan routeKey
+	// existing returns the routes from the outside to the inside that are already installed
+	existing() ([]route, error)
+	// start starts the backend workers, which stop on close
+	start(r IGMPReporter, wg *sync.WaitGroup)
+	close() error
+}
+
+// routeTable decides the routes from the memberships, and tracks what is installed
+// It is kept separate from the backends, so it can be tested
+type routeTable struct {
+	anySource  bool
+	installed  map[routeKey]route
+	seen       map[routeKey]time.Time
+	adopted    map[routeKey]bool
+	graceUntil time.Time
+}
+
+func newRouteTable(anySource bool) *routeTable {
+	return &routeTable{
+		anySource: anySource,
+		installed: make(map[routeKey]route),
+		seen:      make(map[routeKey]time.Time),
+		adopted:   make(map[routeKey]bool),
+	}
+}
+
+// adopt treats the existing routes as installed, and keeps them until the grace time
+func (t *routeTable) adopt(routes []route, until time.Time) {
+	for _, rt := range routes {
+		t.installed[rt.key()] = rt
+		t.adopted[rt.key()] = true
+	}
+	t.graceUntil = until
+}
+
+// sawSource records an upstream (S,G)
+func (t *routeTable) sawSource(k routeKey, now time.Time) {
+	t.seen[k] = now
+}
+
+// desired returns the routes for the memberships, with in as the upstream interface
+func (t *routeTable) desired(items []MembershipItem, in side, outs []side, now time.Time) map[routeKey]route {
+
+	for k, at := range t.seen {
+		// an installed route gets no upcalls, so it is kept while the membership is
+		if _, ok := t.installed[k]; !ok && now.Sub(at) > sourceSeenTTLCst {
+			delete(t.seen, k)
+		}
+	}
+
+	want := make(map[routeKey]route)
+	add := func(source netip.Addr, group netip.Addr) {
+		rt := route{source: source, group: group, in: in, outs: outs}
+		want[rt.key()] = rt
+	}
+
+	for _, mi := range items {
+		// the backends are IPv4 only, so the MLD groups are not forwarded
+		if !mi.Group.Is4() {
+			continue
+		}
+		switch {
+		case len(mi.Sources) > 0:
+			for _, s := range mi.Sources {
+				if t.anySource {
+					add(s, mi.Group)
+					continue
+				}
+				if _, ok := t.seen[routeKey{source: s, group: mi.Group}]; ok {
+					add(s, mi.Group)
+				}
+			}
+		case t.anySource:
+			add(netip.Addr{}, mi.Group)
+		default:
+			for k := range t.seen {
+				if k.group == mi.Group {
+					add(k.source, k.group)
+				}
+			}
+		}
+	}
+
+	return want
+}
+
+// diff returns the routes to add and delete.  A changed route is deleted and added
+// Adopted routes that are not wanted are kept during the startup grace
+func (t *routeTable) diff(want map[routeKey]route, now time.Time) (add []route, del []route) {
+	for k, rt := range t.installed {
+		w, ok := want[k]
+		if !ok && t.adopted[k] && now.Before(t.graceUntil) {
+			continue
+		}
+		if !ok || !w.equal(rt) {
+			del = append(del, rt)
+		}
+	}
+	for k, rt := range want {
+		if i, ok := t.installed[k]; !ok || !i.equal(rt) {
+			add = append(add, rt)
+		}
+	}
+	sortRoutes(add)
+	sortRoutes(del)
+	return add, del
+}
+
+func sortRoutes(routes []route) {
+	slices.SortFunc(routes, func(a, b route) int {
+		if c := a.group.Compare(b.group); c != 0 {
+			return c
+		}
+		return a.source.Compare(b.source)
+	})
+}
+
+// forwardingManager keeps the routes in step with the downstream memberships
+func (r IGMPReporter) forwardingManager(wg *sync.WaitGroup, ctx context.Context, fwd forwarder) {
+
+	defer wg.Done()
+
+	interval := r.conf.Forwarding.Interval
+	if interval <= 0 {
+		interval = forwardingIntervalCst
+	}
+
+	r.log.Debug("forwardingManager()", "mode", r.conf.Forwarding.Mode, "interval", interval, "anySource", fwd.anySource())
+
+	grace := r.conf.Forwarding.StartupGrace
+	if grace <= 0 {
+		grace = groupMembershipIntervalCst
+	}
+
+	fwd.start(r, wg)
+
+	t := newRouteTable(fwd.anySource())
+
+	if routes, err := fwd.existing(); err != nil {
+		r.log.Warn("forwardingManager existing", "err", err)
+		r.pC.WithLabelValues("forwardingManager", "existing", "error").Inc()
+	} else if len(routes) > 0 {
+		r.log.Info("forwardingManager() adopted existing routes", "routes", len(routes), "grace", grace)
+		t.adopt(routes, time.Now().Add(grace))
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for loops := 0; ; loops++ {
+
+		select {
+		case <-ctx.Done():
+			r.log.Debug("forwardingManager ctx.Done()", "loop", loops)
+			t.graceUntil = time.Time{}
+			r.reconcileRoutes(t, fwd, make(map[routeKey]route))
+			if err := fwd.close(); err != nil {
+				r.log.Warn("forwardingManager close", "err", err)
+			}
+			return
+		case k := <-fwd.upcalls():
+			if r.debugOn() {
+				r.log.Debug("forwardingManager upcall", "source", k.source, "group", k.group)
+			}
+			r.pC.WithLabelValues("forwardingManager", "upcall", "count").Inc()
+			t.sawSource(k, time.Now())
+		case <-ticker.C:
+		}
+
+		want := t.desired(r.downstream.items(), r.activeOutInterface(), []side{IN}, time.Now())
+		r.reconcileRoutes(t, fwd, want)
+	}
+}
+
+// reconcileRoutes installs and removes the routes, so the backend matches want
+func (r IGMPReporter) reconcileRoutes(t *routeTable, fwd forwarder, want map[routeKey]route) {
+
+	add, del := t.diff(want, time.Now())
+
+	for _, rt := range del {
+		if err := fwd.delRoute(rt); err != nil {
+			r.log.Warn("reconcileRoutes delRoute", "source", rt.source, "group", rt.group, "in", rt.in, "err", err)
+			r.pC.WithLabelValues("reconcileRoutes", "delRoute", "error").Inc()
+		}
+		// the route is forgotten either way, as the kernel may have removed it already
+		delete(t.installed, rt.key())
+		delete(t.adopted, rt.key())
+		r.pC.WithLabelValues("reconcileRoutes", "delRoute", "count").Inc()
+	}
+
+	for _, rt := range add {
+		if err := fwd.addRoute(rt); err != nil {
+			r.log.Warn("reconcileRoutes addRoute", "source", rt.source, "group", rt.group, "in", rt.in, "err", err)
+			r.pC.WithLabelValues("reconcileRoutes", "addRoute", "error").Inc()
+			continue
+		}
+		t.installed[rt.key()] = rt
+		r.pC.WithLabelValues("reconcileRoutes", "addRoute", "count").Inc()
+	}
+
+	if len(add) > 0 || len(del) > 0 {
+		r.log.Info("reconcileRoutes()", "added", len(add), "deleted", len(del), "installed", len(t.installed))
+	}
+}
@@ -0,0 +1,224 @@
+//go:build linux
+
+package goIGMP
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// linux/mroute.h
+const (
+	mrtInit   = 200
+	mrtAddVif = 202
+	mrtAddMfc = 204
+	mrtDelMfc = 205
+
+	maxVifs        = 32
+	viffUseIfindex = 0x8
+
+	igmpmsgNocache = 1
+
+	vifctlBytes  = 16
+	mfcctlBytes  = 60
+	igmpmsgBytes = 20
+)
+
+var errNoVif = errors.New("no VIF for the interface")
+
+// kernelForwarder programs the kernel multicast routing table
+// Only one process can own the table, so this can't run alongside SMCRoute or pimd
+type kernelForwarder struct {
+	conn *net.IPConn
+	vifs map[side]uint16
+	ups  chan routeKey
+	done chan struct{}
+	once sync.Once
+}
+
+// vifctl is struct vifctl, using the interface index
+func vifctl(vifi uint16, ifindex int) []byte {
+	b := make([]byte, vifctlBytes)
+	binary.NativeEndian.PutUint16(b[0:2], vifi)
+	b[2] = viffUseIfindex
+	b[3] = 1 // threshold
+	binary.NativeEndian.PutUint32(b[8:12], uint32(ifindex))
+	return b
+}
+
+// mfcctl is struct mfcctl
+func mfcctl(source netip.Addr, group netip.Addr, parent uint16, outs []uint16) []byte {
+	b := make([]byte, mfcctlBytes)
+	s4, g4 := source.As4(), group.As4()
+	copy(b[0:4], s4[:])
+	copy(b[4:8], g4[:])
+	binary.NativeEndian.PutUint16(b[8:10], parent)
+	for _, o := range outs {
+		if o < maxVifs {
+			b[10+o] = 1 // ttl threshold
+		}
+	}
+	return b
+}
+
+// parseUpcall returns the (S,G) from a NOCACHE struct igmpmsg
+// IGMP received on the same socket starts with the IGMP type, which is never zero in the top nibble
+func parseUpcall(b []byte) (k routeKey, vif uint8, ok bool) {
+	if len(b) < igmpmsgBytes || b[0]>>4 != 0 || b[9] != 0 || b[8] != igmpmsgNocache {
+		return k, 0, false
+	}
+	k.source = netip.AddrFrom4([4]byte(b[12:16]))
+	k.group = netip.AddrFrom4([4]byte(b[16:20]))
+	return k, b[10], true
+}
+
+func (k *kernelForwarder) setsockopt(opt int, b []byte) error {
+	rc, err := k.conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errS error
+	errC := rc.Control(func(fd uintptr) {
+		errS = syscall.SetsockoptString(int(fd), syscall.IPPROTO_IP, opt, string(b))
+	})
+	if errC != nil {
+		return errC
+	}
+	return errS
+}
+
+// newKernelForwarder opens the multicast routing socket, and adds a VIF for each interface
+func (r IGMPReporter) newKernelForwarder() (forwarder, error) {
+
+	c, err := net.ListenPacket("ip4:igmp", "0.0.0.0")
+	if err != nil {
+		return nil, err
+	}
+
+	k := &kernelForwarder{
+		conn: c.(*net.IPConn),
+		vifs: make(map[side]uint16),
+		ups:  make(chan routeKey, r.conf.ChannelSize),
+		done: make(chan struct{}),
+	}
+
+	init := make([]byte, 4)
+	binary.NativeEndian.PutUint32(init, 1)
+	if err := k.setsockopt(mrtInit, init); err != nil {
+		k.conn.Close()
+		return nil, err
+	}
+
+	for i, s := range r.Interfaces {
+		if err := k.setsockopt(mrtAddVif, vifctl(uint16(i), r.NetIF[s].Index)); err != nil {
+			k.conn.Close()
+			return nil, err
+		}
+		k.vifs[s] = uint16(i)
+		r.log.Debug("newKernelForwarder() VIF", "iface", s, "vif", i, "ifindex", r.NetIF[s].Index)
+	}
+
+	return k, nil
+}
+
+func (k *kernelForwarder) start(r IGMPReporter, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go k.readUpcalls(wg, r)
+}
+
+// readUpcalls reads the kernel NOCACHE upcalls for the outside interfaces
+func (k *kernelForwarder) readUpcalls(wg *sync.WaitGroup, r IGMPReporter) {
+
+	defer wg.Done()
+
+	outside := make(map[uint8]bool)
+	for s := range r.OutsideInterfaces {
+		outside[uint8(k.vifs[s])] = true
+	}
+
+	b := make([]byte, maxIGMPPacketRecieveBytesCst)
+	for {
+		select {
+		case <-k.done:
+			return
+		default:
+		}
+
+		if err := k.conn.SetReadDeadline(time.Now().Add(r.conf.SocketReadDeadLine)); err != nil {
+			return
+		}
+		n, _, err := k.conn.ReadFrom(b)
+		if err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				continue
+			}
+			r.pC.WithLabelValues("readUpcalls", "ReadFrom", "error").Inc()
+			continue
+		}
+
+		key, vif, ok := parseUpcall(b[:n])
+		if !ok || !outside[vif] {
+			continue
+		}
+
+		select {
+		case k.ups <- key:
+		default:
+			r.pC.WithLabelValues("readUpcalls", "upcalls", "full").Inc()
+		}
+	}
+}
+
+func (k *kernelForwarder) anySource() bool { return false }
+
+func (k *kernelForwarder) upcalls() <-chan routeKey { return k.ups }
+
+// existing is always empty, as MRT_INIT fails if another process owns the table,
+// and the table is flushed when the socket is closed
+func (k *kernelForwarder) existing() ([]route, error) { return nil, nil }
+
+func (k *kernelForwarder) vifsFor(rt route) (parent uint16, outs []uint16, err error) {
+	parent, ok := k.vifs[rt.in]
+	if !ok {
+		return 0, nil, errNoVif
+	}
+	for _, o := range rt.outs {
+		v, ok := k.vifs[o]
+		if !ok {
+			return 0, nil, errNoVif
+		}
+		outs = append(outs, v)
+	}
+	return parent, outs, nil
+}
+
+func (k *kernelForwarder) addRoute(rt route) error {
+	parent, outs, err := k.vifsFor(rt)
+	if err != nil {
+		return err
+	}
+	return k.setsockopt(mrtAddMfc, mfcctl(rt.source, rt.group, parent, outs))
+}
+
+func (k *kernelForwarder) delRoute(rt route) error {
+	parent, _, err := k.vifsFor(rt)
+	if err != nil {
+		return err
+	}
+	return k.setsockopt(mrtDelMfc, mfcctl(rt.source, rt.group, parent, nil))
+}
+
+// close removes the VIFs and MFC entries, as the kernel does when the socket is closed
+func (k *kernelForwarder) close() error {
+	var err error
+	k.once.Do(func() {
+		close(k.done)
+		err = k.conn.Close()
+	})
+	return err
+}
@@ -0,0 +1,42 @@
+//go:build linux
+
+package goIGMP
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestKernelForwardingStructs(t *testing.T) {
+
+	s := netip.MustParseAddr("10.0.0.1")
+	g := netip.MustParseAddr("239.0.0.1")
+
+	m := mfcctl(s, g, 1, []uint16{0, 2})
+	if len(m) != mfcctlBytes || netip.AddrFrom4([4]byte(m[0:4])) != s || netip.AddrFrom4([4]byte(m[4:8])) != g {
+		t.Fatalf("mfcctl:%x", m)
+	}
+	if m[10] != 1 || m[11] != 0 || m[12] != 1 {
+		t.Errorf("mfcctl ttls:%x", m[10:13])
+	}
+
+	if v := vifctl(2, 7); len(v) != vifctlBytes || v[2] != viffUseIfindex {
+		t.Errorf("vifctl:%x", v)
+	}
+
+	up := make([]byte, igmpmsgBytes)
+	up[8] = igmpmsgNocache
+	up[10] = 1
+	copy(up[12:16], s.AsSlice())
+	copy(up[16:20], g.AsSlice())
+	k, vif, ok := parseUpcall(up)
+	if !ok || vif != 1 || k.source != s || k.group != g {
+		t.Errorf("parseUpcall:%v %d %t", k, vif, ok)
+	}
+
+	// an IGMPv2 report on the same socket is not an upcall
+	report := append([]byte{0x16, 0, 0, 0}, up[4:]...)
+	if _, _, ok := parseUpcall(report); ok {
+		t.Error("IGMP parsed as an upcall")
+	}
+}
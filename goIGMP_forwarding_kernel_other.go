@@ -0,0 +1,8 @@
+//go:build !linux
+
+package goIGMP
+
+// newKernelForwarder needs the linux multicast routing socket, see goIGMP_forwarding_kernel_linux.go
+func (r IGMPReporter) newKernelForwarder() (forwarder, error) {
+	return nil, errForwardingUnsupported
+}
@@ -0,0 +1,252 @@
+package goIGMP
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// smcrouted IPC commands, see smcroute src/msg.h
+const (
+	smcrouteAddCst    = 'a'
+	smcrouteRemoveCst = 'r'
+	smcrouteShowCst   = 'S'
+
+	smcrouteSocketCst  = "/run/smcroute.sock"
+	smcrouteTimeoutCst = 2 * time.Second
+	// the reply is a short message, or the route table for show
+	smcrouteMaxReplyCst = 1 << 20
+)
+
+// struct ipc_msg { size_t len; uint16_t cmd; uint16_t count; char *argv[]; }
+// argv is pointer aligned, so the header is two words
+var smcrouteHeaderBytes = 2 * strconv.IntSize / 8
+
+var errSMCRouteArgs = errors.New("smcroute IPC message has too many arguments")
+
+// smcrouteForwarder drives smcrouted, which resolves (*,G) routes itself
+//
+// Each command is a new connection, like smcroutectl.
+type smcrouteForwarder struct {
+	path    string
+	timeout time.Duration
+	names   map[side]string
+	sides   map[string]side
+	outside map[side]bool
+}
+
+func (r IGMPReporter) newSMCRouteForwarder() (forwarder, error) {
+
+	s := &smcrouteForwarder{
+		path:    r.conf.Forwarding.SMCRouteSocket,
+		timeout: smcrouteTimeoutCst,
+		names:   make(map[side]string),
+		sides:   make(map[string]side),
+		outside: r.OutsideInterfaces,
+	}
+	if s.path == "" {
+		s.path = smcrouteSocketCst
+	}
+
+	for _, i := range r.Interfaces {
+		s.names[i] = r.IntName[i]
+		s.sides[r.IntName[i]] = i
+	}
+
+	// fail early if smcrouted isn't running
+	if _, err := s.command(smcrouteShowCst, nil); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *smcrouteForwarder) anySource() bool { return true }
+
+func (s *smcrouteForwarder) upcalls() <-chan routeKey { return nil }
+
+func (s *smcrouteForwarder) start(r IGMPReporter, wg *sync.WaitGroup) {}
+
+func (s *smcrouteForwarder) close() error { return nil }
+
+// routeArgs are the smcroutectl arguments: inbound [source] group
+func (s *smcrouteForwarder) routeArgs(rt route) []string {
+	args := []string{s.names[rt.in]}
+	if rt.source.IsValid() {
+		args = append(args, rt.source.String())
+	}
+	return append(args, rt.group.String())
+}
+
+func (s *smcrouteForwarder) addRoute(rt route) error {
+	args := s.routeArgs(rt)
+	for _, o := range rt.outs {
+		args = append(args, s.names[o])
+	}
+	_, err := s.command(smcrouteAddCst, args)
+	return err
+}
+
+func (s *smcrouteForwarder) delRoute(rt route) error {
+	_, err := s.command(smcrouteRemoveCst, s.routeArgs(rt))
+	return err
+}
+
+// existing returns the routes from an outside interface to only the inside interface
+// Other routes, e.g. from smcroute.conf, are not managed by goIGMP and are left alone
+func (s *smcrouteForwarder) existing() ([]route, error) {
+
+	reply, err := s.command(smcrouteShowCst, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var routes []route
+	for _, rt := range parseSMCRouteShow(reply, s.sides) {
+		if s.outside[rt.in] && len(rt.outs) == 1 && rt.outs[0] == IN {
+			routes = append(routes, rt)
+		}
+	}
+	return routes, nil
+}
+
+// command sends one IPC message, and returns the reply
+// smcrouted replies with an empty string on success, or the error text
+func (s *smcrouteForwarder) command(cmd uint16, args []string) (string, error) {
+
+	msg, err := smcrouteMsg(cmd, args)
+	if err != nil {
+		return "", err
+	}
+
+	c, err := net.DialTimeout("unix", s.path, s.timeout)
+	if err != nil {
+		return "", err
+	}
+	defer c.Close()
+
+	if err := c.SetDeadline(time.Now().Add(s.timeout)); err != nil {
+		return "", err
+	}
+
+	if _, err := c.Write(msg); err != nil {
+		return "", err
+	}
+
+	b, err := io.ReadAll(io.LimitReader(c, smcrouteMaxReplyCst))
+	if err != nil {
+		return "", err
+	}
+	reply := string(bytes.TrimRight(b, "\x00"))
+
+	if cmd != smcrouteShowCst && strings.TrimSpace(reply) != "" {
+		return "", fmt.Errorf("smcroute %c %s: %s", cmd, strings.Join(args, " "), strings.TrimSpace(reply))
+	}
+
+	return reply, nil
+}
+
+// smcrouteMsg encodes the struct ipc_msg, with the arguments as NUL terminated strings
+func smcrouteMsg(cmd uint16, args []string) ([]byte, error) {
+
+	if len(args) > 0xffff {
+		return nil, errSMCRouteArgs
+	}
+
+	size := smcrouteHeaderBytes
+	for _, a := range args {
+		size += len(a) + 1
+	}
+	size++
+
+	b := make([]byte, smcrouteHeaderBytes, size)
+	if smcrouteHeaderBytes == 16 {
+		binary.NativeEndian.PutUint64(b[0:], uint64(size))
+		binary.NativeEndian.PutUint16(b[8:], cmd)
+		binary.NativeEndian.PutUint16(b[10:], uint16(len(args)))
+	} else {
+		binary.NativeEndian.PutUint32(b[0:], uint32(size))
+		binary.NativeEndian.PutUint16(b[4:], cmd)
+		binary.NativeEndian.PutUint16(b[6:], uint16(len(args)))
+	}
+
+	for _, a := range args {
+		b = append(b, a...)
+		b = append(b, 0)
+	}
+
+	return append(b, 0), nil
+}
+
+// parseSMCRouteShow parses the route table from "smcroutectl show"
+//
+//	(10.0.0.1, 225.1.2.3)     eth0     0     0  eth1 eth2
+//	(*, 225.1.2.4)            eth0                eth1
+//
+// Routes with an interface goIGMP doesn't use are skipped, and the packet and byte counters are ignored
+func parseSMCRouteShow(reply string, sides map[string]side) (routes []route) {
+
+	sc := bufio.NewScanner(strings.NewReader(reply))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if !strings.HasPrefix(line, "(") {
+			continue
+		}
+		end := strings.Index(line, ")")
+		if end < 0 {
+			continue
+		}
+
+		sg := strings.Split(line[1:end], ",")
+		if len(sg) != 2 {
+			continue
+		}
+		group, err := netip.ParseAddr(strings.TrimSpace(sg[1]))
+		if err != nil {
+			continue
+		}
+		rt := route{group: group}
+		if src := strings.TrimSpace(sg[0]); src != "*" {
+			if rt.source, err = netip.ParseAddr(src); err != nil {
+				continue
+			}
+		}
+
+		fields := strings.Fields(line[end+1:])
+		if len(fields) == 0 {
+			continue
+		}
+		in, ok := sides[fields[0]]
+		if !ok {
+			continue
+		}
+		rt.in = in
+
+		known := true
+		for _, f := range fields[1:] {
+			if _, err := strconv.ParseUint(f, 10, 64); err == nil {
+				continue
+			}
+			o, ok := sides[f]
+			if !ok {
+				known = false
+				break
+			}
+			rt.outs = append(rt.outs, o)
+		}
+		if known {
+			routes = append(routes, rt)
+		}
+	}
+
+	return routes
+}
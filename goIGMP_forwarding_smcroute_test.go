@@ -0,0 +1,147 @@
+package goIGMP
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubSMCRouted is a stand-in for the smcrouted IPC socket
+type stubSMCRouted struct {
+	mu     sync.Mutex
+	cmds   []string
+	show   string
+	errors map[string]string
+}
+
+func (d *stubSMCRouted) serve(t *testing.T, l net.Listener) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		b := make([]byte, 4096)
+		n, err := c.Read(b)
+		if err != nil {
+			t.Errorf("Read err:%v", err)
+			c.Close()
+			continue
+		}
+		cmd, args := decodeStubMsg(t, b[:n])
+		line := string(rune(cmd)) + " " + strings.Join(args, " ")
+
+		d.mu.Lock()
+		d.cmds = append(d.cmds, line)
+		reply := "\x00"
+		if cmd == smcrouteShowCst {
+			reply = d.show
+		} else if e, ok := d.errors[line]; ok {
+			reply = e
+		}
+		d.mu.Unlock()
+
+		io.WriteString(c, reply)
+		c.Close()
+	}
+}
+
+func decodeStubMsg(t *testing.T, b []byte) (uint16, []string) {
+	var size uint64
+	var cmd, count uint16
+	if smcrouteHeaderBytes == 16 {
+		size = binary.NativeEndian.Uint64(b)
+		cmd = binary.NativeEndian.Uint16(b[8:])
+		count = binary.NativeEndian.Uint16(b[10:])
+	} else {
+		size = uint64(binary.NativeEndian.Uint32(b))
+		cmd = binary.NativeEndian.Uint16(b[4:])
+		count = binary.NativeEndian.Uint16(b[6:])
+	}
+	if size != uint64(len(b)) {
+		t.Errorf("len:%d read:%d", size, len(b))
+	}
+	// each argument is NUL terminated, and the list ends with an extra NUL
+	var args [][]byte
+	if body := bytes.TrimSuffix(b[smcrouteHeaderBytes:], []byte{0}); len(body) > 0 {
+		args = bytes.Split(bytes.TrimSuffix(body, []byte{0}), []byte{0})
+	}
+	if len(args) != int(count) {
+		t.Errorf("count:%d args:%q", count, args)
+	}
+	var s []string
+	for _, a := range args {
+		s = append(s, string(a))
+	}
+	return cmd, s
+}
+
+func TestSMCRouteForwarder(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "smcroute.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	d := &stubSMCRouted{
+		show: "ROUTE (S,G)              INBOUND   PACKETS  BYTES  OUTBOUND\n" +
+			"(*, 239.1.1.1)           eth1      0        0      eth0\n" +
+			"(10.0.0.1, 232.1.1.1)    gre0      12       1500   eth0\n" +
+			"(*, 239.2.2.2)           eth1      0        0      eth0 eth9\n" +
+			"(*, 239.3.3.3)           eth9      0        0      eth0\n",
+		errors: map[string]string{"a eth1 239.9.9.9 eth0": "Invalid argument"},
+	}
+	go d.serve(t, l)
+
+	s := &smcrouteForwarder{
+		path:    path,
+		timeout: time.Second,
+		names:   map[side]string{IN: "eth0", OUT: "eth1", ALTOUT: "gre0"},
+		sides:   map[string]side{"eth0": IN, "eth1": OUT, "gre0": ALTOUT},
+		outside: map[side]bool{OUT: true, ALTOUT: true},
+	}
+
+	// only the routes from the outside to just the inside are adopted
+	routes, err := s.existing()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []route{
+		{group: netip.MustParseAddr("239.1.1.1"), in: OUT, outs: []side{IN}},
+		{source: netip.MustParseAddr("10.0.0.1"), group: netip.MustParseAddr("232.1.1.1"), in: ALTOUT, outs: []side{IN}},
+	}
+	if !slices.EqualFunc(routes, want, route.equal) {
+		t.Errorf("existing:%v want:%v", routes, want)
+	}
+
+	if err := s.addRoute(route{group: netip.MustParseAddr("239.4.4.4"), in: OUT, outs: []side{IN}}); err != nil {
+		t.Error(err)
+	}
+	if err := s.delRoute(routes[1]); err != nil {
+		t.Error(err)
+	}
+	if err := s.addRoute(route{group: netip.MustParseAddr("239.9.9.9"), in: OUT, outs: []side{IN}}); err == nil {
+		t.Error("smcrouted error not returned")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	wantCmds := []string{
+		"S ",
+		"a eth1 239.4.4.4 eth0",
+		"r gre0 10.0.0.1 232.1.1.1",
+		"a eth1 239.9.9.9 eth0",
+	}
+	if !slices.Equal(d.cmds, wantCmds) {
+		t.Errorf("cmds:%q want:%q", d.cmds, wantCmds)
+	}
+}
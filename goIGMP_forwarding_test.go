@@ -0,0 +1,72 @@
+package goIGMP
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestRouteTable(t *testing.T) {
+
+	now := time.Now()
+
+	g1 := netip.MustParseAddr("239.0.0.1")
+	g2 := netip.MustParseAddr("232.0.0.2")
+	s1 := netip.MustParseAddr("10.0.0.1")
+	s2 := netip.MustParseAddr("10.0.0.2")
+
+	items := []MembershipItem{{Group: g1}, {Group: g2, Sources: []netip.Addr{s1}}}
+	outs := []side{IN}
+
+	// the kernel needs (S,G) routes, so nothing is wanted until the sources are seen
+	k := newRouteTable(false)
+	if want := k.desired(items, OUT, outs, now); len(want) != 0 {
+		t.Fatalf("want:%v before any upcall", want)
+	}
+
+	k.sawSource(routeKey{source: s2, group: g1}, now)
+	k.sawSource(routeKey{source: s2, group: g2}, now) // not in the INCLUDE list
+	want := k.desired(items, OUT, outs, now)
+	add, del := k.diff(want, now)
+	if len(add) != 1 || add[0].source != s2 || add[0].group != g1 || len(del) != 0 {
+		t.Fatalf("add:%v del:%v", add, del)
+	}
+	for _, rt := range add {
+		k.installed[rt.key()] = rt
+	}
+
+	// an installed route is kept past the seen TTL, as there are no more upcalls
+	later := now.Add(2 * sourceSeenTTLCst)
+	if add, del := k.diff(k.desired(items, OUT, outs, later), later); len(add) != 0 || len(del) != 0 {
+		t.Errorf("installed route changed, add:%v del:%v", add, del)
+	}
+
+	// the outside interface change moves the route
+	add, del = k.diff(k.desired(items, ALTOUT, outs, later), later)
+	if len(add) != 1 || add[0].in != ALTOUT || len(del) != 1 || del[0].in != OUT {
+		t.Errorf("move add:%v del:%v", add, del)
+	}
+
+	// the membership is left
+	if _, del := k.diff(k.desired(nil, OUT, outs, later), later); len(del) != 1 {
+		t.Errorf("leave del:%v", del)
+	}
+
+	// a backend that can do (*,G) doesn't need the sources
+	a := newRouteTable(true)
+	add, _ = a.diff(a.desired(items, OUT, outs, now), now)
+	if len(add) != 2 || add[0].group != g2 || add[0].source != s1 || add[1].group != g1 || add[1].source.IsValid() {
+		t.Errorf("anySource add:%v", add)
+	}
+
+	// adopted routes are kept during the startup grace
+	adopted := route{source: s1, group: netip.MustParseAddr("239.9.9.9"), in: OUT, outs: outs}
+	g := newRouteTable(true)
+	g.adopt([]route{adopted}, now.Add(time.Minute))
+	if _, del := g.diff(g.desired(nil, OUT, outs, now), now); len(del) != 0 {
+		t.Errorf("adopted route deleted during the grace:%v", del)
+	}
+	if _, del := g.diff(g.desired(nil, OUT, outs, now), now.Add(2*time.Minute)); len(del) != 1 {
+		t.Errorf("adopted route not deleted after the grace:%v", del)
+	}
+}
@@ -0,0 +1,170 @@
+package goIGMP
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+// go test -fuzz FuzzDecodeIGMP
+// go test -fuzz FuzzUnicastActionFor
+// go test -fuzz FuzzHandleIGMP
+
+const (
+	testIntNameCst = "lo"
+)
+
+var (
+	testReporterOnce sync.Once
+	testReporterR    *IGMPReporter
+)
+
+// testReporter returns a reporter that does not open any sockets.
+// The prometheus metrics register globally, so there can only be one per test binary.
+func testReporter(t testing.TB) *IGMPReporter {
+	t.Helper()
+
+	if _, err := net.InterfaceByName(testIntNameCst); err != nil {
+		t.Skipf("interface %s is required: %v", testIntNameCst, err)
+	}
+
+	testReporterOnce.Do(func() {
+		testReporterR = NewIGMPReporter(Config{
+			InIntName:                    testIntNameCst,
+			OutIntName:                   testIntNameCst,
+			UnicastDst:                   "127.0.0.1",
+			ProxyOutToIn:                 true,
+			QueryNotify:                  true,
+			MembershipReportsFromNetwork: true,
+			ChannelSize:                  1,
+			Testing: TestingOptions{
+				ReplayOnly: true,
+			},
+		})
+	})
+
+	return testReporterR
+}
+
+// seedFromPcaps adds every payload and pcap captured IGMP message to the fuzz corpus
+func seedFromPcaps(f *testing.F) {
+	f.Helper()
+
+	payloads, err := filepath.Glob(filepath.Join(pcapsDirCst, "*.payload"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, p := range payloads {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+
+	pcaps, err := filepath.Glob(filepath.Join(pcapsDirCst, "*.pcap"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, p := range pcaps {
+		packets, err := ReadIGMPPcap(p)
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, c := range packets {
+			f.Add(c.Payload)
+		}
+	}
+
+	// short and truncated messages
+	f.Add([]byte{})
+	f.Add([]byte{byte(layers.IGMPMembershipReportV2)})
+	f.Add([]byte{byte(layers.IGMPMembershipReportV3), 0, 0, 0, 0, 0, 0xff, 0xff})
+	f.Add([]byte{byte(layers.IGMPMembershipQuery), 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff})
+}
+
+func FuzzDecodeIGMP(f *testing.F) {
+
+	seedFromPcaps(f)
+
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		msg, err := DecodeIGMP(payload)
+		if err != nil {
+			return
+		}
+
+		if msg.Type != layers.IGMPType(payload[0]) {
+			t.Errorf("msg.Type:%s != payload[0]:%d", msg.Type, payload[0])
+		}
+
+		if msg.Type == layers.IGMPMembershipReportV3 && len(msg.MembershipItems) != len(msg.GroupRecords) {
+			t.Errorf("len(MembershipItems):%d != len(GroupRecords):%d", len(msg.MembershipItems), len(msg.GroupRecords))
+		}
+
+		for _, mi := range msg.MembershipItems {
+			if !mi.Group.IsMulticast() {
+				t.Errorf("group:%s is not multicast", mi.Group)
+			}
+		}
+	})
+}
+
+func FuzzUnicastActionFor(f *testing.F) {
+
+	seedFromPcaps(f)
+
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		msg, err := DecodeIGMP(payload)
+		if err != nil {
+			return
+		}
+
+		switch unicastActionFor(msg) {
+		case unicastToGroup:
+			if !msg.Group.IsMulticast() {
+				t.Errorf("unicastToGroup group:%s is not multicast", msg.Group)
+			}
+		case unicastToIGMPHosts:
+			if msg.Type != layers.IGMPMembershipReportV3 {
+				t.Errorf("unicastToIGMPHosts for type:%s", msg.Type)
+			}
+		case unicastToAllRouters:
+			if msg.Type != layers.IGMPLeaveGroup {
+				t.Errorf("unicastToAllRouters for type:%s", msg.Type)
+			}
+		case unicastQuery:
+			if msg.Type != layers.IGMPMembershipQuery {
+				t.Errorf("unicastQuery for type:%s", msg.Type)
+			}
+		}
+	})
+}
+
+func FuzzHandleIGMP(f *testing.F) {
+
+	seedFromPcaps(f)
+
+	r := testReporter(f)
+	src := net.ParseIP("192.0.2.1").To4()
+
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		for _, g := range r.multicastGroups {
+			r.handleIGMP(OUT, g, 0, src, r.mapIPtoNetAddr[g], payload)
+			r.handleIGMP(IN, g, 0, src, r.mapIPtoNetAddr[g], payload)
+		}
+
+		// keep the channels drained, so the non-blocking sends are exercised both ways
+		select {
+		case <-r.QueryNotifyCh:
+		default:
+		}
+		select {
+		case <-r.MembershipReportFromNetworkCh:
+		default:
+		}
+	})
+}
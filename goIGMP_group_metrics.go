@@ -0,0 +1,202 @@
+package goIGMP
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+// GroupMetrics is the per-group Prometheus metrics, labelled by interface and group
+// They are off by default, as every group is a label value.  The cardinality is bounded
+// by the Groups allowlist, and by MaxGroups per interface.  Groups are removed from the metrics when
+// they have had no members for the RFC 3376 Group Membership Interval.
+type GroupMetrics struct {
+	Enabled   bool
+	Groups    []netip.Prefix // only these groups.  Empty for any group, up to MaxGroups
+	MaxGroups int            // per interface.  0 for the default
+}
+
+const (
+	groupMetricsMaxGroupsCst = 1000
+)
+
+var groupMetricsLabels = []string{"interface", "group"}
+
+type groupKey struct {
+	iface string
+	group netip.Addr
+}
+
+// groupStat is the state for a single interface and group
+type groupStat struct {
+	members    map[netip.Addr]time.Time // reporting hosts, and when they last reported
+	reports    uint64
+	leaves     uint64
+	lastReport time.Time
+}
+
+// groupMetrics holds the per-group stats of each interface, and the overflow counts
+// It is a prometheus.Collector, so the series of the expired groups go away
+type groupMetrics struct {
+	mu        sync.Mutex
+	allow     []netip.Prefix
+	maxGroups int
+	ttl       time.Duration
+	stats     map[groupKey]*groupStat
+	perIface  map[string]int
+	overflow  map[string]uint64
+
+	membersDesc  *prometheus.Desc
+	reportsDesc  *prometheus.Desc
+	leavesDesc   *prometheus.Desc
+	ageDesc      *prometheus.Desc
+	overflowDesc *prometheus.Desc
+}
+
+func newGroupMetrics(conf GroupMetrics) *groupMetrics {
+	g := &groupMetrics{
+		allow:     conf.Groups,
+		maxGroups: conf.MaxGroups,
+		ttl:       groupMembershipIntervalCst,
+		stats:     make(map[groupKey]*groupStat),
+		perIface:  make(map[string]int),
+		overflow:  make(map[string]uint64),
+
+		membersDesc:  prometheus.NewDesc("groups_members", "goIGMP hosts reporting the group", groupMetricsLabels, nil),
+		reportsDesc:  prometheus.NewDesc("groups_reports_total", "goIGMP reports for the group", groupMetricsLabels, nil),
+		leavesDesc:   prometheus.NewDesc("groups_leaves_total", "goIGMP leaves for the group", groupMetricsLabels, nil),
+		ageDesc:      prometheus.NewDesc("groups_last_report_age_seconds", "goIGMP seconds since the last report for the group", groupMetricsLabels, nil),
+		overflowDesc: prometheus.NewDesc("groups_overflow_total", "goIGMP reports and leaves not in the group metrics, because of MaxGroups", []string{"interface"}, nil),
+	}
+	if g.maxGroups <= 0 {
+		g.maxGroups = groupMetricsMaxGroupsCst
+	}
+	return g
+}
+
+// observe counts the reports and leaves in the message
+func (g *groupMetrics) observe(iface string, src netip.Addr, msg IGMPMessage, now time.Time) {
+
+	if g == nil {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	switch msg.Type {
+
+	case layers.IGMPMembershipReportV1, layers.IGMPMembershipReportV2:
+		for _, mi := range msg.MembershipItems {
+			g.recordLocked(iface, src, mi.Group, false, false, now)
+		}
+
+	case layers.IGMPLeaveGroup:
+		for _, mi := range msg.MembershipItems {
+			g.recordLocked(iface, src, mi.Group, true, true, now)
+		}
+
+	case layers.IGMPMembershipReportV3:
+		for i, gr := range msg.GroupRecords {
+			mi := msg.MembershipItems[i]
+			// a BLOCK only leaves some of the sources, so the host is still a member
+			leave := isLeaveRecord(gr.Type, mi)
+			g.recordLocked(iface, src, mi.Group, leave, leave && len(mi.Sources) == 0, now)
+		}
+	}
+}
+
+func (g *groupMetrics) recordLocked(iface string, src netip.Addr, group netip.Addr, leave bool, gone bool, now time.Time) {
+
+	if !prefixesContain(g.allow, group) {
+		return
+	}
+
+	k := groupKey{iface: iface, group: group}
+	s, ok := g.stats[k]
+	if !ok {
+		if leave {
+			// nothing to leave
+			return
+		}
+		if g.perIface[iface] >= g.maxGroups {
+			g.overflow[iface]++
+			return
+		}
+		s = &groupStat{members: make(map[netip.Addr]time.Time)}
+		g.stats[k] = s
+		g.perIface[iface]++
+	}
+
+	if leave {
+		s.leaves++
+		if gone {
+			delete(s.members, src)
+		}
+		return
+	}
+
+	s.reports++
+	s.lastReport = now
+	s.members[src] = now
+}
+
+// expireLocked removes the members that stopped reporting, and the groups with no members
+func (g *groupMetrics) expireLocked(now time.Time) {
+	for k, s := range g.stats {
+		for m, seen := range s.members {
+			if now.Sub(seen) > g.ttl {
+				delete(s.members, m)
+			}
+		}
+		if len(s.members) == 0 && now.Sub(s.lastReport) > g.ttl {
+			delete(g.stats, k)
+			g.perIface[k.iface]--
+		}
+	}
+}
+
+func (g *groupMetrics) Describe(ch chan<- *prometheus.Desc) {
+	ch <- g.membersDesc
+	ch <- g.reportsDesc
+	ch <- g.leavesDesc
+	ch <- g.ageDesc
+	ch <- g.overflowDesc
+}
+
+func (g *groupMetrics) Collect(ch chan<- prometheus.Metric) {
+	g.collect(ch, time.Now())
+}
+
+func (g *groupMetrics) collect(ch chan<- prometheus.Metric, now time.Time) {
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.expireLocked(now)
+
+	for k, s := range g.stats {
+		group := k.group.String()
+		ch <- prometheus.MustNewConstMetric(g.membersDesc, prometheus.GaugeValue, float64(len(s.members)), k.iface, group)
+		ch <- prometheus.MustNewConstMetric(g.reportsDesc, prometheus.CounterValue, float64(s.reports), k.iface, group)
+		ch <- prometheus.MustNewConstMetric(g.leavesDesc, prometheus.CounterValue, float64(s.leaves), k.iface, group)
+		if !s.lastReport.IsZero() {
+			ch <- prometheus.MustNewConstMetric(g.ageDesc, prometheus.GaugeValue, now.Sub(s.lastReport).Seconds(), k.iface, group)
+		}
+	}
+
+	for iface, n := range g.overflow {
+		ch <- prometheus.MustNewConstMetric(g.overflowDesc, prometheus.CounterValue, float64(n), iface)
+	}
+}
+
+// countGroups feeds the reports and leaves to the per-group metrics
+func (r IGMPReporter) countGroups(interf side, src netip.Addr, msg IGMPMessage) {
+	if r.groupStats == nil {
+		return
+	}
+	r.groupStats.observe(r.IntName[interf], src, msg, time.Now())
+}
@@ -0,0 +1,109 @@
+package goIGMP
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+// gatherGroupMetrics returns the metric values keyed by the name and label values
+func gatherGroupMetrics(t *testing.T, g *groupMetrics) map[string]float64 {
+	t.Helper()
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(g)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]float64)
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			key := mf.GetName()
+			for _, l := range m.GetLabel() {
+				key += " " + l.GetValue()
+			}
+			v := m.GetCounter().GetValue()
+			if m.GetGauge() != nil {
+				v = m.GetGauge().GetValue()
+			}
+			got[key] = v
+		}
+	}
+	return got
+}
+
+func TestGroupMetrics(t *testing.T) {
+
+	now := time.Now()
+	g := newGroupMetrics(GroupMetrics{Enabled: true, Groups: []netip.Prefix{netip.MustParsePrefix("239.0.0.0/8")}, MaxGroups: 2})
+
+	g1 := netip.MustParseAddr("239.1.1.1")
+	g2 := netip.MustParseAddr("239.2.2.2")
+	h1 := netip.MustParseAddr("192.0.2.1")
+	h2 := netip.MustParseAddr("192.0.2.2")
+
+	v2 := func(t layers.IGMPType, group netip.Addr) IGMPMessage {
+		return IGMPMessage{Type: t, MembershipItems: []MembershipItem{{Group: group}}}
+	}
+
+	g.observe("eth0", h1, v2(layers.IGMPMembershipReportV2, g1), now)
+	g.observe("eth0", h2, v2(layers.IGMPMembershipReportV2, g1), now)
+	g.observe("eth0", h1, v2(layers.IGMPLeaveGroup, g1), now)
+
+	// IGMPv3 join and TO_IN{} leave
+	v3 := IGMPMessage{
+		Type:            layers.IGMPMembershipReportV3,
+		GroupRecords:    []layers.IGMPv3GroupRecord{{Type: layers.IGMPIsEx}},
+		MembershipItems: []MembershipItem{{Group: g2}},
+	}
+	g.observe("eth0", h1, v3, now)
+	v3.GroupRecords[0].Type = layers.IGMPToIn
+	g.observe("eth0", h1, v3, now)
+
+	// not in the allowlist, then over MaxGroups
+	g.observe("eth0", h1, v2(layers.IGMPMembershipReportV2, netip.MustParseAddr("224.1.1.1")), now)
+	g.observe("eth0", h1, v2(layers.IGMPMembershipReportV2, netip.MustParseAddr("239.3.3.3")), now)
+	// a different interface has its own cap
+	g.observe("eth1", h1, v2(layers.IGMPMembershipReportV2, g1), now)
+
+	got := gatherGroupMetrics(t, g)
+	want := map[string]float64{
+		"groups_members 239.1.1.1 eth0":       1,
+		"groups_reports_total 239.1.1.1 eth0": 2,
+		"groups_leaves_total 239.1.1.1 eth0":  1,
+		"groups_members 239.2.2.2 eth0":       0,
+		"groups_reports_total 239.2.2.2 eth0": 1,
+		"groups_leaves_total 239.2.2.2 eth0":  1,
+		"groups_members 239.1.1.1 eth1":       1,
+		"groups_overflow_total eth0":          1,
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s got:%v want:%v", k, got[k], v)
+		}
+	}
+	if _, ok := got["groups_members 224.1.1.1 eth0"]; ok {
+		t.Error("224.1.1.1 is not in the allowlist")
+	}
+	if _, ok := got["groups_last_report_age_seconds 239.1.1.1 eth0"]; !ok {
+		t.Error("missing groups_last_report_age_seconds")
+	}
+
+	// the groups expire, which frees the cap
+	g.mu.Lock()
+	g.expireLocked(now.Add(groupMembershipIntervalCst + time.Second))
+	n := len(g.stats)
+	g.mu.Unlock()
+	if n != 0 {
+		t.Errorf("stats:%d after expiry", n)
+	}
+	g.observe("eth0", h1, v2(layers.IGMPMembershipReportV2, netip.MustParseAddr("239.3.3.3")), now)
+	if got := gatherGroupMetrics(t, g); got["groups_members 239.3.3.3 eth0"] != 1 {
+		t.Errorf("239.3.3.3 members:%v want:1", got["groups_members 239.3.3.3 eth0"])
+	}
+}
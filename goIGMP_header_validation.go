@@ -0,0 +1,231 @@
+package goIGMP
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+
+	"github.com/randomizedcoder/gopacket/layers"
+	"golang.org/x/net/ipv4"
+)
+
+// HeaderValidation is the RFC 3376 section 9 checks on the IGMP received by recvIGMP
+// Config.HeaderValidation is keyed by interface name, and the interfaces not listed are not checked
+type HeaderValidation struct {
+	TTL         bool // require TTL 1
+	RouterAlert bool // require the router alert IP option on IGMPv3
+	Checksum    bool // verify the IGMP checksum
+	LocalSubnet bool // reports must come from a subnet of the interface, or 0.0.0.0
+}
+
+// StrictHeaderValidation turns on all the checks
+var StrictHeaderValidation = HeaderValidation{TTL: true, RouterAlert: true, Checksum: true, LocalSubnet: true}
+
+const (
+	ipv4OptionRouterAlertCst = 148 // RFC 2113
+	ipv4OptionEndCst         = 0
+	ipv4OptionNopCst         = 1
+	igmpv3QueryMinBytesCst   = 12
+)
+
+var (
+	ErrHeaderTTL         = errors.New("igmp ttl is not 1")
+	ErrHeaderRouterAlert = errors.New("igmpv3 without the router alert option")
+	ErrHeaderChecksum    = errors.New("igmp bad checksum")
+	ErrHeaderSubnet      = errors.New("igmp report source is not on the local subnet")
+)
+
+var headerLabels = map[error]string{
+	ErrHeaderTTL:         "ttl",
+	ErrHeaderRouterAlert: "routerAlert",
+	ErrHeaderChecksum:    "checksum",
+	ErrHeaderSubnet:      "subnet",
+}
+
+func (v HeaderValidation) active() bool {
+	return v.TTL || v.RouterAlert || v.Checksum || v.LocalSubnet
+}
+
+// igmpHeader is the part of the IPv4 header that is validated
+type igmpHeader struct {
+	ttl         int
+	routerAlert bool
+}
+
+func igmpHeaderOf(h *ipv4.Header) igmpHeader {
+	return igmpHeader{ttl: h.TTL, routerAlert: hasRouterAlert(h.Options)}
+}
+
+// hasRouterAlert walks the IPv4 options looking for the router alert
+func hasRouterAlert(options []byte) bool {
+	for i := 0; i < len(options); {
+		switch options[i] {
+		case ipv4OptionEndCst:
+			return false
+		case ipv4OptionNopCst:
+			i++
+			continue
+		case ipv4OptionRouterAlertCst:
+			return true
+		}
+		if i+1 >= len(options) || options[i+1] < 2 {
+			return false
+		}
+		i += int(options[i+1])
+	}
+	return false
+}
+
+// igmpChecksumOK is true when the internet checksum over the IGMP message is correct
+func igmpChecksumOK(payload []byte) bool {
+	var sum uint32
+	for i := 0; i+1 < len(payload); i += 2 {
+		sum += uint32(payload[i])<<8 | uint32(payload[i+1])
+	}
+	if len(payload)%2 == 1 {
+		sum += uint32(payload[len(payload)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return sum == 0xffff
+}
+
+// isIGMPv3 is true for IGMPv3 reports and queries.  IGMPv3 queries are at least 12 bytes
+func isIGMPv3(payload []byte) bool {
+	if len(payload) == 0 {
+		return false
+	}
+	switch layers.IGMPType(payload[0]) {
+	case layers.IGMPMembershipReportV3:
+		return true
+	case layers.IGMPMembershipQuery:
+		return len(payload) >= igmpv3QueryMinBytesCst
+	}
+	return false
+}
+
+func isIGMPReport(payload []byte) bool {
+	if len(payload) == 0 {
+		return false
+	}
+	switch layers.IGMPType(payload[0]) {
+	case layers.IGMPMembershipReportV1, layers.IGMPMembershipReportV2, layers.IGMPMembershipReportV3:
+		return true
+	}
+	return false
+}
+
+// validateIGMPHeader returns the first check the packet fails, or nil
+func validateIGMPHeader(v HeaderValidation, h igmpHeader, src netip.Addr, subnets []netip.Prefix, payload []byte) error {
+
+	if v.TTL && h.ttl != igmpTTLCst {
+		return ErrHeaderTTL
+	}
+
+	if v.RouterAlert && !h.routerAlert && isIGMPv3(payload) {
+		return ErrHeaderRouterAlert
+	}
+
+	if v.Checksum && !igmpChecksumOK(payload) {
+		return ErrHeaderChecksum
+	}
+
+	// RFC 3376 4.2.13 allows 0.0.0.0, for a host that doesn't have an address yet
+	if v.LocalSubnet && isIGMPReport(payload) && !src.IsUnspecified() && !prefixesContain(subnets, src) {
+		return ErrHeaderSubnet
+	}
+
+	return nil
+}
+
+// validHeader applies Config.HeaderValidation for the interface, counting the rejects by reason
+func (r IGMPReporter) validHeader(interf side, g destIP, src net.IP, h igmpHeader, payload []byte) bool {
+
+	v, ok := r.validation[interf]
+	if !ok {
+		return true
+	}
+
+	err := validateIGMPHeader(v, h, netIPToAddr(src), r.subnets[interf], payload)
+	if err == nil {
+		return true
+	}
+
+	if r.debugOn() {
+		r.log.Debug("recvIGMP invalid header. Ignoring", "iface", interf, "group", r.mapIPtoNetAddr[g], "src", src, "ttl", h.ttl, "routerAlert", h.routerAlert, "err", err)
+	}
+	r.pCrecvIGMP.WithLabelValues("header", interf.String(), r.mapIPtoNetAddr[g].String(), headerLabels[err]).Inc()
+	r.notifyDrop(interf, DropHeader, src, err)
+
+	return false
+}
+
+// headerValidationDefaults resolves Config.HeaderValidation to the interface sides, and finds the subnets
+func (r IGMPReporter) headerValidationDefaults() {
+
+	for name := range r.conf.HeaderValidation {
+		found := false
+		for _, n := range r.IntName {
+			found = found || n == name
+		}
+		if !found {
+			log.Fatal("NewIGMPReporter() HeaderValidation unknown interface:", name)
+		}
+	}
+
+	for _, i := range r.Interfaces {
+		v, ok := r.conf.HeaderValidation[r.IntName[i]]
+		if !ok || !v.active() {
+			continue
+		}
+		r.validation[i] = v
+
+		subnets, err := interfaceSubnets(r.NetIF[i])
+		if err != nil {
+			log.Fatal(fmt.Sprintf("NewIGMPReporter() HeaderValidation(%s) err:", r.IntName[i]), err)
+		}
+		r.subnets[i] = subnets
+	}
+}
+
+// interfaceSubnets are the IPv4 subnets on the interface
+func interfaceSubnets(netIF *net.Interface) (subnets []netip.Prefix, err error) {
+
+	addrs, err := netIF.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range addrs {
+		n, ok := a.(*net.IPNet)
+		if !ok || n.IP.To4() == nil {
+			continue
+		}
+		addr, _ := netip.AddrFromSlice(n.IP.To4())
+		ones, _ := n.Mask.Size()
+		if ones > net.IPv4len*8 {
+			ones -= (net.IPv6len - net.IPv4len) * 8
+		}
+		subnets = append(subnets, netip.PrefixFrom(addr, ones).Masked())
+	}
+
+	return subnets, nil
+}
+
+// openRecvRawConn wraps the receive socket, so recvIGMP can read the IP header
+func (r IGMPReporter) openRecvRawConn(interf side, c net.PacketConn) *ipv4.RawConn {
+
+	raw, err := ipv4.NewRawConn(c)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("openRecvRawConn(%s) NewRawConn err:", interf), err)
+	}
+
+	if err := raw.SetControlMessage(ipv4.FlagSrc|ipv4.FlagDst|ipv4.FlagInterface, true); err != nil {
+		log.Fatal(fmt.Sprintf("openRecvRawConn(%s) SetControlMessage err:", interf), err)
+	}
+
+	return raw
+}
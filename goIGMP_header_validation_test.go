@@ -0,0 +1,102 @@
+package goIGMP
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+)
+
+func TestHasRouterAlert(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []byte
+		want    bool
+	}{
+		{"none", nil, false},
+		{"router alert", []byte{148, 4, 0, 0}, true},
+		{"nop then router alert", []byte{1, 148, 4, 0, 0}, true},
+		{"end", []byte{0, 148, 4, 0}, false},
+		{"other option", []byte{7, 3, 4, 0}, false},
+		{"bad length", []byte{7, 0, 148, 4}, false},
+	}
+	for _, tt := range tests {
+		if got := hasRouterAlert(tt.options); got != tt.want {
+			t.Errorf("%s got:%t want:%t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateIGMPHeader(t *testing.T) {
+
+	v2, err := reportPayload(MembershipItem{Group: netip.MustParseAddr("239.1.1.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v3, err := reportPayload(MembershipItem{Group: netip.MustParseAddr("232.1.1.1"), Sources: []netip.Addr{netip.MustParseAddr("10.0.0.1")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !igmpChecksumOK(v2) || !igmpChecksumOK(v3) {
+		t.Fatalf("serialized checksums v2:%t v3:%t", igmpChecksumOK(v2), igmpChecksumOK(v3))
+	}
+	corrupt := append([]byte{}, v2...)
+	corrupt[2] ^= 0xff
+
+	subnets := []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}
+	local := netip.MustParseAddr("192.0.2.9")
+	good := igmpHeader{ttl: 1, routerAlert: true}
+
+	tests := []struct {
+		name    string
+		v       HeaderValidation
+		h       igmpHeader
+		src     netip.Addr
+		payload []byte
+		want    error
+	}{
+		{"ok", StrictHeaderValidation, good, local, v3, nil},
+		{"ttl", StrictHeaderValidation, igmpHeader{ttl: 2, routerAlert: true}, local, v2, ErrHeaderTTL},
+		{"ttl not checked", HeaderValidation{}, igmpHeader{ttl: 2}, local, v2, nil},
+		{"v3 without router alert", StrictHeaderValidation, igmpHeader{ttl: 1}, local, v3, ErrHeaderRouterAlert},
+		{"v2 without router alert", StrictHeaderValidation, igmpHeader{ttl: 1}, local, v2, nil},
+		{"checksum", StrictHeaderValidation, good, local, corrupt, ErrHeaderChecksum},
+		{"subnet", StrictHeaderValidation, good, netip.MustParseAddr("198.51.100.1"), v2, ErrHeaderSubnet},
+		{"unspecified source", StrictHeaderValidation, good, netip.IPv4Unspecified(), v2, nil},
+	}
+	for _, tt := range tests {
+		if err := validateIGMPHeader(tt.v, tt.h, tt.src, subnets, tt.payload); !errors.Is(err, tt.want) {
+			t.Errorf("%s err:%v want:%v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestValidHeader(t *testing.T) {
+
+	r := *testReporter(t)
+	r.validation = map[side]HeaderValidation{OUT: StrictHeaderValidation}
+	r.subnets = map[side][]netip.Prefix{OUT: {netip.MustParsePrefix("127.0.0.0/8")}}
+
+	o := new(recordingObserver)
+	remove := r.AddObserver(o)
+	defer remove()
+
+	v2, _ := reportPayload(MembershipItem{Group: netip.MustParseAddr("239.1.1.1")})
+
+	if !r.validHeader(OUT, IGMPHosts, net.ParseIP("127.0.0.2"), igmpHeader{ttl: 1}, v2) {
+		t.Errorf("valid header rejected")
+	}
+	if r.validHeader(OUT, IGMPHosts, net.ParseIP("127.0.0.2"), igmpHeader{ttl: 64}, v2) {
+		t.Errorf("ttl 64 accepted")
+	}
+	// the inside has no HeaderValidation
+	if !r.validHeader(IN, IGMPHosts, net.ParseIP("127.0.0.2"), igmpHeader{ttl: 64}, v2) {
+		t.Errorf("inside checked")
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.drops[DropHeader] != 1 {
+		t.Errorf("drops[%s]:%d want:1", DropHeader, o.drops[DropHeader])
+	}
+}
@@ -0,0 +1,397 @@
+package goIGMP
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTPAdmin configures the handler returned by IGMPReporter.HTTPHandler
+//
+// GET /status is always served.  The POSTs change the reporter, so they need
+// the "Authorization: Bearer <Token>" header, and are disabled when Token is empty.
+type HTTPAdmin struct {
+	Token  string
+	Events int // recent events kept for /status.  0 for the default
+}
+
+const (
+	httpAdminEventsCst   = 100
+	httpAdminMaxBodyCst  = 64 * 1024
+	httpAdminBearerCst   = "Bearer "
+	httpAdminContentType = "application/json"
+)
+
+// httpAdmin serves the status and admin API
+type httpAdmin struct {
+	r      IGMPReporter
+	conf   HTTPAdmin
+	events *eventLog
+}
+
+// HTTPHandler returns the JSON status and admin API, to mount in your own http.ServeMux
+//
+//	GET  /status   configuration, interfaces, queriers, memberships and recent events
+//	POST /join     {"groups":[{"group":"239.1.1.1","sources":["10.0.0.1"]}]} via MembershipReportToNetworkCh
+//	POST /leave    the same body, via LeaveToNetworkCh
+//	POST /query    {"interface":"eth0"} sends a general query.  Defaults to the inside interface
+//	POST /outside  {"interface":"eth1"} switches the active outside interface
+//
+// The paths are relative, so use http.StripPrefix to mount it under a prefix.
+// The handler registers an observer to keep the recent events.
+func (r IGMPReporter) HTTPHandler(conf HTTPAdmin) http.Handler {
+
+	if conf.Events <= 0 {
+		conf.Events = httpAdminEventsCst
+	}
+
+	a := &httpAdmin{r: r, conf: conf, events: &eventLog{max: conf.Events}}
+	r.AddObserver(a.events)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", a.status)
+	mux.HandleFunc("POST /join", a.authorize("join", a.join))
+	mux.HandleFunc("POST /leave", a.authorize("leave", a.leave))
+	mux.HandleFunc("POST /query", a.authorize("query", a.query))
+	mux.HandleFunc("POST /outside", a.authorize("outside", a.outside))
+
+	return mux
+}
+
+// authorize checks the bearer token in constant time
+func (a *httpAdmin) authorize(action string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		token, ok := strings.CutPrefix(req.Header.Get("Authorization"), httpAdminBearerCst)
+		if a.conf.Token == "" || !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.conf.Token)) != 1 {
+			a.r.pC.WithLabelValues("httpAdmin", action, "unauthorized").Inc()
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		a.r.pC.WithLabelValues("httpAdmin", action, "count").Inc()
+		h(w, req)
+	}
+}
+
+// httpMembership is a MembershipItem in the API
+type httpMembership struct {
+	Group   netip.Addr   `json:"group"`
+	Sources []netip.Addr `json:"sources,omitempty"`
+}
+
+type httpGroupsRequest struct {
+	Groups []httpMembership `json:"groups"`
+}
+
+type httpInterfaceRequest struct {
+	Interface string `json:"interface"`
+}
+
+type httpStatus struct {
+	Config        httpConfigStatus     `json:"config"`
+	Interfaces    []httpInterface      `json:"interfaces"`
+	ActiveOutside string               `json:"activeOutside"`
+	Queriers      []httpQuerier        `json:"queriers"`
+	Memberships   httpMembershipTables `json:"memberships"`
+	Events        []httpEvent          `json:"events"`
+}
+
+// httpConfigStatus is the Config, without the keys, loggers and observers
+type httpConfigStatus struct {
+	InIntName                    string `json:"inIntName"`
+	OutIntName                   string `json:"outIntName"`
+	AltOutIntName                string `json:"altOutIntName,omitempty"`
+	ProxyOutToIn                 bool   `json:"proxyOutToIn"`
+	ProxyInToOut                 bool   `json:"proxyInToOut"`
+	UnicastProxyInToOut          bool   `json:"unicastProxyInToOut"`
+	QueryNotify                  bool   `json:"queryNotify"`
+	MembershipReportsFromNetwork bool   `json:"membershipReportsFromNetwork"`
+	MembershipReportsToNetwork   bool   `json:"membershipReportsToNetwork"`
+	LeaveToNetwork               bool   `json:"leaveToNetwork"`
+	UnicastMembershipReports     bool   `json:"unicastMembershipReports"`
+	OutSelection                 string `json:"outSelection"`
+	Forwarding                   string `json:"forwarding"`
+	MLD                          bool   `json:"mld"`
+	UDPEncapListen               string `json:"udpEncapListen,omitempty"`
+	UDPEncapDst                  string `json:"udpEncapDst,omitempty"`
+	GroupMetrics                 bool   `json:"groupMetrics"`
+	ReplayOnly                   bool   `json:"replayOnly"`
+}
+
+type httpInterface struct {
+	Name   string `json:"name"`
+	Side   string `json:"side"`
+	Index  int    `json:"index"`
+	Addr   string `json:"addr,omitempty"`
+	Addr6  string `json:"addr6,omitempty"`
+	Active bool   `json:"active,omitempty"` // the active outside interface
+}
+
+type httpQuerier struct {
+	Interface string    `json:"interface"`
+	Side      string    `json:"side"`
+	Addr      string    `json:"addr"`
+	Seen      time.Time `json:"seen"`
+}
+
+type httpMembershipTables struct {
+	Joins      []httpMembership `json:"joins"`
+	Downstream []httpMembership `json:"downstream"`
+	Static     []httpMembership `json:"static"`
+}
+
+// httpEvent is an observer event.  The proxy events are not kept, as there is one for every report
+type httpEvent struct {
+	Time      time.Time        `json:"time"`
+	Type      string           `json:"type"`
+	Interface string           `json:"interface"`
+	Side      string           `json:"side"`
+	Src       string           `json:"src,omitempty"`
+	Groups    []httpMembership `json:"groups,omitempty"`
+	Detail    string           `json:"detail,omitempty"`
+}
+
+func (a *httpAdmin) status(w http.ResponseWriter, req *http.Request) {
+
+	a.r.pC.WithLabelValues("httpAdmin", "status", "count").Inc()
+
+	r := a.r
+	active := r.activeOutInterface()
+
+	s := httpStatus{
+		Config: httpConfigStatus{
+			InIntName:                    r.conf.InIntName,
+			OutIntName:                   r.conf.OutIntName,
+			AltOutIntName:                r.conf.AltOutIntName,
+			ProxyOutToIn:                 r.conf.ProxyOutToIn,
+			ProxyInToOut:                 r.conf.ProxyInToOut,
+			UnicastProxyInToOut:          r.conf.UnicastProxyInToOut,
+			QueryNotify:                  r.conf.QueryNotify,
+			MembershipReportsFromNetwork: r.conf.MembershipReportsFromNetwork,
+			MembershipReportsToNetwork:   r.conf.MembershipReportsToNetwork,
+			LeaveToNetwork:               r.conf.LeaveToNetwork,
+			UnicastMembershipReports:     r.conf.UnicastMembershipReports,
+			OutSelection:                 r.conf.OutSelection.Mode.String(),
+			Forwarding:                   r.conf.Forwarding.Mode.String(),
+			MLD:                          r.conf.MLD,
+			UDPEncapListen:               r.conf.UDPEncap.Listen,
+			UDPEncapDst:                  r.conf.UDPEncap.Dst,
+			GroupMetrics:                 r.conf.GroupMetrics.Enabled,
+			ReplayOnly:                   r.conf.Testing.ReplayOnly,
+		},
+		ActiveOutside: r.IntName[active],
+		Memberships:   httpMembershipTablesOf(r.MembershipTables()),
+		Events:        a.events.list(),
+	}
+
+	for _, q := range r.Queriers() {
+		s.Queriers = append(s.Queriers, httpQuerier{Interface: q.Interface, Side: q.Side, Addr: q.Addr.String(), Seen: q.Seen})
+	}
+
+	for _, i := range r.Interfaces {
+		hi := httpInterface{
+			Name:   r.IntName[i],
+			Side:   i.String(),
+			Addr:   addrString(r.NetAddr[i]),
+			Addr6:  addrString(r.NetAddr6[i]),
+			Active: r.OutsideInterfaces[i] && i == active,
+		}
+		if r.NetIF[i] != nil {
+			hi.Index = r.NetIF[i].Index
+		}
+		s.Interfaces = append(s.Interfaces, hi)
+	}
+
+	writeJSON(w, http.StatusOK, s)
+}
+
+func (a *httpAdmin) join(w http.ResponseWriter, req *http.Request) {
+	a.sendGroups(w, req, "join", a.r.Join)
+}
+
+func (a *httpAdmin) leave(w http.ResponseWriter, req *http.Request) {
+	a.sendGroups(w, req, "leave", a.r.Leave)
+}
+
+func (a *httpAdmin) sendGroups(w http.ResponseWriter, req *http.Request, action string, send func([]MembershipItem) error) {
+
+	var body httpGroupsRequest
+	if err := readJSON(w, req, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	items := make([]MembershipItem, 0, len(body.Groups))
+	for _, g := range body.Groups {
+		items = append(items, MembershipItem{Group: g.Group, Sources: g.Sources})
+	}
+
+	if err := send(items); err != nil {
+		a.r.pC.WithLabelValues("httpAdmin", action, "error").Inc()
+		writeError(w, httpStatusOf(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, httpGroupsRequest{Groups: httpMemberships(items)})
+}
+
+func (a *httpAdmin) query(w http.ResponseWriter, req *http.Request) {
+
+	var body httpInterfaceRequest
+	if err := readJSON(w, req, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	interf := IN
+	if body.Interface != "" {
+		var ok bool
+		if interf, ok = a.r.interfaceSide(body.Interface); !ok {
+			writeError(w, http.StatusNotFound, ErrUnknownInterface)
+			return
+		}
+	}
+
+	if err := a.r.sendGeneralQuery(interf); err != nil {
+		writeError(w, http.StatusServiceUnavailable, err)
+		return
+	}
+
+	a.r.log.Info("httpAdmin", "action", "query", "iface", interf)
+
+	writeJSON(w, http.StatusAccepted, httpInterfaceRequest{Interface: a.r.IntName[interf]})
+}
+
+func (a *httpAdmin) outside(w http.ResponseWriter, req *http.Request) {
+
+	var body httpInterfaceRequest
+	if err := readJSON(w, req, &body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if _, err := a.r.SelectOutInterface(body.Interface); err != nil {
+		writeError(w, httpStatusOf(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, httpInterfaceRequest{Interface: a.r.ActiveOutInterface()})
+}
+
+// httpStatusOf maps the control API errors to the HTTP status codes
+func httpStatusOf(err error) int {
+	switch err {
+	case ErrJoinsOff, ErrLeavesOff, ErrNoAltOut:
+		return http.StatusConflict
+	case ErrChannelFull:
+		return http.StatusServiceUnavailable
+	case ErrUnknownInterface:
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+func readJSON(w http.ResponseWriter, req *http.Request, v any) error {
+	d := json.NewDecoder(http.MaxBytesReader(w, req.Body, httpAdminMaxBodyCst))
+	d.DisallowUnknownFields()
+	return d.Decode(v)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", httpAdminContentType)
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+func httpMemberships(items []MembershipItem) []httpMembership {
+	out := make([]httpMembership, 0, len(items))
+	for _, mi := range items {
+		out = append(out, httpMembership{Group: mi.Group, Sources: mi.Sources})
+	}
+	return out
+}
+
+func httpMembershipTablesOf(t MembershipTables) httpMembershipTables {
+	return httpMembershipTables{
+		Joins:      httpMemberships(t.Joins),
+		Downstream: httpMemberships(t.Downstream),
+		Static:     httpMemberships(t.Static),
+	}
+}
+
+func addrString(a netip.Addr) string {
+	if !a.IsValid() {
+		return ""
+	}
+	return a.String()
+}
+
+// eventLog is an Observer keeping the most recent events for /status
+type eventLog struct {
+	NopObserver
+
+	mu     sync.Mutex
+	max    int
+	events []httpEvent
+}
+
+func (l *eventLog) add(ev Event, typ string, src netip.Addr, items []MembershipItem, detail string) {
+	e := httpEvent{Time: ev.Time, Type: typ, Interface: ev.Interface, Side: ev.Side, Src: addrString(src), Detail: detail}
+	if len(items) > 0 {
+		e.Groups = httpMemberships(items)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.events = append(l.events, e)
+	if len(l.events) > l.max {
+		l.events = l.events[len(l.events)-l.max:]
+	}
+}
+
+// list returns a copy of the events, oldest first
+func (l *eventLog) list() []httpEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]httpEvent{}, l.events...)
+}
+
+func (l *eventLog) OnQuery(ev QueryEvent) {
+	var items []MembershipItem
+	if ev.Group.IsValid() {
+		items = []MembershipItem{{Group: ev.Group}}
+	}
+	l.add(ev.Event, "query", ev.Querier, items, "")
+}
+
+func (l *eventLog) OnReport(ev ReportEvent) {
+	l.add(ev.Event, "report", ev.Src, ev.Items, msgTypeLabel(ev.Type))
+}
+
+func (l *eventLog) OnLeave(ev LeaveEvent) {
+	l.add(ev.Event, "leave", ev.Src, ev.Items, "")
+}
+
+func (l *eventLog) OnDrop(ev DropEvent) {
+	detail := string(ev.Reason)
+	if ev.Err != nil {
+		detail += ": " + ev.Err.Error()
+	}
+	l.add(ev.Event, "drop", ev.Src, nil, detail)
+}
+
+func (l *eventLog) OnQuerierChange(ev QuerierChangeEvent) {
+	l.add(ev.Event, "querierChange", ev.New, nil, "old "+addrString(ev.Old))
+}
+
+func (l *eventLog) OnOutInterfaceChange(ev OutInterfaceChangeEvent) {
+	l.add(ev.Event, "outInterfaceChange", netip.Addr{}, nil, ev.Reason+" from "+ev.OldInterface)
+}
@@ -0,0 +1,83 @@
+package goIGMP
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestHTTPHandler(t *testing.T) {
+
+	r := *testReporter(t)
+	r.conf.MembershipReportsToNetwork = true
+
+	h := r.HTTPHandler(HTTPAdmin{Token: "secret"})
+
+	do := func(method string, path string, token string, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	g := netip.MustParseAddr("239.5.5.5")
+	r.notify(func(o Observer) { o.OnLeave(LeaveEvent{Event: r.event(IN), Items: []MembershipItem{{Group: g}}}) })
+
+	w := do(http.MethodGet, "/status", "", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status code:%d", w.Code)
+	}
+	var s httpStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &s); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Interfaces) == 0 || s.Config.InIntName != r.conf.InIntName {
+		t.Errorf("status:%+v", s)
+	}
+	if n := len(s.Events); n == 0 || s.Events[n-1].Type != "leave" || s.Events[n-1].Groups[0].Group != g {
+		t.Errorf("events:%+v", s.Events)
+	}
+
+	join := `{"groups":[{"group":"232.1.1.1","sources":["10.0.0.1"]}]}`
+	tests := []struct {
+		name   string
+		path   string
+		token  string
+		body   string
+		want   int
+		joined bool
+	}{
+		{"no token", "/join", "", join, http.StatusUnauthorized, false},
+		{"wrong token", "/join", "guess", join, http.StatusUnauthorized, false},
+		{"join", "/join", "secret", join, http.StatusAccepted, true},
+		{"unicast group", "/join", "secret", `{"groups":[{"group":"10.1.1.1"}]}`, http.StatusBadRequest, false},
+		{"ipv6 without MLD", "/join", "secret", `{"groups":[{"group":"ff3e::1"}]}`, http.StatusBadRequest, false},
+		{"unknown field", "/join", "secret", `{"group":"232.1.1.1"}`, http.StatusBadRequest, false},
+		{"leave off", "/leave", "secret", join, http.StatusConflict, false},
+		{"query no socket", "/query", "secret", `{}`, http.StatusServiceUnavailable, false},
+		{"query unknown", "/query", "secret", `{"interface":"nope"}`, http.StatusNotFound, false},
+		{"outside no alt", "/outside", "secret", `{"interface":"` + r.IntName[OUT] + `"}`, http.StatusConflict, false},
+	}
+	for _, tt := range tests {
+		if w := do(http.MethodPost, tt.path, tt.token, tt.body); w.Code != tt.want {
+			t.Errorf("%s code:%d want:%d body:%s", tt.name, w.Code, tt.want, w.Body)
+		}
+		select {
+		case items := <-r.MembershipReportToNetworkCh:
+			if !tt.joined || len(items) != 1 || items[0].Group != netip.MustParseAddr("232.1.1.1") {
+				t.Errorf("%s items:%v", tt.name, items)
+			}
+		default:
+			if tt.joined {
+				t.Errorf("%s nothing on MembershipReportToNetworkCh", tt.name)
+			}
+		}
+	}
+}
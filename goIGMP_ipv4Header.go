@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"net/netip"
 
 	"golang.org/x/net/ipv4"
 )
@@ -13,35 +14,87 @@ const (
 	dscpCst              = 0xc0 // DSCP CS6 Network control
 	ttlCst               = 1
 	igmpIPProtocolNumber = 2
+	dscpMaxCst           = 63
 )
 
-func (r IGMPReporter) ipv4Header(payloadLength int, dest destIP) (iph *ipv4.Header) {
+// DSCPBestEffort is IPHeader.DSCP 0, as the zero value is the default CS6
+const DSCPBestEffort = -1
 
-	iph = &ipv4.Header{
-		Version:  ipv4.Version,
-		Len:      ipv4.HeaderLen,
-		TOS:      dscpCst,
-		TotalLen: ipv4.HeaderLen + payloadLength,
-		TTL:      ttlCst,
-		Protocol: igmpIPProtocolNumber,
-		Dst:      r.destinationNetIP(dest),
-		Options:  []byte{0x94, 0x04, 0x0, 0x0}, //router alert: https://tools.ietf.org/html/rfc2113
+// IPHeader is the IPv4 header of the IGMP sent on an interface
+// Config.IPHeaders is keyed by interface name, and the interfaces not listed get the defaults
+type IPHeader struct {
+	DSCP          int        // 0 for the default CS6 (48), or DSCPBestEffort
+	NoRouterAlert bool       // omit the router alert option
+	Src           netip.Addr // invalid lets the kernel choose
+}
+
+var routerAlertOption = []byte{0x94, 0x04, 0x0, 0x0} //router alert: https://tools.ietf.org/html/rfc2113
+
+// tos is the DSCP in the top 6 bits of the TOS byte
+func (h IPHeader) tos() int {
+	switch {
+	case h.DSCP == 0:
+		return dscpCst
+	case h.DSCP == DSCPBestEffort:
+		return 0
 	}
+	return h.DSCP << 2
+}
 
-	return iph
+func (h IPHeader) check() error {
+	if h.DSCP < DSCPBestEffort || h.DSCP > dscpMaxCst {
+		return fmt.Errorf("DSCP:%d must be 0-%d, or DSCPBestEffort", h.DSCP, dscpMaxCst)
+	}
+	if h.Src.IsValid() && !h.Src.Is4() {
+		return fmt.Errorf("Src:%s must be IPv4", h.Src)
+	}
+	return nil
+}
+
+// ipHeadersDefaults resolves Config.IPHeaders to the interface sides
+func (r IGMPReporter) ipHeadersDefaults() {
+
+	for name, h := range r.conf.IPHeaders {
+		found := false
+		for _, i := range r.Interfaces {
+			if r.IntName[i] == name {
+				r.ipHeaders[i] = h
+				found = true
+			}
+		}
+		if !found {
+			log.Fatal("NewIGMPReporter() IPHeaders unknown interface:", name)
+		}
+		if err := h.check(); err != nil {
+			log.Fatal(fmt.Sprintf("NewIGMPReporter() IPHeaders(%s) err:", name), err)
+		}
+	}
 }
 
-func (r IGMPReporter) ipv4HeaderNetIP(payloadLength int, dest net.IP) (iph *ipv4.Header) {
+func (r IGMPReporter) ipv4Header(interf side, payloadLength int, dest destIP) (iph *ipv4.Header) {
+	return r.ipv4HeaderNetIP(interf, payloadLength, r.destinationNetIP(dest))
+}
+
+func (r IGMPReporter) ipv4HeaderNetIP(interf side, payloadLength int, dest net.IP) (iph *ipv4.Header) {
+
+	h := r.ipHeaders[interf]
 
 	iph = &ipv4.Header{
 		Version:  ipv4.Version,
 		Len:      ipv4.HeaderLen,
-		TOS:      dscpCst,
+		TOS:      h.tos(),
 		TotalLen: ipv4.HeaderLen + payloadLength,
 		TTL:      ttlCst,
 		Protocol: igmpIPProtocolNumber,
 		Dst:      dest,
-		Options:  []byte{0x94, 0x04, 0x0, 0x0}, //router alert: https://tools.ietf.org/html/rfc2113
+	}
+
+	if !h.NoRouterAlert {
+		iph.Options = routerAlertOption
+	}
+
+	if h.Src.IsValid() {
+		iph.Src = h.Src.AsSlice()
 	}
 
 	return iph
@@ -51,21 +104,22 @@ func (r IGMPReporter) ipv4HeaderNetIP(payloadLength int, dest net.IP) (iph *ipv4
 // this really a hack to get it to send unicast
 func (r IGMPReporter) destinationNetIP(dest destIP) (netIP net.IP) {
 	if dest == QueryHost {
-		debugLog(r.debugLevel > 10, fmt.Sprintf("destinationNetIP QueryHost r.querierSourceIP:%s", r.querierSourceIP.String()))
+		querier := r.querierAddr()
+		r.log.Debug("destinationNetIP QueryHost", "querier", querier)
 		var err error
-		if !r.querierSourceIP.IsValid() {
-			debugLog(r.debugLevel > 10, "destinationNetIP !r.querierSourceIP.IsValid(), using unicastDst")
+		if !querier.IsValid() {
+			r.log.Debug("destinationNetIP !r.querierSourceIP.IsValid(), using unicastDst", "dst", r.unicastDst)
 			netIP, err = r.addr2NetIP(r.unicastDst)
 			if err != nil {
 				log.Fatal("destinationNetIP err")
 			}
 			return netIP
 		}
-		netIP, err = r.addr2NetIP(r.querierSourceIP)
+		netIP, err = r.addr2NetIP(querier)
 		if err != nil {
 			log.Fatal("destinationNetIP err")
 		}
-		debugLog(r.debugLevel > 10, "destinationNetIP using querierSourceIP.IsUnspecified")
+		r.log.Debug("destinationNetIP using querier", "dst", querier)
 		return netIP
 	}
 
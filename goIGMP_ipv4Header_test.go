@@ -0,0 +1,40 @@
+package goIGMP
+
+import (
+	"bytes"
+	"net"
+	"net/netip"
+	"testing"
+)
+
+func TestIPv4HeaderSettings(t *testing.T) {
+
+	r := *testReporter(t)
+	r.ipHeaders = map[side]IPHeader{
+		OUT: {DSCP: 10, NoRouterAlert: true, Src: netip.MustParseAddr("192.0.2.1")},
+		IN:  {DSCP: DSCPBestEffort},
+	}
+	dst := net.ParseIP("224.0.0.22")
+
+	// ALTOUT has no settings, so it gets the defaults
+	def := r.ipv4HeaderNetIP(ALTOUT, 8, dst)
+	if def.TOS != dscpCst || !bytes.Equal(def.Options, routerAlertOption) || def.Src != nil {
+		t.Errorf("default header:%+v", def)
+	}
+
+	out := r.ipv4HeaderNetIP(OUT, 8, dst)
+	if out.TOS != 10<<2 || out.Options != nil || !out.Src.Equal(net.ParseIP("192.0.2.1")) {
+		t.Errorf("outside header:%+v", out)
+	}
+
+	in := r.ipv4Header(IN, 8, IGMPHosts)
+	if in.TOS != 0 || !bytes.Equal(in.Options, routerAlertOption) || !in.Dst.Equal(dst) {
+		t.Errorf("inside header:%+v", in)
+	}
+
+	for _, h := range []IPHeader{{DSCP: 64}, {DSCP: -2}, {Src: netip.MustParseAddr("2001:db8::1")}} {
+		if h.check() == nil {
+			t.Errorf("%+v passed check", h)
+		}
+	}
+}
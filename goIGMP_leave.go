@@ -15,7 +15,7 @@ func (r IGMPReporter) leaveToNetworkWorker(wg *sync.WaitGroup, ctx context.Conte
 
 	defer wg.Done()
 
-	debugLog(r.debugLevel > 10, "leaveToNetworkWorker() start")
+	r.log.Debug("leaveToNetworkWorker() start")
 
 forLoop:
 	for loops := 0; ; loops++ {
@@ -27,20 +27,24 @@ forLoop:
 		select {
 
 		case groups = <-r.LeaveToNetworkCh:
-			debugLog(r.debugLevel > 10, fmt.Sprintf("leaveToNetworkWorker() loops:%d groups:%v", loops, groups))
+			r.log.Debug("leaveToNetworkWorker()", "loop", loops, "items", groups)
 
 		case <-ctx.Done():
-			debugLog(r.debugLevel > 10, "leaveToNetworkWorker ctx.Done()")
+			r.log.Debug("leaveToNetworkWorker ctx.Done()")
 			break forLoop
 
 		}
 
-		r.sendLeave(OUT, groups)
+		out := r.activeOutInterface()
+
+		r.joins.leave(groups)
+
+		r.sendLeave(out, r.ssmItems(out, "leaveToNetworkWorker", r.static.withoutStatic(groups)))
 
 		r.pH.WithLabelValues("leaveToNetworkWorker", "loop", "complete").Observe(time.Since(startTime).Seconds())
 	}
 
-	debugLog(r.debugLevel > 10, "leaveToNetworkWorker() complete")
+	r.log.Debug("leaveToNetworkWorker() complete")
 }
 
 func (r IGMPReporter) sendLeave(interf side, membershipItems []MembershipItem) {
@@ -51,50 +55,45 @@ func (r IGMPReporter) sendLeave(interf side, membershipItems []MembershipItem) {
 	}()
 	r.pC.WithLabelValues("sendLeave", "start", "count").Inc()
 
-	debugLog(r.debugLevel > 10, fmt.Sprintf("sendLeave(%s)", interf))
-
-	for i, membershipItem := range membershipItems {
+	r.log.Debug("sendLeave()", "iface", interf, "items", len(membershipItems))
 
-		debugLog(r.debugLevel > 10, fmt.Sprintf("sendLeave(%s) i:%d, membershipItem:%v", interf, i, membershipItem))
+	// client mode, the proxy sends the IGMP and MLD
+	if r.udpClient != nil {
+		r.sendUDPEncap("sendLeave", true, membershipItems)
+		return
+	}
 
-		buffer := gopacket.NewSerializeBuffer()
-		options := gopacket.SerializeOptions{
-			ComputeChecksums: true,
-			FixLengths:       true,
-		}
+	membershipItems, mld := splitMLD(membershipItems)
+	if len(mld) > 0 {
+		r.sendMLDDone(interf, mld)
+	}
 
-		g, errN := addr2NetIP(membershipItem.Group)
-		if errN != nil {
-			log.Fatalf("sendLeave(%s) addr2NetIP(%s) err:%v", interf, membershipItem.Group, errN)
-		}
+	for i, membershipItem := range membershipItems {
 
-		igmp := layers.IGMPv1or2{
-			Type:            layers.IGMPLeaveGroup,
-			MaxResponseTime: MaxResponseTimeCst,
-			GroupAddress:    g,
-			Version:         2,
+		if r.debugOn() {
+			r.log.Debug("sendLeave()", "iface", interf, "i", i, "group", membershipItem.Group, "sources", membershipItem.Sources)
 		}
 
-		//err := gopacket.SerializeLayers(buffer, options, r.pbp.ethernetLayer, r.pbp.ipLayer, igmp)
-		err := gopacket.SerializeLayers(buffer, options, &igmp)
-		if err != nil {
-			log.Fatal(fmt.Sprintf("sendLeave(%s) SerializeLayers err:", interf), err)
+		igmpPayload, errP := leavePayload(membershipItem)
+		if errP != nil {
+			r.log.Warn("sendLeave() leavePayload", "iface", interf, "group", membershipItem.Group, "err", errP)
+			r.pC.WithLabelValues("sendLeave", "leavePayload", "error").Inc()
+			continue
 		}
 
-		igmpPayload := buffer.Bytes()
-
 		var dest destIP
 		if r.conf.UnicastMembershipReports {
-			debugLog(r.debugLevel > 10, fmt.Sprintf("sendLeave(%s) UnicastMembershipReports dest = QueryHost", interf))
 			dest = QueryHost
+		} else if len(membershipItem.Sources) > 0 {
+			dest = IGMPHosts
 		} else {
 			dest = allRouters
 		}
 
-		iph := r.ipv4Header(len(igmpPayload), dest)
+		iph := r.ipv4Header(interf, len(igmpPayload), dest)
 
-		if r.debugLevel > 10 {
-			debugLog(r.debugLevel > 10, fmt.Sprintf("sendLeave(%s) iph:%v", interf, iph))
+		if r.debugOn() {
+			r.log.Debug("sendLeave()", "iface", interf, "iph", iph)
 		}
 
 		errSWD := r.conRaw[interf].SetWriteDeadline(time.Now().Add(writeDeadlineCst))
@@ -102,13 +101,51 @@ func (r IGMPReporter) sendLeave(interf side, membershipItems []MembershipItem) {
 			log.Fatal(fmt.Sprintf("sendLeave(%s) SetWriteDeadline errSWD:", interf), errSWD)
 		}
 
+		// the interface may be going away, e.g. leaves on the old outside interface
 		if errW := r.conRaw[interf].WriteTo(iph, igmpPayload, r.ContMsg[interf]); errW != nil {
-			log.Fatal(fmt.Sprintf("sendLeave(%s) WriteTo errW:", interf), errW)
+			r.log.Warn("sendLeave() WriteTo", "iface", interf, "group", membershipItem.Group, "err", errW)
+			r.pC.WithLabelValues("sendLeave", "WriteTo", "error").Inc()
+			continue
 		}
 		r.pC.WithLabelValues("sendLeave", "WriteTo", "count").Inc()
 		r.pC.WithLabelValues("sendLeave", "WriteToBytes", "count").Add(float64(len(igmpPayload)))
 
-		debugLog(r.debugLevel > 10, fmt.Sprintf("sendLeave(%s) WriteTo success! len(igmpPayload):%d", interf, len(igmpPayload)))
+		if r.debugOn() {
+			r.log.Debug("sendLeave() WriteTo success!", "iface", interf, "group", membershipItem.Group, "len", len(igmpPayload))
+		}
+	}
+
+}
+
+// leavePayload is an IGMPv2 leave for (*,G), or an IGMPv3 BLOCK_OLD_SOURCES report for (S,G)
+func leavePayload(mi MembershipItem) ([]byte, error) {
+
+	if len(mi.Sources) > 0 {
+		return igmpv3Report([]layers.IGMPv3GroupRecord{membershipItemRecord(layers.IGMPBlock, mi)})
+	}
+
+	g, err := addr2NetIP(mi.Group)
+	if err != nil {
+		return nil, err
+	}
+
+	igmp := layers.IGMPv1or2{
+		Type:            layers.IGMPLeaveGroup,
+		MaxResponseTime: MaxResponseTimeCst,
+		GroupAddress:    g,
+		Version:         2,
+	}
+
+	buffer := gopacket.NewSerializeBuffer()
+	options := gopacket.SerializeOptions{
+		ComputeChecksums: true,
+		FixLengths:       true,
+	}
+
+	//err := gopacket.SerializeLayers(buffer, options, r.pbp.ethernetLayer, r.pbp.ipLayer, igmp)
+	if err := gopacket.SerializeLayers(buffer, options, &igmp); err != nil {
+		return nil, err
 	}
 
+	return buffer.Bytes(), nil
 }
@@ -0,0 +1,151 @@
+package goIGMP
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+// Limits caps the memberships learned from the inside hosts.  Zero is unlimited.
+//
+// The limits apply to the reports received on the inside interface, multicast
+// and unicast.  A report with a join that would exceed a limit is dropped, so
+// it is not proxied, but the existing memberships are kept, and reports that
+// refresh existing groups are always allowed.
+type Limits struct {
+	MaxGroupsPerInterface int
+	MaxGroupsPerHost      int
+	MaxSourcesPerGroup    int
+}
+
+var (
+	errGroupsPerInterface = errors.New("MaxGroupsPerInterface exceeded")
+	errGroupsPerHost      = errors.New("MaxGroupsPerHost exceeded")
+	errSourcesPerGroup    = errors.New("MaxSourcesPerGroup exceeded")
+
+	limitLabels = map[error]string{
+		errGroupsPerInterface: "groupsPerInterface",
+		errGroupsPerHost:      "groupsPerHost",
+		errSourcesPerGroup:    "sourcesPerGroup",
+	}
+)
+
+// active is checked first, so there is no cost without limits
+func (l *Limits) active() bool {
+	return l.MaxGroupsPerInterface > 0 || l.MaxGroupsPerHost > 0 || l.MaxSourcesPerGroup > 0
+}
+
+// limitJoin is a join in a report.  merge is set for ALLOW_NEW_SOURCES,
+// where the sources are added to the existing ones
+type limitJoin struct {
+	item  MembershipItem
+	merge bool
+}
+
+// reportJoins returns the joins in a report, ignoring the leaves
+func reportJoins(msg IGMPMessage) (joins []limitJoin) {
+
+	switch msg.Type {
+
+	case layers.IGMPMembershipReportV1, layers.IGMPMembershipReportV2:
+		for _, mi := range msg.MembershipItems {
+			joins = append(joins, limitJoin{item: mi})
+		}
+
+	case layers.IGMPMembershipReportV3:
+		for i, gr := range msg.GroupRecords {
+			mi := msg.MembershipItems[i]
+			switch gr.Type {
+			case layers.IGMPIsIn, layers.IGMPToIn:
+				// INCLUDE with no sources is a leave
+				if len(mi.Sources) > 0 {
+					joins = append(joins, limitJoin{item: mi})
+				}
+			case layers.IGMPIsEx, layers.IGMPToEx:
+				joins = append(joins, limitJoin{item: MembershipItem{Group: mi.Group}})
+			case layers.IGMPAllow:
+				joins = append(joins, limitJoin{item: mi, merge: true})
+			}
+		}
+	}
+
+	return joins
+}
+
+// groupSet is the memberships Limits.check counts
+type groupSet interface {
+	len() int
+	lookup(g netip.Addr) (MembershipItem, bool)
+}
+
+// check returns an error if the joins exceed the limits
+// iface is the interface memberships, and host the memberships of the reporting host
+func (l *Limits) check(joins []limitJoin, iface groupSet, host groupSet) error {
+
+	nIf, nHost := iface.len(), host.len()
+	seenIf := make(map[netip.Addr]bool)
+	seenHost := make(map[netip.Addr]bool)
+
+	for _, j := range joins {
+
+		g := j.item.Group
+		cur, exists := iface.lookup(g)
+
+		if l.MaxSourcesPerGroup > 0 {
+			n := len(j.item.Sources)
+			if j.merge && exists {
+				n = len(mergeMembershipItems([]MembershipItem{cur}, []MembershipItem{j.item})[0].Sources)
+			}
+			if n > l.MaxSourcesPerGroup {
+				return errSourcesPerGroup
+			}
+		}
+
+		if l.MaxGroupsPerInterface > 0 && !exists && !seenIf[g] {
+			if nIf >= l.MaxGroupsPerInterface {
+				return errGroupsPerInterface
+			}
+			nIf++
+			seenIf[g] = true
+		}
+
+		if l.MaxGroupsPerHost > 0 && !seenHost[g] {
+			if _, ok := host.lookup(g); !ok {
+				if nHost >= l.MaxGroupsPerHost {
+					return errGroupsPerHost
+				}
+				nHost++
+				seenHost[g] = true
+			}
+		}
+	}
+
+	return nil
+}
+
+// admit applies the limits to a report or leave from the inside, and updates the downstream memberships
+// The check and the update are under one lock, so concurrent reports can't exceed the limits
+func (r IGMPReporter) admit(interf side, src net.IP, msg IGMPMessage) error {
+
+	r.downstream.mu.Lock()
+	defer r.downstream.mu.Unlock()
+
+	reporter := netIPToAddr(src)
+	host := r.downstream.hostLocked(reporter, time.Now())
+
+	if r.conf.Limits.active() {
+		if err := r.conf.Limits.check(reportJoins(msg), lockedHosts{r.downstream}, host); err != nil {
+			r.pC.WithLabelValues("limits", limitLabels[err], "drop").Inc()
+			r.notifyDrop(interf, DropLimit, src, err)
+			return err
+		}
+	}
+
+	host.update(msg)
+	r.downstream.hosts[reporter] = host
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package goIGMP
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+func TestLimitsCheck(t *testing.T) {
+
+	g1 := netip.MustParseAddr("239.0.0.1")
+	g2 := netip.MustParseAddr("239.0.0.2")
+	g3 := netip.MustParseAddr("239.0.0.3")
+	s1 := netip.MustParseAddr("10.0.0.1")
+	s2 := netip.MustParseAddr("10.0.0.2")
+	s3 := netip.MustParseAddr("10.0.0.3")
+
+	v2 := func(g netip.Addr) IGMPMessage {
+		return IGMPMessage{Type: layers.IGMPMembershipReportV2, Group: g, MembershipItems: []MembershipItem{{Group: g}}}
+	}
+	v3 := func(rt layers.IGMPv3GroupRecordType, mi ...MembershipItem) IGMPMessage {
+		msg := IGMPMessage{Type: layers.IGMPMembershipReportV3, MembershipItems: mi}
+		for range mi {
+			msg.GroupRecords = append(msg.GroupRecords, layers.IGMPv3GroupRecord{Type: rt})
+		}
+		return msg
+	}
+
+	tests := []struct {
+		name   string
+		limits Limits
+		iface  []IGMPMessage
+		host   []IGMPMessage
+		msg    IGMPMessage
+		err    error
+	}{
+		{"unlimited", Limits{}, nil, nil, v3(layers.IGMPIsEx, MembershipItem{Group: g1}, MembershipItem{Group: g2}), nil},
+		{"interfaceFull", Limits{MaxGroupsPerInterface: 2}, []IGMPMessage{v2(g1), v2(g2)}, nil, v2(g3), errGroupsPerInterface},
+		{"interfaceRefresh", Limits{MaxGroupsPerInterface: 2}, []IGMPMessage{v2(g1), v2(g2)}, nil, v2(g2), nil},
+		{"interfaceOneMessage", Limits{MaxGroupsPerInterface: 1}, nil, nil, v3(layers.IGMPIsEx, MembershipItem{Group: g1}, MembershipItem{Group: g2}), errGroupsPerInterface},
+		{"hostFull", Limits{MaxGroupsPerHost: 1}, []IGMPMessage{v2(g1), v2(g2)}, []IGMPMessage{v2(g1)}, v2(g2), errGroupsPerHost},
+		{"hostRefresh", Limits{MaxGroupsPerHost: 1}, []IGMPMessage{v2(g1)}, []IGMPMessage{v2(g1)}, v2(g1), nil},
+		{"leaveIgnored", Limits{MaxGroupsPerHost: 1}, []IGMPMessage{v2(g1)}, []IGMPMessage{v2(g1)}, v3(layers.IGMPToIn, MembershipItem{Group: g2}), nil},
+		{"sources", Limits{MaxSourcesPerGroup: 2}, nil, nil, v3(layers.IGMPIsIn, MembershipItem{Group: g1, Sources: []netip.Addr{s1, s2, s3}}), errSourcesPerGroup},
+		{"sourcesAllow", Limits{MaxSourcesPerGroup: 2}, []IGMPMessage{v3(layers.IGMPIsIn, MembershipItem{Group: g1, Sources: []netip.Addr{s1, s2}})}, nil,
+			v3(layers.IGMPAllow, MembershipItem{Group: g1, Sources: []netip.Addr{s3}}), errSourcesPerGroup},
+		{"sourcesAllowExisting", Limits{MaxSourcesPerGroup: 2}, []IGMPMessage{v3(layers.IGMPIsIn, MembershipItem{Group: g1, Sources: []netip.Addr{s1, s2}})}, nil,
+			v3(layers.IGMPAllow, MembershipItem{Group: g1, Sources: []netip.Addr{s2}}), nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			iface := newMembershipState(groupMembershipIntervalCst)
+			for _, m := range tc.iface {
+				iface.update(m)
+			}
+			host := newMembershipState(groupMembershipIntervalCst)
+			for _, m := range tc.host {
+				host.update(m)
+			}
+			if err := tc.limits.check(reportJoins(tc.msg), iface, host); err != tc.err {
+				t.Errorf("err:%v, want:%v", err, tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package goIGMP
+
+import (
+	"context"
+	"log/slog"
+	"os"
+)
+
+// LevelTrace is below slog.LevelDebug, and is used for the per loop and per packet
+// logging, which is what the old DebugLevel > 100 used to enable
+const LevelTrace = slog.Level(-8)
+
+// newLogger returns conf.Logger, or if that is nil, a text logger on stderr
+// with the level derived from the legacy DebugLevel
+func newLogger(conf Config) *slog.Logger {
+	if conf.Logger != nil {
+		return conf.Logger
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: levelFromDebugLevel(conf.DebugLevel),
+	}))
+}
+
+// levelFromDebugLevel maps the old DebugLevel thresholds to slog levels
+func levelFromDebugLevel(debugLevel int) slog.Level {
+	switch {
+	case debugLevel > 100:
+		return LevelTrace
+	case debugLevel > 10:
+		return slog.LevelDebug
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// debugOn guards debug logging on the hot paths.  slog arguments are built
+// before slog checks the level, so without the guard the attributes would
+// still be allocated when debug is off.
+func (r IGMPReporter) debugOn() bool {
+	return r.log.Enabled(context.Background(), slog.LevelDebug)
+}
+
+// traceOn guards LevelTrace logging, see debugOn
+func (r IGMPReporter) traceOn() bool {
+	return r.log.Enabled(context.Background(), LevelTrace)
+}
+
+// trace logs at LevelTrace.  Callers on hot paths should check traceOn first.
+func (r IGMPReporter) trace(msg string, args ...any) {
+	r.log.Log(context.Background(), LevelTrace, msg, args...)
+}
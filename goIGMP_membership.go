@@ -2,7 +2,6 @@ package goIGMP
 
 import (
 	"context"
-	"fmt"
 	"net/netip"
 	"sync"
 	"time"
@@ -18,7 +17,7 @@ func (r IGMPReporter) readMembershipReportToNetworkCh(wg *sync.WaitGroup, ctx co
 
 	defer wg.Done()
 
-	debugLog(r.debugLevel > 10, "readMembershipReportFromWebServerCh() start")
+	r.log.Debug("readMembershipReportToNetworkCh() start")
 
 forLoop:
 	for loops := 0; ; loops++ {
@@ -31,27 +30,43 @@ forLoop:
 		select {
 
 		case groups = <-r.MembershipReportToNetworkCh:
-			debugLog(r.debugLevel > 10, fmt.Sprintf("readMembershipReportToNetworkCh() loops:%d groups:%v", loops, groups))
+			r.log.Debug("readMembershipReportToNetworkCh()", "loop", loops, "items", groups)
 
 		case <-ctx.Done():
-			debugLog(r.debugLevel > 10, "readMembershipReportToNetworkCh ctx.Done()")
+			r.log.Debug("readMembershipReportToNetworkCh ctx.Done()")
 			break forLoop
 
 		}
 
-		r.sendMembershipReport(OUT, groups)
+		out := r.activeOutInterface()
+
+		groups = r.ssmItems(out, "readMembershipReportToNetworkCh", groups)
+
+		groups, denied := r.policyFilter(out, netip.Addr{}, groups)
+		if denied > 0 {
+			r.log.Debug("readMembershipReportToNetworkCh() denied by policy", "loop", loops, "denied", denied)
+			r.pC.WithLabelValues("readMembershipReportToNetworkCh", "policy", "deny").Add(float64(denied))
+			r.notifyDrop(out, DropPolicy, nil, nil)
+		}
+		if len(groups) == 0 {
+			continue
+		}
+
+		r.joins.join(groups)
+
+		r.sendMembershipReport(out, groups)
 
 		r.pH.WithLabelValues("readMembershipReportToNetworkCh", "loop", "complete").Observe(time.Since(startTime).Seconds())
 	}
 
-	debugLog(r.debugLevel > 10, "readMembershipReportFromWebServerCh() complete")
+	r.log.Debug("readMembershipReportToNetworkCh() complete")
 }
 
 func (r IGMPReporter) testingReadMembershipReportsFromNetwork(wg *sync.WaitGroup, ctx context.Context) {
 
 	defer wg.Done()
 
-	debugLog(r.debugLevel > 10, "testingReadMembershipReportsFromNetwork()")
+	r.log.Debug("testingReadMembershipReportsFromNetwork()")
 
 forLoop:
 	for loops := 0; ; loops++ {
@@ -62,9 +77,9 @@ forLoop:
 		var groups []MembershipItem
 		select {
 		case groups = <-r.MembershipReportFromNetworkCh:
-			debugLog(r.debugLevel > 10, fmt.Sprintf("testingReadMembershipReportsFromNetwork() loops:%d groups:%v", loops, groups))
+			r.log.Debug("testingReadMembershipReportsFromNetwork()", "loop", loops, "items", groups)
 		case <-ctx.Done():
-			debugLog(r.debugLevel > 10, "testingReadMembershipReportsFromNetwork ctx.Done()")
+			r.log.Debug("testingReadMembershipReportsFromNetwork ctx.Done()")
 			break forLoop
 		}
 
@@ -78,7 +93,7 @@ func (r IGMPReporter) connectQueryToReport(wg *sync.WaitGroup, ctx context.Conte
 
 	defer wg.Done()
 
-	debugLog(r.debugLevel > 10, "connectQueryToReport()")
+	r.log.Debug("connectQueryToReport()")
 
 	var mi []MembershipItem
 
@@ -91,11 +106,11 @@ forLoop:
 		select {
 		case <-r.QueryNotifyCh:
 		case <-ctx.Done():
-			debugLog(r.debugLevel > 10, "connectQueryToReport ctx.Done()")
+			r.log.Debug("connectQueryToReport ctx.Done()")
 			break forLoop
 		}
 
-		debugLog(r.debugLevel > 10, fmt.Sprintf("connectQueryToReport() loops:%d <-r.QueryNotifyCh, calling r.sendMembershipReport(OUT, mi)", loops))
+		r.log.Debug("connectQueryToReport() <-r.QueryNotifyCh, calling r.sendMembershipReport(OUT, mi)", "loop", loops)
 
 		r.sendMembershipReport(OUT, mi)
 
@@ -0,0 +1,265 @@
+package goIGMP
+
+import (
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+const (
+	// RFC 3376 8.4 Group Membership Interval, with the default robustness and query interval
+	groupMembershipIntervalCst = 260 * time.Second
+)
+
+// membershipState is a set of group memberships
+// It is used to announce the memberships when the outside interface changes.
+//
+// The client join set doesn't expire, so ttl is zero.  The downstream state is
+// learned from reports, so groups expire if they are not reported for ttl.
+type membershipState struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	groups map[netip.Addr]MembershipItem
+	seen   map[netip.Addr]time.Time
+}
+
+func newMembershipState(ttl time.Duration) *membershipState {
+	return &membershipState{
+		ttl:    ttl,
+		groups: make(map[netip.Addr]MembershipItem),
+		seen:   make(map[netip.Addr]time.Time),
+	}
+}
+
+// join adds the items, merging the sources of groups already joined
+func (m *membershipState) join(items []MembershipItem) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.joinLocked(items, time.Now())
+}
+
+func (m *membershipState) joinLocked(items []MembershipItem, now time.Time) {
+	for _, mi := range items {
+		m.seen[mi.Group] = now
+		if cur, ok := m.groups[mi.Group]; ok {
+			m.groups[mi.Group] = mergeMembershipItems([]MembershipItem{cur}, []MembershipItem{mi})[0]
+			continue
+		}
+		m.groups[mi.Group] = MembershipItem{Group: mi.Group, Sources: slices.Clone(mi.Sources)}
+	}
+}
+
+// leave removes the groups
+func (m *membershipState) leave(items []MembershipItem) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.leaveLocked(items)
+}
+
+func (m *membershipState) leaveLocked(items []MembershipItem) {
+	for _, mi := range items {
+		delete(m.groups, mi.Group)
+		delete(m.seen, mi.Group)
+	}
+}
+
+// update applies a report or leave received from the downstream hosts
+func (m *membershipState) update(msg IGMPMessage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	switch msg.Type {
+
+	case layers.IGMPMembershipReportV1, layers.IGMPMembershipReportV2:
+		m.joinLocked(msg.MembershipItems, now)
+
+	case layers.IGMPLeaveGroup:
+		m.leaveLocked(msg.MembershipItems)
+
+	case layers.IGMPMembershipReportV3:
+		for i, gr := range msg.GroupRecords {
+			mi := msg.MembershipItems[i]
+			switch gr.Type {
+			case layers.IGMPIsIn, layers.IGMPToIn:
+				// INCLUDE with no sources is a leave
+				m.leaveLocked([]MembershipItem{mi})
+				if len(mi.Sources) > 0 {
+					m.joinLocked([]MembershipItem{mi}, now)
+				}
+			case layers.IGMPIsEx, layers.IGMPToEx:
+				// EXCLUDE is any source multicast
+				m.groups[mi.Group] = MembershipItem{Group: mi.Group}
+				m.seen[mi.Group] = now
+			case layers.IGMPAllow:
+				m.joinLocked([]MembershipItem{mi}, now)
+			case layers.IGMPBlock:
+				m.blockLocked(mi)
+			}
+		}
+	}
+}
+
+// blockLocked removes the sources, and the group when it has no sources left
+func (m *membershipState) blockLocked(mi MembershipItem) {
+	cur, ok := m.groups[mi.Group]
+	if !ok || len(cur.Sources) == 0 {
+		return
+	}
+	cur.Sources = slices.DeleteFunc(cur.Sources, func(s netip.Addr) bool {
+		return slices.Contains(mi.Sources, s)
+	})
+	if len(cur.Sources) == 0 {
+		m.leaveLocked([]MembershipItem{mi})
+		return
+	}
+	m.groups[mi.Group] = cur
+}
+
+// expiredLocked is true if the group has not been reported for ttl
+func (m *membershipState) expiredLocked(g netip.Addr, now time.Time) bool {
+	return m.ttl > 0 && now.Sub(m.seen[g]) > m.ttl
+}
+
+// lookup returns the membership for the group, if it has not expired
+func (m *membershipState) lookup(g netip.Addr) (MembershipItem, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mi, ok := m.groups[g]
+	if !ok || m.expiredLocked(g, time.Now()) {
+		return MembershipItem{}, false
+	}
+	return mi, true
+}
+
+// len is the number of groups that have not expired
+func (m *membershipState) len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	n := 0
+	for g := range m.groups {
+		if !m.expiredLocked(g, now) {
+			n++
+		}
+	}
+	return n
+}
+
+// items returns a copy of the memberships, sorted by group
+func (m *membershipState) items() []MembershipItem {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	items := make([]MembershipItem, 0, len(m.groups))
+	for g, mi := range m.groups {
+		if m.expiredLocked(g, now) {
+			delete(m.groups, g)
+			delete(m.seen, g)
+			continue
+		}
+		items = append(items, MembershipItem{Group: mi.Group, Sources: slices.Clone(mi.Sources)})
+	}
+	slices.SortFunc(items, func(a, b MembershipItem) int {
+		return a.Group.Compare(b.Group)
+	})
+
+	return items
+}
+
+// hostMemberships are the memberships reported by each inside host
+// The downstream memberships are their union, so a group or source is kept until
+// the last host leaves it, or stops reporting it for groupMembershipIntervalCst.
+type hostMemberships struct {
+	mu     sync.Mutex
+	hosts  map[netip.Addr]*membershipState
+	pruned time.Time
+}
+
+func newHostMemberships() *hostMemberships {
+	return &hostMemberships{
+		hosts:  make(map[netip.Addr]*membershipState),
+		pruned: time.Now(),
+	}
+}
+
+// hostLocked returns the memberships of the host, which are empty for a new host
+// Hosts with no memberships are pruned every groupMembershipIntervalCst
+func (h *hostMemberships) hostLocked(host netip.Addr, now time.Time) *membershipState {
+
+	if now.Sub(h.pruned) > groupMembershipIntervalCst {
+		for a, m := range h.hosts {
+			if m.len() == 0 {
+				delete(h.hosts, a)
+			}
+		}
+		h.pruned = now
+	}
+
+	m, ok := h.hosts[host]
+	if !ok {
+		m = newMembershipState(groupMembershipIntervalCst)
+	}
+	return m
+}
+
+// items returns the union of the host memberships, sorted by group
+func (h *hostMemberships) items() []MembershipItem {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.itemsLocked()
+}
+
+func (h *hostMemberships) itemsLocked() []MembershipItem {
+	items := []MembershipItem{}
+	for _, m := range h.hosts {
+		items = mergeMembershipItems(items, m.items())
+	}
+	slices.SortFunc(items, func(a, b MembershipItem) int {
+		return a.Group.Compare(b.Group)
+	})
+	return items
+}
+
+// lockedHosts is the union of the host memberships as a groupSet, for when mu is already held
+type lockedHosts struct {
+	h *hostMemberships
+}
+
+func (l lockedHosts) len() int {
+	return len(l.h.itemsLocked())
+}
+
+func (l lockedHosts) lookup(g netip.Addr) (MembershipItem, bool) {
+	var merged []MembershipItem
+	for _, m := range l.h.hosts {
+		if mi, ok := m.lookup(g); ok {
+			merged = mergeMembershipItems(merged, []MembershipItem{mi})
+		}
+	}
+	if len(merged) == 0 {
+		return MembershipItem{}, false
+	}
+	return merged[0], true
+}
+
+// Memberships returns the groups joined on the outside, which are the groups
+// sent on MembershipReportToNetworkCh, and the groups reported by the downstream hosts
+func (r IGMPReporter) Memberships() []MembershipItem {
+	items := mergeMembershipItems(r.joins.items(), r.downstream.items())
+	slices.SortFunc(items, func(a, b MembershipItem) int {
+		return a.Group.Compare(b.Group)
+	})
+	return items
+}
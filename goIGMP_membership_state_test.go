@@ -0,0 +1,168 @@
+package goIGMP
+
+import (
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+func TestMembershipState(t *testing.T) {
+
+	g1 := netip.MustParseAddr("232.0.0.1")
+	g2 := netip.MustParseAddr("232.0.0.2")
+	s1 := netip.MustParseAddr("172.17.200.10")
+	s2 := netip.MustParseAddr("172.17.200.11")
+
+	m := newMembershipState(0)
+	m.join([]MembershipItem{{Group: g2}, {Group: g1, Sources: []netip.Addr{s1}}})
+	m.join([]MembershipItem{{Group: g1, Sources: []netip.Addr{s2}}})
+
+	want := []MembershipItem{
+		{Group: g1, Sources: []netip.Addr{s1, s2}},
+		{Group: g2, Sources: nil},
+	}
+	if got := m.items(); !reflect.DeepEqual(got, want) {
+		t.Errorf("items:%v want:%v", got, want)
+	}
+
+	m.leave([]MembershipItem{{Group: g2}})
+
+	want = want[:1]
+	if got := m.items(); !reflect.DeepEqual(got, want) {
+		t.Errorf("items after leave:%v want:%v", got, want)
+	}
+}
+
+func TestMembershipStateUpdatePayloads(t *testing.T) {
+
+	m := newMembershipState(groupMembershipIntervalCst)
+
+	for _, f := range []string{
+		"ipmpv3_membership_report_s_172.17.200.10_g_232_0_0_1.payload", // ALLOW 232.0.0.1
+		"igmpv2_membership_report_g232.0.0.2.payload",                  // report 232.0.0.2
+		"igmpv2_membership_report_g232.0.0.9.payload",                  // report 232.0.0.9
+		"igmpv2_leave_group_232.0.0.1.payload",                         // leave 232.0.0.1
+	} {
+		payload, err := os.ReadFile(filepath.Join(pcapsDirCst, f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg, err := DecodeIGMP(payload)
+		if err != nil {
+			t.Fatalf("DecodeIGMP(%s) err:%v", f, err)
+		}
+		m.update(msg)
+	}
+
+	want := []MembershipItem{
+		{Group: netip.MustParseAddr("232.0.0.2")},
+		{Group: netip.MustParseAddr("232.0.0.9")},
+	}
+	if got := m.items(); !reflect.DeepEqual(got, want) {
+		t.Errorf("items:%v want:%v", got, want)
+	}
+}
+
+func TestMembershipStateUpdateV3(t *testing.T) {
+
+	g := netip.MustParseAddr("232.0.0.1")
+	s1 := netip.MustParseAddr("172.17.200.10")
+	s2 := netip.MustParseAddr("172.17.200.11")
+
+	v3 := func(rt layers.IGMPv3GroupRecordType, sources ...netip.Addr) IGMPMessage {
+		return IGMPMessage{
+			Type:            layers.IGMPMembershipReportV3,
+			GroupRecords:    []layers.IGMPv3GroupRecord{{Type: rt}},
+			MembershipItems: []MembershipItem{{Group: g, Sources: sources}},
+		}
+	}
+
+	tests := []struct {
+		name string
+		msgs []IGMPMessage
+		want []MembershipItem
+	}{
+		{name: "allow", msgs: []IGMPMessage{v3(layers.IGMPAllow, s1), v3(layers.IGMPAllow, s2)}, want: []MembershipItem{{Group: g, Sources: []netip.Addr{s1, s2}}}},
+		{name: "block", msgs: []IGMPMessage{v3(layers.IGMPAllow, s1, s2), v3(layers.IGMPBlock, s1)}, want: []MembershipItem{{Group: g, Sources: []netip.Addr{s2}}}},
+		{name: "blockAll", msgs: []IGMPMessage{v3(layers.IGMPAllow, s1), v3(layers.IGMPBlock, s1)}, want: []MembershipItem{}},
+		{name: "toInReplaces", msgs: []IGMPMessage{v3(layers.IGMPAllow, s1), v3(layers.IGMPToIn, s2)}, want: []MembershipItem{{Group: g, Sources: []netip.Addr{s2}}}},
+		{name: "toInEmptyIsLeave", msgs: []IGMPMessage{v3(layers.IGMPIsEx), v3(layers.IGMPToIn)}, want: []MembershipItem{}},
+		{name: "exclude", msgs: []IGMPMessage{v3(layers.IGMPAllow, s1), v3(layers.IGMPToEx)}, want: []MembershipItem{{Group: g}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newMembershipState(0)
+			for _, msg := range tc.msgs {
+				m.update(msg)
+			}
+			if got := m.items(); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("items:%v want:%v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMembershipStateExpiry(t *testing.T) {
+
+	m := newMembershipState(time.Minute)
+	m.join([]MembershipItem{{Group: netip.MustParseAddr("232.0.0.1")}})
+
+	m.mu.Lock()
+	for g := range m.seen {
+		m.seen[g] = time.Now().Add(-2 * time.Minute)
+	}
+	m.mu.Unlock()
+
+	if got := m.items(); len(got) != 0 {
+		t.Errorf("items:%v want expired", got)
+	}
+}
+
+func TestHostMemberships(t *testing.T) {
+
+	r := *testReporter(t)
+	r.downstream = newHostMemberships()
+
+	g := netip.MustParseAddr("232.0.0.1")
+	s1 := netip.MustParseAddr("172.17.200.10")
+	s2 := netip.MustParseAddr("172.17.200.11")
+	hostA := net.ParseIP("10.0.0.1")
+	hostB := net.ParseIP("10.0.0.2")
+
+	v2 := func(typ layers.IGMPType) IGMPMessage {
+		return IGMPMessage{Type: typ, Group: g, MembershipItems: []MembershipItem{{Group: g}}}
+	}
+	isIn := IGMPMessage{
+		Type:            layers.IGMPMembershipReportV3,
+		GroupRecords:    []layers.IGMPv3GroupRecord{{Type: layers.IGMPIsIn}},
+		MembershipItems: []MembershipItem{{Group: g, Sources: []netip.Addr{s1, s2}}},
+	}
+
+	steps := []struct {
+		name string
+		host net.IP
+		msg  IGMPMessage
+		want []MembershipItem
+	}{
+		{"A joins", hostA, v2(layers.IGMPMembershipReportV2), []MembershipItem{{Group: g}}},
+		{"B joins (S,G)", hostB, isIn, []MembershipItem{{Group: g}}},
+		{"A leaves", hostA, v2(layers.IGMPLeaveGroup), []MembershipItem{{Group: g, Sources: []netip.Addr{s1, s2}}}},
+		{"A leaves again", hostA, v2(layers.IGMPLeaveGroup), []MembershipItem{{Group: g, Sources: []netip.Addr{s1, s2}}}},
+		{"B leaves", hostB, v2(layers.IGMPLeaveGroup), []MembershipItem{}},
+	}
+	for _, s := range steps {
+		if err := r.admit(IN, s.host, s.msg); err != nil {
+			t.Fatalf("%s err:%v", s.name, err)
+		}
+		if got := r.downstream.items(); !reflect.DeepEqual(got, s.want) {
+			t.Errorf("%s items:%v want:%v", s.name, got, s.want)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package goIGMP
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+// MLD message types, RFC 2710 and RFC 3810
+const (
+	MLDQuery    uint8 = 130
+	MLDReportV1 uint8 = 131
+	MLDDone     uint8 = 132
+	MLDReportV2 uint8 = 143
+)
+
+const (
+	mldv1MessageBytesCst      = 24
+	mldv2QueryMinBytesCst     = 28
+	mldv2ReportHeaderBytesCst = 8
+	mldv2RecordHeaderBytesCst = 20
+	ipv6AddrBytesCst          = 16
+
+	// MLD is link local, so the hop limit must be 1
+	mldHopLimitCst = 1
+)
+
+var (
+	// MLDAllNodes is where queries are sent
+	MLDAllNodes = netip.MustParseAddr("ff02::1")
+	// MLDAllRouters is where MLDv1 done messages are sent
+	MLDAllRouters = netip.MustParseAddr("ff02::2")
+	// MLDv2Routers is where MLDv2 reports are sent
+	MLDv2Routers = netip.MustParseAddr("ff02::16")
+
+	mldGroups = []netip.Addr{MLDAllNodes, MLDAllRouters, MLDv2Routers}
+)
+
+var (
+	ErrMLDTooShort     = errors.New("mld payload too short")
+	ErrMLDUnknownType  = errors.New("mld unknown type")
+	ErrMLDTruncated    = errors.New("mld payload truncated")
+	ErrMLDInvalidGroup = errors.New("mld invalid group address")
+
+	errMLDRecordNotIPv6          = errors.New("MLDv2 group record addresses must be IPv6")
+	errMLDRouterAlertUnsupported = errors.New("the MLD router alert is only supported on linux")
+	errMLDNoLinkLocal            = errors.New("interface has no IPv6 link local address")
+)
+
+// DecodeMLD decodes an MLD payload ( the ICMPv6 message after the IPv6 headers )
+//
+// The MLD message is returned as the IGMP equivalent, so the membership state, policy
+// and limits handle both the same way:
+//   - query is IGMPMembershipQuery
+//   - MLDv1 report is IGMPMembershipReportV2
+//   - MLDv2 report is IGMPMembershipReportV3, and the record types are the same as IGMPv3
+//   - done is IGMPLeaveGroup
+//
+// Version is the MLD version, 1 or 2.
+func DecodeMLD(payload []byte) (msg IGMPMessage, err error) {
+
+	if len(payload) < mldv1MessageBytesCst {
+		return msg, ErrMLDTooShort
+	}
+
+	switch payload[0] {
+
+	case MLDQuery:
+		msg.Type = layers.IGMPMembershipQuery
+		msg.Version = 1
+		msg.Group = mldAddr(payload[8:24])
+		if len(payload) >= mldv2QueryMinBytesCst {
+			msg.Version = 2
+			n := int(binary.BigEndian.Uint16(payload[26:28]))
+			if len(payload) < mldv2QueryMinBytesCst+n*ipv6AddrBytesCst {
+				return msg, ErrMLDTruncated
+			}
+		}
+		if !msg.Group.IsUnspecified() && !msg.Group.IsMulticast() {
+			return msg, fmt.Errorf("%w:%s", ErrMLDInvalidGroup, msg.Group)
+		}
+
+	case MLDReportV1, MLDDone:
+		msg.Type = layers.IGMPMembershipReportV2
+		if payload[0] == MLDDone {
+			msg.Type = layers.IGMPLeaveGroup
+		}
+		msg.Version = 1
+		msg.Group = mldAddr(payload[8:24])
+		if !msg.Group.IsMulticast() {
+			return msg, fmt.Errorf("%w:%s", ErrMLDInvalidGroup, msg.Group)
+		}
+		msg.MembershipItems = []MembershipItem{{Group: msg.Group}}
+
+	case MLDReportV2:
+		msg.Type = layers.IGMPMembershipReportV3
+		msg.Version = 2
+		if msg.GroupRecords, err = mldv2Records(payload); err != nil {
+			return msg, err
+		}
+		if msg.MembershipItems, err = groupRecordsToMembershipItems(msg.GroupRecords); err != nil {
+			return msg, err
+		}
+		// groupRecordsToMembershipItems unmaps, so an IPv4 mapped group would become an IGMP group
+		for _, mi := range msg.MembershipItems {
+			if mi.Group.Is4() {
+				return msg, fmt.Errorf("%w:%s", ErrMLDInvalidGroup, mi.Group)
+			}
+		}
+
+	default:
+		return msg, fmt.Errorf("%w:%d", ErrMLDUnknownType, payload[0])
+	}
+
+	return msg, nil
+}
+
+// mldv2Records decodes the RFC 3810 5.2 multicast address records
+func mldv2Records(payload []byte) (records []layers.IGMPv3GroupRecord, err error) {
+
+	n := int(binary.BigEndian.Uint16(payload[6:8]))
+	o := mldv2ReportHeaderBytesCst
+
+	for i := 0; i < n; i++ {
+		if len(payload) < o+mldv2RecordHeaderBytesCst {
+			return nil, ErrMLDTruncated
+		}
+		aux := int(payload[o+1]) * 4
+		nsrc := int(binary.BigEndian.Uint16(payload[o+2 : o+4]))
+		end := o + mldv2RecordHeaderBytesCst + nsrc*ipv6AddrBytesCst + aux
+		if len(payload) < end {
+			return nil, ErrMLDTruncated
+		}
+
+		gr := layers.IGMPv3GroupRecord{
+			Type:             layers.IGMPv3GroupRecordType(payload[o]),
+			AuxDataLen:       payload[o+1],
+			NumberOfSources:  uint16(nsrc),
+			MulticastAddress: payload[o+4 : o+20],
+		}
+		s := o + mldv2RecordHeaderBytesCst
+		for j := 0; j < nsrc; j++ {
+			gr.SourceAddresses = append(gr.SourceAddresses, payload[s:s+ipv6AddrBytesCst])
+			s += ipv6AddrBytesCst
+		}
+		records = append(records, gr)
+		o = end
+	}
+
+	return records, nil
+}
+
+func mldAddr(b []byte) netip.Addr {
+	return netip.AddrFrom16([ipv6AddrBytesCst]byte(b))
+}
+
+// mldv1Message serializes an MLDv1 report or done
+// The checksum is left zero, as the kernel computes the ICMPv6 checksum
+func mldv1Message(t uint8, group netip.Addr) ([]byte, error) {
+
+	if !group.Is6() {
+		return nil, errMLDRecordNotIPv6
+	}
+
+	b := make([]byte, mldv1MessageBytesCst)
+	b[0] = t
+	g := group.As16()
+	copy(b[8:24], g[:])
+
+	return b, nil
+}
+
+// mldv2Report serializes an MLDv2 report, RFC 3810 5.2
+// The checksum is left zero, as the kernel computes the ICMPv6 checksum
+func mldv2Report(records []layers.IGMPv3GroupRecord) ([]byte, error) {
+
+	size := mldv2ReportHeaderBytesCst
+	for _, gr := range records {
+		size += mldv2RecordHeaderBytesCst + ipv6AddrBytesCst*len(gr.SourceAddresses)
+	}
+
+	b := make([]byte, size)
+	b[0] = MLDReportV2
+	binary.BigEndian.PutUint16(b[6:8], uint16(len(records)))
+
+	o := mldv2ReportHeaderBytesCst
+	for _, gr := range records {
+		if len(gr.MulticastAddress) != ipv6AddrBytesCst || gr.MulticastAddress.To4() != nil {
+			return nil, errMLDRecordNotIPv6
+		}
+		b[o] = byte(gr.Type)
+		binary.BigEndian.PutUint16(b[o+2:o+4], uint16(len(gr.SourceAddresses)))
+		copy(b[o+4:o+20], gr.MulticastAddress)
+		o += mldv2RecordHeaderBytesCst
+		for _, s := range gr.SourceAddresses {
+			if len(s) != ipv6AddrBytesCst || s.To4() != nil {
+				return nil, errMLDRecordNotIPv6
+			}
+			copy(b[o:o+ipv6AddrBytesCst], s)
+			o += ipv6AddrBytesCst
+		}
+	}
+
+	return b, nil
+}
+
+// mldReportPayload is an MLDv1 report for (*,G), or an MLDv2 MODE_IS_INCLUDE report for (S,G)
+// Like reportPayload, the v1 report goes to the group, and the v2 report to ff02::16
+func mldReportPayload(mi MembershipItem) (payload []byte, dst netip.Addr, err error) {
+	if len(mi.Sources) > 0 {
+		payload, err = mldv2Report([]layers.IGMPv3GroupRecord{membershipItemRecord(layers.IGMPIsIn, mi)})
+		return payload, MLDv2Routers, err
+	}
+	payload, err = mldv1Message(MLDReportV1, mi.Group)
+	return payload, mi.Group, err
+}
+
+// mldDonePayload is an MLDv1 done for (*,G) to ff02::2, or an MLDv2 BLOCK_OLD_SOURCES report for (S,G)
+func mldDonePayload(mi MembershipItem) (payload []byte, dst netip.Addr, err error) {
+	if len(mi.Sources) > 0 {
+		payload, err = mldv2Report([]layers.IGMPv3GroupRecord{membershipItemRecord(layers.IGMPBlock, mi)})
+		return payload, MLDv2Routers, err
+	}
+	payload, err = mldv1Message(MLDDone, mi.Group)
+	return payload, MLDAllRouters, err
+}
+
+// splitMLD splits the membership items into the IPv4 groups for IGMP, and the IPv6 groups for MLD
+func splitMLD(items []MembershipItem) (igmp []MembershipItem, mld []MembershipItem) {
+	for _, mi := range items {
+		if mi.Group.Is6() && !mi.Group.Is4In6() {
+			mld = append(mld, mi)
+			continue
+		}
+		igmp = append(igmp, mi)
+	}
+	return igmp, mld
+}
@@ -0,0 +1,198 @@
+package goIGMP
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"time"
+
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	protocolICMPv6 = "ip6:ipv6-icmp"
+)
+
+// openMLDConn opens the ICMPv6 socket for MLD on the interface, used for both receiving and sending:
+// - only the MLD ICMPv6 types are received
+// - control message to recieve dst, hop limit and interface
+// - joins ff02::1, ff02::2 and ff02::16
+// - hop limit 1, with the Hop-by-Hop router alert
+// https://pkg.go.dev/golang.org/x/net/ipv6#hdr-Multicasting
+func (r IGMPReporter) openMLDConn(interf side) (p *ipv6.PacketConn) {
+
+	r.trace("openMLDConn()", "iface", interf)
+
+	c, err := net.ListenPacket(protocolICMPv6, "::")
+	if err != nil {
+		log.Fatal(fmt.Sprintf("openMLDConn(%s) ListenPacket(%s, \"::\") err:", interf, protocolICMPv6), err)
+	}
+
+	p = ipv6.NewPacketConn(c)
+
+	var f ipv6.ICMPFilter
+	f.SetAll(true)
+	f.Accept(ipv6.ICMPTypeMulticastListenerQuery)
+	f.Accept(ipv6.ICMPTypeMulticastListenerReport)
+	f.Accept(ipv6.ICMPTypeMulticastListenerDone)
+	f.Accept(ipv6.ICMPTypeVersion2MulticastListenerReport)
+	if err := p.SetICMPFilter(&f); err != nil {
+		log.Fatal(fmt.Sprintf("openMLDConn(%s) SetICMPFilter err:", interf), err)
+	}
+
+	if err := p.SetControlMessage(ipv6.FlagDst|ipv6.FlagHopLimit|ipv6.FlagInterface, true); err != nil {
+		log.Fatal(fmt.Sprintf("openMLDConn(%s) SetControlMessage err:", interf), err)
+	}
+
+	for _, g := range mldGroups {
+		if err := p.JoinGroup(r.NetIF[interf], &net.IPAddr{IP: g.AsSlice()}); err != nil {
+			log.Fatal(fmt.Sprintf("openMLDConn(%s) JoinGroup(%s) err:", interf, g), err)
+		}
+	}
+	r.log.Debug("openMLDConn() joined", "iface", interf, "groups", mldGroups)
+
+	if err := p.SetMulticastInterface(r.NetIF[interf]); err != nil {
+		log.Fatal(fmt.Sprintf("openMLDConn(%s) SetMulticastInterface err:", interf), err)
+	}
+
+	if err := p.SetMulticastHopLimit(mldHopLimitCst); err != nil {
+		log.Fatal(fmt.Sprintf("openMLDConn(%s) SetMulticastHopLimit err:", interf), err)
+	}
+
+	if r.conf.Testing.MulticastLoopback {
+		if err := p.SetMulticastLoopback(true); err != nil {
+			log.Fatal(fmt.Sprintf("openMLDConn(%s) SetMulticastLoopback err:", interf), err)
+		}
+	}
+
+	// without the router alert MLD still works with most routers, so this isn't fatal
+	if err := mldRouterAlert(c); err != nil {
+		r.log.Warn("openMLDConn() router alert", "iface", interf, "err", err)
+		r.pC.WithLabelValues("openMLDConn", "routerAlert", "error").Inc()
+	}
+
+	return p
+}
+
+// getLinkLocal6 returns the IPv6 link local address of the interface, which MLD must be sent from
+// RFC 3810 5.2.13
+func (r IGMPReporter) getLinkLocal6(interf side) (netip.Addr, error) {
+
+	addrs, err := r.NetIF[interf].Addrs()
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	for _, addr := range addrs {
+		n, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		a, ok := netip.AddrFromSlice(n.IP)
+		if ok && a.Is6() && !a.Is4In6() && a.IsLinkLocalUnicast() {
+			return a, nil
+		}
+	}
+
+	return netip.Addr{}, fmt.Errorf("%w:%s", errMLDNoLinkLocal, r.IntName[interf])
+}
+
+// writeMLD writes the payload from the link local address, returning false on failure
+// The payloads can come from the network, so a write failure must not take the process down
+func (r IGMPReporter) writeMLD(fn string, interf side, dst netip.Addr, payload []byte) bool {
+
+	p := r.mldConn[interf]
+	if p == nil {
+		r.pC.WithLabelValues(fn, "noMLDConn", "error").Inc()
+		r.notifyDrop(interf, DropNoRawConn, nil, nil)
+		return false
+	}
+
+	err := p.SetWriteDeadline(time.Now().Add(writeDeadlineCst))
+	if err != nil {
+		log.Fatal(fmt.Sprintf("%s(%s) SetWriteDeadline err:", fn, interf), err)
+	}
+
+	cm := &ipv6.ControlMessage{
+		HopLimit: mldHopLimitCst,
+		IfIndex:  r.NetIF[interf].Index,
+		Src:      r.NetAddr6[interf].AsSlice(),
+	}
+
+	if _, errW := p.WriteTo(payload, cm, &net.IPAddr{IP: dst.AsSlice(), Zone: r.IntName[interf]}); errW != nil {
+		r.log.Warn(fn+" WriteTo", "iface", interf, "dst", dst, "err", errW)
+		r.pC.WithLabelValues(fn, "WriteTo", "error").Inc()
+		r.notifyDrop(interf, DropWriteError, nil, errW)
+		return false
+	}
+	r.pC.WithLabelValues(fn, "WriteTo", "count").Inc()
+	r.pC.WithLabelValues(fn, "WriteToBytes", "count").Add(float64(len(payload)))
+
+	return true
+}
+
+// proxyMLD sends the MLD payload as is, to the destination it was received on
+// The kernel recomputes the ICMPv6 checksum for the new source address
+func (r IGMPReporter) proxyMLD(interf side, dst netip.Addr, payload []byte) {
+
+	startTime := time.Now()
+	defer func() {
+		r.pH.WithLabelValues("proxyMLD", "start", "complete").Observe(time.Since(startTime).Seconds())
+	}()
+	r.pC.WithLabelValues("proxyMLD", "start", "count").Inc()
+
+	if r.traceOn() {
+		r.trace("proxyMLD", "iface", interf, "dst", dst)
+	}
+
+	if !r.writeMLD("proxyMLD", interf, dst, payload) {
+		return
+	}
+
+	r.notifyProxy(interf, dst.AsSlice(), len(payload))
+
+	if r.debugOn() {
+		r.log.Debug("proxyMLD WriteTo success!", "iface", interf, "dst", dst, "len", len(payload))
+	}
+}
+
+// sendMLDReport is the MLD part of sendMembershipReport
+func (r IGMPReporter) sendMLDReport(interf side, membershipItems []MembershipItem) {
+
+	r.pC.WithLabelValues("sendMLDReport", "start", "count").Inc()
+
+	for _, mi := range membershipItems {
+
+		payload, dst, err := mldReportPayload(mi)
+		if err != nil {
+			r.log.Warn("sendMLDReport() mldReportPayload", "iface", interf, "group", mi.Group, "err", err)
+			r.pC.WithLabelValues("sendMLDReport", "mldReportPayload", "error").Inc()
+			continue
+		}
+
+		if r.writeMLD("sendMLDReport", interf, dst, payload) && r.debugOn() {
+			r.log.Debug("sendMLDReport() WriteTo success!", "iface", interf, "group", mi.Group, "dst", dst, "len", len(payload))
+		}
+	}
+}
+
+// sendMLDDone is the MLD part of sendLeave
+func (r IGMPReporter) sendMLDDone(interf side, membershipItems []MembershipItem) {
+
+	r.pC.WithLabelValues("sendMLDDone", "start", "count").Inc()
+
+	for _, mi := range membershipItems {
+
+		payload, dst, err := mldDonePayload(mi)
+		if err != nil {
+			r.log.Warn("sendMLDDone() mldDonePayload", "iface", interf, "group", mi.Group, "err", err)
+			r.pC.WithLabelValues("sendMLDDone", "mldDonePayload", "error").Inc()
+			continue
+		}
+
+		if r.writeMLD("sendMLDDone", interf, dst, payload) && r.debugOn() {
+			r.log.Debug("sendMLDDone() WriteTo success!", "iface", interf, "group", mi.Group, "dst", dst, "len", len(payload))
+		}
+	}
+}
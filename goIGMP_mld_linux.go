@@ -0,0 +1,40 @@
+//go:build linux
+
+package goIGMP
+
+import (
+	"net"
+	"syscall"
+)
+
+// mldHopByHop is the Hop-by-Hop options header with the MLD router alert, RFC 2711
+// The kernel fills in the next header
+var mldHopByHop = []byte{
+	0, 0, // next header, length in 8 byte units not counting the first
+	0x05, 0x02, 0x00, 0x00, // router alert, value 0 is MLD
+	0x01, 0x00, // PadN
+}
+
+// mldRouterAlert adds the router alert to everything sent on the socket, and asks the kernel
+// for the MLD messages with a router alert, e.g. MLDv1 reports for groups we haven't joined
+func mldRouterAlert(c net.PacketConn) error {
+	sc, ok := c.(syscall.Conn)
+	if !ok {
+		return errMLDRouterAlertUnsupported
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errS error
+	errC := rc.Control(func(fd uintptr) {
+		errS = syscall.SetsockoptString(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_HOPOPTS, string(mldHopByHop))
+		if errS == nil {
+			errS = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_ROUTER_ALERT, 0)
+		}
+	})
+	if errC != nil {
+		return errC
+	}
+	return errS
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package goIGMP
+
+import "net"
+
+// mldRouterAlert needs the linux sticky IPV6_HOPOPTS, see goIGMP_mld_linux.go
+func mldRouterAlert(c net.PacketConn) error {
+	return errMLDRouterAlertUnsupported
+}
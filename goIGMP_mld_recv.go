@@ -0,0 +1,228 @@
+package goIGMP
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+var errMLDHeader = errors.New("mld must have hop limit 1 and a link local source")
+
+// mldRecv is true when the MLD messages on the interface are needed
+func (r IGMPReporter) mldRecv(interf side) bool {
+	if interf == IN {
+		return r.conf.ProxyInToOut
+	}
+	return r.conf.ProxyOutToIn || r.conf.QueryNotify || r.conf.MembershipReportsFromNetwork
+}
+
+func (r IGMPReporter) recvMLD(wg *sync.WaitGroup, ctx context.Context, interf side) {
+
+	defer wg.Done()
+
+	r.log.Debug("recvMLD started", "iface", interf)
+
+forLoop:
+	for loops := 0; ; loops++ {
+
+		select {
+		case <-ctx.Done():
+			r.log.Debug("recvMLD ctx.Done()", "iface", interf, "loop", loops)
+			break forLoop
+		default:
+		}
+
+		loopStartTime := time.Now()
+		r.pC.WithLabelValues("recvMLD", "loops", "counter").Inc()
+
+		if r.traceOn() {
+			r.trace("recvMLD loop", "iface", interf, "loop", loops)
+		}
+
+		err := r.mldConn[interf].SetReadDeadline(time.Now().Add(r.conf.SocketReadDeadLine))
+		if err != nil {
+			log.Fatal(fmt.Sprintf("recvMLD(%s) loops:%d SetReadDeadline err:", interf, loops), err)
+		}
+
+		buf := bytePool.Get().(*[]byte)
+		n, cm, src, err := r.mldConn[interf].ReadFrom(*buf)
+		if err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				r.pC.WithLabelValues("recvMLD", "timeout", "counter").Inc()
+				bytePool.Put(buf)
+				continue
+			}
+			r.pC.WithLabelValues("recvMLD", "ReadFrom", "error").Inc()
+			bytePool.Put(buf)
+			continue
+		}
+		packetStartTime := time.Now()
+		r.pC.WithLabelValues("recvMLD", "n", "counter").Add(float64(n))
+
+		if cm == nil {
+			r.pC.WithLabelValues("recvMLD", "controlMessage", "error").Inc()
+			r.notifyDrop(interf, DropNoControlMessage, nil, nil)
+			bytePool.Put(buf)
+			continue
+		}
+
+		// every socket receives from every interface
+		if r.NetIFIndex[cm.IfIndex] != interf {
+			r.pC.WithLabelValues("recvMLD", "interf", "ignore").Inc()
+			bytePool.Put(buf)
+			continue
+		}
+
+		srcAddr := netIPToAddr(packetConnAddrIP(src))
+		dstAddr := netIPToAddr(cm.Dst)
+
+		if r.traceOn() {
+			r.trace("recvMLD read", "iface", interf, "loop", loops, "n", n, "cm", cm, "src", srcAddr)
+		}
+
+		r.handleMLD(interf, loops, srcAddr, dstAddr, cm.HopLimit, (*buf)[:n])
+
+		bytePool.Put(buf)
+
+		r.pH.WithLabelValues("recvMLD", "sincePacketStartTime", "counter").Observe(time.Since(packetStartTime).Seconds())
+		r.pH.WithLabelValues("recvMLD", "sinceLoopStartTime", "counter").Observe(time.Since(loopStartTime).Seconds())
+	}
+}
+
+// handleMLD is the MLD receive pipeline, which mirrors handleIGMP
+// The querier selection, SSM, static joins and rate limits are IGMP only
+func (r IGMPReporter) handleMLD(interf side, loops int, src netip.Addr, dst netip.Addr, hopLimit int, payload []byte) {
+
+	if r.AltOutExists && r.ignoreOnNonActiveOutOrAltInterface(&interf) {
+		r.notifyDrop(interf, DropNonActiveInterface, src.AsSlice(), nil)
+		return
+	}
+
+	if src == r.NetAddr6[interf] {
+		r.pC.WithLabelValues("recvMLD", "srcSelf", "ignore").Inc()
+		r.notifyDrop(interf, DropSelf, src.AsSlice(), nil)
+		return
+	}
+
+	// RFC 3810 5.1.14 and 5.2.13.  The reports from :: are hosts still doing DAD
+	if hopLimit != mldHopLimitCst || !src.IsLinkLocalUnicast() {
+		if r.debugOn() {
+			r.log.Debug("recvMLD invalid header. Ignoring", "iface", interf, "loop", loops, "src", src, "hopLimit", hopLimit)
+		}
+		r.pC.WithLabelValues("recvMLD", "header", "error").Inc()
+		r.notifyDrop(interf, DropHeader, src.AsSlice(), errMLDHeader)
+		return
+	}
+
+	if !dst.IsMulticast() {
+		r.pC.WithLabelValues("recvMLD", "dst", "ignore").Inc()
+		r.notifyDrop(interf, DropNotOurGroup, src.AsSlice(), nil)
+		return
+	}
+
+	msg, err := DecodeMLD(payload)
+	if err != nil {
+		if r.debugOn() {
+			r.log.Debug("recvMLD DecodeMLD. Ignoring", "iface", interf, "loop", loops, "src", src, "err", err)
+		}
+		r.pC.WithLabelValues("recvMLD", "deserializing", "error").Inc()
+		r.notifyDrop(interf, DropDecode, src.AsSlice(), err)
+		return
+	}
+
+	if r.debugOn() {
+		r.log.Debug("recvMLD", "iface", interf, "loop", loops, "src", src, "dst", dst, "type", msg.Type, "version", msg.Version)
+	}
+	r.pC.WithLabelValues("recvMLD", msgTypeLabel(msg.Type), "count").Inc()
+
+	if r.policyApplies(interf) && !r.policyAllowsMessage(interf, src.AsSlice(), msg) {
+		r.pC.WithLabelValues("recvMLD", "policy", "deny").Inc()
+		r.notifyDrop(interf, DropPolicy, src.AsSlice(), nil)
+		return
+	}
+
+	if interf == IN {
+		if err := r.admit(interf, src.AsSlice(), msg); err != nil {
+			if r.debugOn() {
+				r.log.Debug("recvMLD limit exceeded. Ignoring", "iface", interf, "loop", loops, "src", src, "err", err)
+			}
+			r.pC.WithLabelValues("recvMLD", "limit", "drop").Inc()
+			return
+		}
+	}
+
+	switch msg.Type {
+
+	case layers.IGMPMembershipQuery:
+		if r.observing() {
+			ev := QueryEvent{Event: r.event(interf), Querier: src, Group: msg.Group, Version: msg.Version}
+			if ev.Group.IsUnspecified() {
+				ev.Group = netip.Addr{}
+			}
+			r.notify(func(o Observer) { o.OnQuery(ev) })
+		}
+
+		if r.conf.QueryNotify {
+			res := sendWithPolicy(r.QueryNotifyCh, struct{}{}, r.conf.QueryNotifyPolicy, nil)
+			r.mldChannelSendResult(interf, src, "QueryNotifyCh", res, errQueryNotifyChFull)
+		}
+
+	case layers.IGMPMembershipReportV2, layers.IGMPMembershipReportV3:
+		r.countGroups(interf, src, msg)
+
+		if r.observing() {
+			ev := ReportEvent{Event: r.event(interf), Src: src, Type: msg.Type, Items: msg.MembershipItems}
+			r.notify(func(o Observer) { o.OnReport(ev) })
+		}
+
+		if r.conf.MembershipReportsFromNetwork {
+			res := sendWithPolicy(r.MembershipReportFromNetworkCh, msg.MembershipItems, r.conf.MembershipReportsPolicy, mergeMembershipItems)
+			r.mldChannelSendResult(interf, src, "MembershipReportFromNetworkCh", res, errMembershipReportFromNetworkChFull)
+		}
+
+	case layers.IGMPLeaveGroup:
+		r.countGroups(interf, src, msg)
+
+		if r.observing() {
+			ev := LeaveEvent{Event: r.event(interf), Src: src, Items: msg.MembershipItems}
+			r.notify(func(o Observer) { o.OnLeave(ev) })
+		}
+	}
+
+	if !r.proxyIt(interf) {
+		return
+	}
+
+	if interf == IN && r.static.isStaticLeave(msg) {
+		r.pC.WithLabelValues("recvMLD", "staticLeave", "ignore").Inc()
+		return
+	}
+
+	out, ok := r.IntOutName.Load(interf)
+	if !ok {
+		r.log.Error("recvMLD IntOutName.Load !ok", "iface", interf)
+		r.pC.WithLabelValues("recvMLD", "Load", "error").Inc()
+		return
+	}
+
+	r.pC.WithLabelValues("recvMLD", "proxyIt", "counter").Inc()
+
+	r.proxyMLD(out.(side), dst, payload)
+}
+
+// mldChannelSendResult counts the result of sending to a notification channel
+func (r IGMPReporter) mldChannelSendResult(interf side, src netip.Addr, name string, res sendResult, errFull error) {
+
+	r.pC.WithLabelValues("recvMLD", name, res.String()).Inc()
+
+	if res != sendOK && res != sendCoalesced {
+		r.notifyDrop(interf, DropChannelFull, src.AsSlice(), errFull)
+	}
+}
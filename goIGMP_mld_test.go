@@ -0,0 +1,115 @@
+package goIGMP
+
+import (
+	"errors"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+func TestDecodeMLD(t *testing.T) {
+
+	g := netip.MustParseAddr("ff3e::8000:1")
+	s1 := netip.MustParseAddr("2001:db8::1")
+	s2 := netip.MustParseAddr("2001:db8::2")
+
+	v1, err := mldv1Message(MLDReportV1, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := DecodeMLD(v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != layers.IGMPMembershipReportV2 || msg.Version != 1 || msg.Group != g || len(msg.MembershipItems) != 1 {
+		t.Errorf("v1 report:%+v", msg)
+	}
+
+	done, _ := mldv1Message(MLDDone, g)
+	if msg, err := DecodeMLD(done); err != nil || msg.Type != layers.IGMPLeaveGroup {
+		t.Errorf("done:%+v err:%v", msg, err)
+	}
+
+	mi := MembershipItem{Group: g, Sources: []netip.Addr{s1, s2}}
+	v2, err := mldv2Report([]layers.IGMPv3GroupRecord{membershipItemRecord(layers.IGMPIsIn, mi)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err = DecodeMLD(v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != layers.IGMPMembershipReportV3 || msg.Version != 2 || len(msg.GroupRecords) != 1 || msg.GroupRecords[0].Type != layers.IGMPIsIn {
+		t.Errorf("v2 report:%+v", msg)
+	}
+	if len(msg.MembershipItems) != 1 || msg.MembershipItems[0].Group != g || !slices.Equal(msg.MembershipItems[0].Sources, mi.Sources) {
+		t.Errorf("v2 items:%v", msg.MembershipItems)
+	}
+
+	if _, err := DecodeMLD(v2[:len(v2)-1]); !errors.Is(err, ErrMLDTruncated) {
+		t.Errorf("truncated err:%v", err)
+	}
+
+	// an MLDv2 general query
+	q := make([]byte, mldv2QueryMinBytesCst)
+	q[0] = MLDQuery
+	if msg, err := DecodeMLD(q); err != nil || msg.Type != layers.IGMPMembershipQuery || msg.Version != 2 || !msg.Group.IsUnspecified() {
+		t.Errorf("query:%+v err:%v", msg, err)
+	}
+
+	// an IPv4 mapped group is not an MLD group
+	mapped := netip.MustParseAddr("239.1.1.1").As16()
+	copy(v2[mldv2ReportHeaderBytesCst+4:], mapped[:])
+	if _, err := DecodeMLD(v2); !errors.Is(err, ErrMLDInvalidGroup) {
+		t.Errorf("mapped group err:%v", err)
+	}
+
+	if _, err := mldv1Message(MLDReportV1, netip.MustParseAddr("239.1.1.1")); err == nil {
+		t.Errorf("IPv4 group serialized as MLD")
+	}
+}
+
+func TestSplitMLD(t *testing.T) {
+	items := []MembershipItem{
+		{Group: netip.MustParseAddr("239.1.1.1")},
+		{Group: netip.MustParseAddr("ff3e::1")},
+	}
+	igmp, mld := splitMLD(items)
+	if len(igmp) != 1 || len(mld) != 1 || !igmp[0].Group.Is4() || mld[0].Group.Is4() {
+		t.Errorf("igmp:%v mld:%v", igmp, mld)
+	}
+}
+
+func TestHandleMLD(t *testing.T) {
+
+	r := testReporter(t)
+
+	o := new(recordingObserver)
+	remove := r.AddObserver(o)
+	defer remove()
+
+	g := netip.MustParseAddr("ff3e::8000:2")
+	src := netip.MustParseAddr("fe80::2")
+	report, _ := mldv1Message(MLDReportV1, g)
+
+	r.handleMLD(OUT, 0, src, g, mldHopLimitCst, report)
+
+	// routers must ignore MLD that isn't link local
+	r.handleMLD(OUT, 0, src, g, 64, report)
+	r.handleMLD(OUT, 0, netip.MustParseAddr("2001:db8::2"), g, mldHopLimitCst, report)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.reports != 1 {
+		t.Errorf("reports:%d want:1", o.reports)
+	}
+	if o.drops[DropHeader] != 2 {
+		t.Errorf("drops[%s]:%d want:2", DropHeader, o.drops[DropHeader])
+	}
+	// ProxyOutToIn, but ReplayOnly has no MLD socket
+	if o.drops[DropNoRawConn] != 1 {
+		t.Errorf("drops[%s]:%d want:1", DropNoRawConn, o.drops[DropNoRawConn])
+	}
+}
@@ -0,0 +1,227 @@
+package goIGMP
+
+import (
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+// Observer receives the protocol events from an IGMPReporter
+//
+// Unlike QueryNotifyCh and MembershipReportFromNetworkCh, observers see every event,
+// including the drops.  The callbacks are made synchronously from the receive
+// goroutines, so they must be fast and must not block.
+// Embed NopObserver to only implement the callbacks you need.
+type Observer interface {
+	OnQuery(QueryEvent)
+	OnReport(ReportEvent)
+	OnLeave(LeaveEvent)
+	OnProxy(ProxyEvent)
+	OnDrop(DropEvent)
+	OnQuerierChange(QuerierChangeEvent)
+	OnOutInterfaceChange(OutInterfaceChangeEvent)
+}
+
+// NopObserver implements Observer with callbacks that do nothing
+type NopObserver struct{}
+
+func (NopObserver) OnQuery(QueryEvent)                           {}
+func (NopObserver) OnReport(ReportEvent)                         {}
+func (NopObserver) OnLeave(LeaveEvent)                           {}
+func (NopObserver) OnProxy(ProxyEvent)                           {}
+func (NopObserver) OnDrop(DropEvent)                             {}
+func (NopObserver) OnQuerierChange(QuerierChangeEvent)           {}
+func (NopObserver) OnOutInterfaceChange(OutInterfaceChangeEvent) {}
+
+// Event is the common part of all the observer events
+// Interface is the operating system name, e.g. "eth0", and Side is "inside", "outside" or "altOutside"
+type Event struct {
+	Time      time.Time
+	Interface string
+	Side      string
+}
+
+// QueryEvent is an IGMP membership query received from the network
+type QueryEvent struct {
+	Event
+	Querier netip.Addr
+	Group   netip.Addr // invalid for a general query
+	Version uint8
+}
+
+// ReportEvent is an IGMP membership report received from the network, or via the unicast socket
+type ReportEvent struct {
+	Event
+	Src     netip.Addr
+	Type    layers.IGMPType
+	Items   []MembershipItem
+	Unicast bool
+}
+
+// LeaveEvent is an IGMPv2 leave received from the network, or via the unicast socket
+type LeaveEvent struct {
+	Event
+	Src     netip.Addr
+	Items   []MembershipItem
+	Unicast bool
+}
+
+// ProxyEvent is an IGMP payload written to Interface
+type ProxyEvent struct {
+	Event
+	Dst   netip.Addr
+	Bytes int
+}
+
+// DropEvent is an IGMP payload that was not processed, or a notification that could not be sent
+type DropEvent struct {
+	Event
+	Reason DropReason
+	Src    netip.Addr
+	Err    error
+}
+
+// QuerierChangeEvent is sent when the source of the queries on an interface changes
+// The first query seen on an interface is a change from the invalid netip.Addr
+type QuerierChangeEvent struct {
+	Event
+	Old netip.Addr
+	New netip.Addr
+}
+
+// OutInterfaceChangeEvent is sent when the active outside interface changes
+// Event is the new interface.  Reason is "selector" for OutInterfaceSelectorCh,
+// "failover" or "failback" for OutSelectLink, "querierTimeout" for OutSelectQuerier, and "admin" for SelectOutInterface
+type OutInterfaceChangeEvent struct {
+	Event
+	OldInterface string
+	OldSide      string
+	Reason       string
+}
+
+// DropReason says why an IGMP payload was dropped
+type DropReason string
+
+const (
+	DropNoControlMessage   DropReason = "noControlMessage"
+	DropNotOurInterface    DropReason = "notOurInterface"
+	DropNonActiveInterface DropReason = "nonActiveInterface"
+	DropSelf               DropReason = "self"
+	DropNotOurGroup        DropReason = "notOurGroup"
+	DropDecode             DropReason = "decode"
+	DropUnexpectedType     DropReason = "unexpectedType"
+	DropChannelFull        DropReason = "channelFull"
+	DropNoRawConn          DropReason = "noRawConn"
+	DropWriteError         DropReason = "writeError"
+	DropPolicy             DropReason = "policy"
+	DropSSM                DropReason = "ssm"
+	DropLimit              DropReason = "limit"
+	DropRateLimit          DropReason = "rateLimit"
+	DropHeader             DropReason = "header" // HeaderValidation, or MLD with hop limit > 1
+	DropAuth               DropReason = "auth"   // UDPEncap HMAC or timestamp
+	DropClient             DropReason = "client" // UnicastClients.Allow
+	DropClientGroup        DropReason = "clientGroup"
+)
+
+// observerEntry wraps each observer, so removal is by pointer rather than
+// comparing the Observer interfaces, which panics for uncomparable types
+type observerEntry struct {
+	o Observer
+}
+
+// observers is copy on write, so the receive paths only do an atomic load
+type observers struct {
+	mu   sync.Mutex
+	list atomic.Pointer[[]*observerEntry]
+}
+
+// AddObserver registers an observer, and returns a function to remove it
+// Observers can be added and removed while the IGMPReporter is running
+func (r IGMPReporter) AddObserver(o Observer) (remove func()) {
+
+	e := &observerEntry{o: o}
+
+	r.observers.mu.Lock()
+	defer r.observers.mu.Unlock()
+
+	var list []*observerEntry
+	if l := r.observers.list.Load(); l != nil {
+		list = append(list, *l...)
+	}
+	list = append(list, e)
+	r.observers.list.Store(&list)
+
+	r.pC.WithLabelValues("AddObserver", "add", "count").Inc()
+
+	return func() {
+		r.observers.mu.Lock()
+		defer r.observers.mu.Unlock()
+
+		l := r.observers.list.Load()
+		if l == nil {
+			return
+		}
+		list := make([]*observerEntry, 0, len(*l))
+		for _, x := range *l {
+			if x != e {
+				list = append(list, x)
+			}
+		}
+		r.observers.list.Store(&list)
+
+		r.pC.WithLabelValues("AddObserver", "remove", "count").Inc()
+	}
+}
+
+// observing is checked before building events, so there is no cost without observers
+func (r IGMPReporter) observing() bool {
+	l := r.observers.list.Load()
+	return l != nil && len(*l) > 0
+}
+
+// notify calls f for each registered observer
+func (r IGMPReporter) notify(f func(o Observer)) {
+	l := r.observers.list.Load()
+	if l == nil {
+		return
+	}
+	for _, e := range *l {
+		f(e.o)
+	}
+}
+
+// event fills in the common event fields for the interface
+func (r IGMPReporter) event(interf side) Event {
+	return Event{
+		Time:      time.Now(),
+		Interface: r.IntName[interf],
+		Side:      interf.String(),
+	}
+}
+
+// notifyDrop is the common drop notification
+func (r IGMPReporter) notifyDrop(interf side, reason DropReason, src net.IP, err error) {
+	if !r.observing() {
+		return
+	}
+	ev := DropEvent{
+		Event:  r.event(interf),
+		Reason: reason,
+		Src:    netIPToAddr(src),
+		Err:    err,
+	}
+	r.notify(func(o Observer) { o.OnDrop(ev) })
+}
+
+// netIPToAddr converts a net.IP for the events, returning the invalid netip.Addr on failure
+func netIPToAddr(ip net.IP) netip.Addr {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
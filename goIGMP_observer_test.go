@@ -0,0 +1,146 @@
+package goIGMP
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+type recordingObserver struct {
+	NopObserver
+
+	mu             sync.Mutex
+	queries        int
+	reports        int
+	leaves         int
+	querierChanges int
+	drops          map[DropReason]int
+}
+
+func (o *recordingObserver) OnQuery(QueryEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.queries++
+}
+
+func (o *recordingObserver) OnReport(ReportEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.reports++
+}
+
+func (o *recordingObserver) OnLeave(LeaveEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.leaves++
+}
+
+func (o *recordingObserver) OnQuerierChange(QuerierChangeEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.querierChanges++
+}
+
+func (o *recordingObserver) OnDrop(ev DropEvent) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.drops == nil {
+		o.drops = make(map[DropReason]int)
+	}
+	o.drops[ev.Reason]++
+}
+
+func TestObserverReplay(t *testing.T) {
+
+	r := testReporter(t)
+
+	pcap := filepath.Join(pcapsDirCst, "igmpv2_leaves_2024_03_11.pcap")
+
+	packets, err := ReadIGMPPcap(pcap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var queries, reports, leaves, decoded int
+	for _, p := range packets {
+		if _, ok := r.mapNetAddrtoIP[p.Dst]; !ok {
+			continue
+		}
+		msg, err := DecodeIGMP(p.Payload)
+		if err != nil {
+			continue
+		}
+		decoded++
+		switch msg.Type {
+		case layers.IGMPMembershipQuery:
+			queries++
+		case layers.IGMPMembershipReportV2, layers.IGMPMembershipReportV3:
+			reports++
+		case layers.IGMPLeaveGroup:
+			leaves++
+		}
+	}
+
+	o := new(recordingObserver)
+	remove := r.AddObserver(o)
+
+	if _, err := r.ReplayPcap(context.Background(), pcap); err != nil {
+		t.Fatal(err)
+	}
+
+	remove()
+
+	if o.queries != queries {
+		t.Errorf("queries:%d want:%d", o.queries, queries)
+	}
+	if o.reports != reports {
+		t.Errorf("reports:%d want:%d", o.reports, reports)
+	}
+	if o.leaves != leaves {
+		t.Errorf("leaves:%d want:%d", o.leaves, leaves)
+	}
+	if queries > 0 && o.querierChanges == 0 {
+		t.Errorf("querierChanges:0 with queries:%d", queries)
+	}
+	// ReplayOnly has no raw sockets, so every decoded message is dropped instead of proxied
+	if o.drops[DropNoRawConn] != decoded {
+		t.Errorf("drops[%s]:%d want:%d", DropNoRawConn, o.drops[DropNoRawConn], decoded)
+	}
+
+	// nothing is observed after remove
+	total := o.queries + o.reports + o.leaves
+	if _, err := r.ReplayPcap(context.Background(), pcap); err != nil {
+		t.Fatal(err)
+	}
+	if o.queries+o.reports+o.leaves != total {
+		t.Errorf("events after remove")
+	}
+}
+
+func TestObserverMultiple(t *testing.T) {
+
+	r := testReporter(t)
+
+	a := new(recordingObserver)
+	b := new(recordingObserver)
+	removeA := r.AddObserver(a)
+	removeB := r.AddObserver(b)
+	defer removeB()
+
+	pcap := filepath.Join(pcapsDirCst, "igmp_2024_03_06.pcap")
+
+	if _, err := r.ReplayPcap(context.Background(), pcap); err != nil {
+		t.Fatal(err)
+	}
+	removeA()
+
+	if a.queries+a.reports+a.leaves == 0 {
+		t.Fatal("no events observed")
+	}
+	if a.queries != b.queries || a.reports != b.reports || a.leaves != b.leaves {
+		t.Errorf("observers differ a:%d/%d/%d b:%d/%d/%d", a.queries, a.reports, a.leaves, b.queries, b.reports, b.leaves)
+	}
+}
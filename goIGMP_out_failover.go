@@ -0,0 +1,229 @@
+package goIGMP
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// OutSelectionMode is how the active outside interface is chosen, when there is an AltOutIntName
+type OutSelectionMode int
+
+const (
+	// OutSelectManual is the original behaviour, the application writes to OutInterfaceSelectorCh
+	OutSelectManual OutSelectionMode = iota
+	// OutSelectLink follows the netlink link and address state of the outside interfaces
+	OutSelectLink
+	// OutSelectQuerier follows the arrival of IGMP queries on the outside interfaces
+	OutSelectQuerier
+)
+
+func (m OutSelectionMode) String() string {
+	switch m {
+	case OutSelectManual:
+		return "manual"
+	case OutSelectLink:
+		return "link"
+	case OutSelectQuerier:
+		return "querier"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	holdDownCst = 2 * time.Second
+	holdUpCst   = 30 * time.Second
+
+	minFailoverTickCst = 10 * time.Millisecond
+	maxFailoverTickCst = time.Second
+
+	// reasons the outside interface was changed
+	outReasonSelector = "selector"
+	outReasonFailover = "failover"
+	outReasonFailback = "failback"
+	outReasonQuerier  = "querierTimeout"
+	outReasonAdmin    = "admin"
+)
+
+var errLinkFailoverUnsupported = errors.New("link failover needs netlink, which is only supported on linux")
+
+// OutSelection configures the automatic outside interface selection
+//
+// OutSelectLink: The active interface is failed over when it has been down, or has had no IPv4 address,
+// for HoldDown.  When the Preferred interface has been up for HoldUp, it is failed back to.
+// Writes to OutInterfaceSelectorCh still work, but will be undone by the failback.
+//
+// OutSelectQuerier: The active interface is switched when no query has arrived on it for QueryWindow,
+// while queries are arriving on the other.
+//
+// In all modes, including OutSelectManual, membership reports for the current memberships are
+// sent on the new interface when it changes, unless DisableReannounce is set.  Leaves are sent on
+// the old interface if LeaveOnSwitch is set, and always for OutSelectQuerier.
+// The current memberships are the groups sent on MembershipReportToNetworkCh and the groups
+// reported by the inside hosts, see IGMPReporter.Memberships.
+type OutSelection struct {
+	Mode              OutSelectionMode
+	Preferred         string        // OutIntName or AltOutIntName.  Defaults to OutIntName
+	HoldDown          time.Duration // Defaults to 2s
+	HoldUp            time.Duration // Defaults to 30s
+	QueryWindow       time.Duration // Defaults to 255s, the RFC 3376 Other Querier Present Interval
+	DisableReannounce bool
+	LeaveOnSwitch     bool
+}
+
+// linkEvent is a link or address change on an outside interface
+type linkEvent struct {
+	interf side
+	isAddr bool
+	up     bool       // link events, admin up with carrier
+	addr   netip.Addr // address events
+	add    bool
+}
+
+// linkHealth is the state of one outside interface
+type linkHealth struct {
+	up    bool
+	addrs map[netip.Addr]bool
+	since time.Time // when healthy() last changed
+}
+
+func (h *linkHealth) healthy() bool {
+	return h.up && len(h.addrs) > 0
+}
+
+// failover is the outside interface selection state machine
+// It is kept separate from netlink, so it can be tested
+type failover struct {
+	preferred side
+	holdDown  time.Duration
+	holdUp    time.Duration
+	links     map[side]*linkHealth
+}
+
+func newFailover(preferred side, holdDown time.Duration, holdUp time.Duration, now time.Time) *failover {
+	f := &failover{
+		preferred: preferred,
+		holdDown:  holdDown,
+		holdUp:    holdUp,
+		links:     make(map[side]*linkHealth),
+	}
+	for _, s := range []side{OUT, ALTOUT} {
+		f.links[s] = &linkHealth{addrs: make(map[netip.Addr]bool), since: now}
+	}
+	return f
+}
+
+// apply updates the link state, restarting the hold timer when the health changes
+func (f *failover) apply(ev linkEvent, now time.Time) {
+	h, ok := f.links[ev.interf]
+	if !ok {
+		return
+	}
+	before := h.healthy()
+	if ev.isAddr {
+		if ev.add {
+			h.addrs[ev.addr] = true
+		} else {
+			delete(h.addrs, ev.addr)
+		}
+	} else {
+		h.up = ev.up
+	}
+	if h.healthy() != before {
+		h.since = now
+	}
+}
+
+// selectOut returns the interface that should be active
+func (f *failover) selectOut(active side, now time.Time) (next side, reason string) {
+
+	other := OUT
+	if active == OUT {
+		other = ALTOUT
+	}
+
+	a, o := f.links[active], f.links[other]
+
+	if !a.healthy() && now.Sub(a.since) >= f.holdDown && o.healthy() {
+		return other, outReasonFailover
+	}
+
+	if active != f.preferred && o.healthy() && now.Sub(o.since) >= f.holdUp {
+		return other, outReasonFailback
+	}
+
+	return active, ""
+}
+
+// tick is how often the hold timers are checked
+func (f *failover) tick() time.Duration {
+	t := min(f.holdDown, f.holdUp) / 4
+	return max(minFailoverTickCst, min(t, maxFailoverTickCst))
+}
+
+// outSelectionDefaults fills in the OutSelection defaults, and returns the preferred side
+func (r *IGMPReporter) outSelectionDefaults() (preferred side, err error) {
+
+	s := &r.conf.OutSelection
+
+	if s.HoldDown <= 0 {
+		s.HoldDown = holdDownCst
+	}
+	if s.HoldUp <= 0 {
+		s.HoldUp = holdUpCst
+	}
+	if s.QueryWindow <= 0 {
+		s.QueryWindow = queryWindowCst
+	}
+
+	switch s.Preferred {
+	case "", r.conf.OutIntName:
+		return OUT, nil
+	case r.conf.AltOutIntName:
+		return ALTOUT, nil
+	}
+
+	return OUT, errors.New("OutSelection.Preferred must be OutIntName or AltOutIntName")
+}
+
+// outInterfaceFailover switches the active outside interface, following the link state
+func (r IGMPReporter) outInterfaceFailover(wg *sync.WaitGroup, ctx context.Context) {
+
+	defer wg.Done()
+
+	r.log.Debug("outInterfaceFailover()", "preferred", r.outPreferred, "holdDown", r.conf.OutSelection.HoldDown, "holdUp", r.conf.OutSelection.HoldUp)
+
+	f := newFailover(r.outPreferred, r.conf.OutSelection.HoldDown, r.conf.OutSelection.HoldUp, time.Now())
+
+	events := make(chan linkEvent, r.conf.ChannelSize)
+	if err := r.subscribeLinks(wg, ctx, events); err != nil {
+		r.log.Error("outInterfaceFailover subscribeLinks", "err", err)
+		r.pC.WithLabelValues("outInterfaceFailover", "subscribeLinks", "error").Inc()
+		return
+	}
+
+	ticker := time.NewTicker(f.tick())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.log.Debug("outInterfaceFailover ctx.Done()")
+			return
+		case ev := <-events:
+			r.log.Debug("outInterfaceFailover", "iface", ev.interf, "isAddr", ev.isAddr, "up", ev.up, "addr", ev.addr, "add", ev.add)
+			r.pC.WithLabelValues("outInterfaceFailover", "event", "count").Inc()
+			f.apply(ev, time.Now())
+		case <-ticker.C:
+		}
+
+		active := r.activeOutInterface()
+		if next, reason := f.selectOut(active, time.Now()); next != active {
+			r.pC.WithLabelValues("outInterfaceFailover", reason, "count").Inc()
+			r.setOutInterface(next, reason)
+		}
+	}
+}
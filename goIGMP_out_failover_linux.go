@@ -0,0 +1,115 @@
+//go:build linux
+
+package goIGMP
+
+import (
+	"context"
+	"net"
+	"sync"
+	"syscall"
+
+	"github.com/vishvananda/netlink"
+)
+
+// subscribeLinks sends the netlink link and address changes of the outside interfaces to events
+// The existing state is listed first, so the failover starts with the current state.
+// The reader goroutine is added to wg, and exits on ctx.
+func (r IGMPReporter) subscribeLinks(wg *sync.WaitGroup, ctx context.Context, events chan<- linkEvent) error {
+
+	linkCh := make(chan netlink.LinkUpdate, r.conf.ChannelSize)
+	addrCh := make(chan netlink.AddrUpdate, r.conf.ChannelSize)
+
+	errCallback := func(err error) {
+		r.log.Warn("subscribeLinks netlink", "err", err)
+		r.pC.WithLabelValues("subscribeLinks", "netlink", "error").Inc()
+	}
+
+	if err := netlink.LinkSubscribeWithOptions(linkCh, ctx.Done(), netlink.LinkSubscribeOptions{
+		ErrorCallback: errCallback,
+		ListExisting:  true,
+	}); err != nil {
+		return err
+	}
+
+	if err := netlink.AddrSubscribeWithOptions(addrCh, ctx.Done(), netlink.AddrSubscribeOptions{
+		ErrorCallback: errCallback,
+		ListExisting:  true,
+	}); err != nil {
+		return err
+	}
+
+	// the interface index changes if a tunnel is recreated, so links are matched by name,
+	// and the address updates by the last index seen for the name
+	names := make(map[string]side)
+	index := make(map[int]side)
+	for s := range r.OutsideInterfaces {
+		names[r.IntName[s]] = s
+		index[r.NetIF[s].Index] = s
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			var ev linkEvent
+			select {
+			case <-ctx.Done():
+				return
+
+			case u, ok := <-linkCh:
+				if !ok {
+					return
+				}
+				attrs := u.Attrs()
+				s, ok := names[attrs.Name]
+				if !ok {
+					continue
+				}
+				index[attrs.Index] = s
+				ev = linkEvent{
+					interf: s,
+					up:     linkUp(u),
+				}
+
+			case u, ok := <-addrCh:
+				if !ok {
+					return
+				}
+				s, ok := index[u.LinkIndex]
+				if !ok {
+					continue
+				}
+				ip4 := u.LinkAddress.IP.To4()
+				if ip4 == nil {
+					continue
+				}
+				ev = linkEvent{
+					interf: s,
+					isAddr: true,
+					addr:   netIPToAddr(ip4),
+					add:    u.NewAddr,
+				}
+			}
+
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// linkUp is admin up with carrier.  Tunnels, like GRE, report OperUnknown when they are up.
+func linkUp(u netlink.LinkUpdate) bool {
+	if u.Header.Type == syscall.RTM_DELLINK {
+		return false
+	}
+	attrs := u.Attrs()
+	if attrs.Flags&net.FlagUp == 0 {
+		return false
+	}
+	return attrs.OperState == netlink.OperUp || attrs.OperState == netlink.OperUnknown
+}
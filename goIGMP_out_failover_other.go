@@ -0,0 +1,13 @@
+//go:build !linux
+
+package goIGMP
+
+import (
+	"context"
+	"sync"
+)
+
+// subscribeLinks needs netlink, see goIGMP_out_failover_linux.go
+func (r IGMPReporter) subscribeLinks(wg *sync.WaitGroup, ctx context.Context, events chan<- linkEvent) error {
+	return errLinkFailoverUnsupported
+}
@@ -0,0 +1,128 @@
+package goIGMP
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestFailoverSelectOut(t *testing.T) {
+
+	start := time.Unix(0, 0)
+	addr := netip.MustParseAddr("192.0.2.1")
+	altAddr := netip.MustParseAddr("198.51.100.1")
+
+	holdDown := 2 * time.Second
+	holdUp := 30 * time.Second
+
+	// healthy brings both interfaces up with an address at start
+	healthy := func() *failover {
+		f := newFailover(OUT, holdDown, holdUp, start)
+		f.apply(linkEvent{interf: OUT, up: true}, start)
+		f.apply(linkEvent{interf: OUT, isAddr: true, addr: addr, add: true}, start)
+		f.apply(linkEvent{interf: ALTOUT, up: true}, start)
+		f.apply(linkEvent{interf: ALTOUT, isAddr: true, addr: altAddr, add: true}, start)
+		return f
+	}
+
+	type step struct {
+		at     time.Duration
+		ev     *linkEvent
+		active side
+		want   side
+		reason string
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "stable",
+			steps: []step{
+				{at: time.Minute, active: OUT, want: OUT},
+			},
+		},
+		{
+			name: "carrierLossHysteresis",
+			steps: []step{
+				{at: time.Second, ev: &linkEvent{interf: OUT, up: false}, active: OUT, want: OUT},
+				{at: 2 * time.Second, active: OUT, want: OUT},
+				{at: 3 * time.Second, active: OUT, want: ALTOUT, reason: "failover"},
+			},
+		},
+		{
+			name: "flapWithinHoldDown",
+			steps: []step{
+				{at: time.Second, ev: &linkEvent{interf: OUT, up: false}, active: OUT, want: OUT},
+				{at: 2 * time.Second, ev: &linkEvent{interf: OUT, up: true}, active: OUT, want: OUT},
+				{at: 10 * time.Second, active: OUT, want: OUT},
+			},
+		},
+		{
+			name: "addressLoss",
+			steps: []step{
+				{at: time.Second, ev: &linkEvent{interf: OUT, isAddr: true, addr: addr, add: false}, active: OUT, want: OUT},
+				{at: 3 * time.Second, active: OUT, want: ALTOUT, reason: "failover"},
+			},
+		},
+		{
+			name: "bothDown",
+			steps: []step{
+				{at: time.Second, ev: &linkEvent{interf: ALTOUT, up: false}, active: OUT, want: OUT},
+				{at: time.Second, ev: &linkEvent{interf: OUT, up: false}, active: OUT, want: OUT},
+				{at: time.Minute, active: OUT, want: OUT},
+			},
+		},
+		{
+			name: "failback",
+			steps: []step{
+				{at: time.Second, ev: &linkEvent{interf: OUT, up: false}, active: OUT, want: OUT},
+				{at: 3 * time.Second, active: OUT, want: ALTOUT, reason: "failover"},
+				{at: 4 * time.Second, ev: &linkEvent{interf: OUT, up: true}, active: ALTOUT, want: ALTOUT},
+				{at: 33 * time.Second, active: ALTOUT, want: ALTOUT},
+				{at: 34 * time.Second, active: ALTOUT, want: OUT, reason: "failback"},
+			},
+		},
+		{
+			name: "manualToNonPreferredFailsBack",
+			steps: []step{
+				{at: time.Minute, active: ALTOUT, want: OUT, reason: "failback"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := healthy()
+			for i, s := range tc.steps {
+				now := start.Add(s.at)
+				if s.ev != nil {
+					f.apply(*s.ev, now)
+				}
+				got, reason := f.selectOut(s.active, now)
+				if got != s.want || reason != s.reason {
+					t.Errorf("step:%d selectOut(%s) got:%s reason:%q want:%s reason:%q", i, s.active, got, reason, s.want, s.reason)
+				}
+			}
+		})
+	}
+}
+
+func TestFailoverTick(t *testing.T) {
+	tests := []struct {
+		holdDown time.Duration
+		holdUp   time.Duration
+		want     time.Duration
+	}{
+		{holdDown: 2 * time.Second, holdUp: 30 * time.Second, want: 500 * time.Millisecond},
+		{holdDown: time.Millisecond, holdUp: time.Second, want: minFailoverTickCst},
+		{holdDown: time.Minute, holdUp: time.Hour, want: maxFailoverTickCst},
+	}
+	for _, tc := range tests {
+		f := newFailover(OUT, tc.holdDown, tc.holdUp, time.Now())
+		if got := f.tick(); got != tc.want {
+			t.Errorf("tick(%s,%s) got:%s want:%s", tc.holdDown, tc.holdUp, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package goIGMP
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// RFC 3376 8.5 Other Querier Present Interval, with the default robustness and query interval
+	queryWindowCst = 255 * time.Second
+
+	minQuerierTickCst = 10 * time.Millisecond
+	maxQuerierTickCst = 5 * time.Second
+)
+
+// querierSelectOut returns the interface that should be active, based on query arrival
+// The active interface is only switched away from when it has had no query for window,
+// while the other interface has had one within the window.
+func querierSelectOut(active side, seen map[side]time.Time, now time.Time, window time.Duration) (next side, switchIt bool) {
+
+	other := OUT
+	if active == OUT {
+		other = ALTOUT
+	}
+
+	activeAlive := !seen[active].IsZero() && now.Sub(seen[active]) <= window
+	otherAlive := !seen[other].IsZero() && now.Sub(seen[other]) <= window
+
+	if !activeAlive && otherAlive {
+		return other, true
+	}
+
+	return active, false
+}
+
+// querierSeen returns a copy of the last query time for each interface
+func (r IGMPReporter) querierSeen() map[side]time.Time {
+	r.querier.mu.RLock()
+	defer r.querier.mu.RUnlock()
+
+	seen := make(map[side]time.Time, len(r.querier.seen))
+	for k, v := range r.querier.seen {
+		seen[k] = v
+	}
+	return seen
+}
+
+// outInterfaceQuerier switches the active outside interface when the queries stop arriving on it
+//
+// Link state alone doesn't say whether multicast is flowing, e.g. over a GRE tunnel,
+// but the upstream router sending queries does.
+func (r IGMPReporter) outInterfaceQuerier(wg *sync.WaitGroup, ctx context.Context) {
+
+	defer wg.Done()
+
+	window := r.conf.OutSelection.QueryWindow
+
+	r.log.Debug("outInterfaceQuerier()", "window", window)
+
+	// the interfaces start without a query, so give them a window to hear one
+	start := time.Now()
+	r.querier.mu.Lock()
+	for s := range r.OutsideInterfaces {
+		if r.querier.seen[s].IsZero() {
+			r.querier.seen[s] = start
+		}
+	}
+	r.querier.mu.Unlock()
+
+	ticker := time.NewTicker(max(minQuerierTickCst, min(window/10, maxQuerierTickCst)))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.log.Debug("outInterfaceQuerier ctx.Done()")
+			return
+		case <-ticker.C:
+		}
+
+		r.pC.WithLabelValues("outInterfaceQuerier", "loops", "count").Inc()
+
+		active := r.activeOutInterface()
+		if next, switchIt := querierSelectOut(active, r.querierSeen(), time.Now(), window); switchIt {
+			r.log.Warn("outInterfaceQuerier no query on the active outside interface", "iface", active, "window", window, "next", next)
+			r.pC.WithLabelValues("outInterfaceQuerier", outReasonQuerier, "count").Inc()
+			r.setOutInterface(next, outReasonQuerier)
+		}
+	}
+}
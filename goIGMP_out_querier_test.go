@@ -0,0 +1,36 @@
+package goIGMP
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuerierSelectOut(t *testing.T) {
+
+	now := time.Unix(1000, 0)
+	window := 10 * time.Second
+
+	tests := []struct {
+		name     string
+		active   side
+		seen     map[side]time.Time
+		want     side
+		switchIt bool
+	}{
+		{name: "bothAlive", active: OUT, seen: map[side]time.Time{OUT: now, ALTOUT: now}, want: OUT},
+		{name: "activeSilent", active: OUT, seen: map[side]time.Time{OUT: now.Add(-11 * time.Second), ALTOUT: now}, want: ALTOUT, switchIt: true},
+		{name: "activeAtWindow", active: OUT, seen: map[side]time.Time{OUT: now.Add(-window), ALTOUT: now}, want: OUT},
+		{name: "bothSilent", active: OUT, seen: map[side]time.Time{OUT: now.Add(-time.Minute), ALTOUT: now.Add(-time.Minute)}, want: OUT},
+		{name: "neverSeenOther", active: OUT, seen: map[side]time.Time{OUT: now.Add(-time.Minute)}, want: OUT},
+		{name: "altActiveSilent", active: ALTOUT, seen: map[side]time.Time{OUT: now, ALTOUT: now.Add(-time.Minute)}, want: OUT, switchIt: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, switchIt := querierSelectOut(tc.active, tc.seen, now, window)
+			if got != tc.want || switchIt != tc.switchIt {
+				t.Errorf("querierSelectOut(%s) got:%s,%t want:%s,%t", tc.active, got, switchIt, tc.want, tc.switchIt)
+			}
+		})
+	}
+}
@@ -1,31 +1,106 @@
 package goIGMP
 
 import (
-	"fmt"
+	"context"
 	"sync"
 	"time"
 )
 
-func (r IGMPReporter) outInterfaceSelector(wg *sync.WaitGroup) {
+// outInterfaceSelector reads the outside interface selections written by the application
+func (r IGMPReporter) outInterfaceSelector(wg *sync.WaitGroup, ctx context.Context) {
 
 	defer wg.Done()
 
-	debugLog(r.debugLevel > 10, "outInterfaceSelector()")
+	r.log.Debug("outInterfaceSelector()")
 
 	for loops := 0; ; loops++ {
 
-		startTime := time.Now()
 		r.pC.WithLabelValues("outInterfaceSelector", "loops", "count").Inc()
 
-		outInt := <-r.OutInterfaceSelectorCh
+		var outInt side
+		select {
+		case <-ctx.Done():
+			r.log.Debug("outInterfaceSelector ctx.Done()", "loop", loops)
+			return
+		case outInt = <-r.OutInterfaceSelectorCh:
+		}
 
-		r.IntOutName.Store(IN, outInt)
+		startTime := time.Now()
 
-		r.pC.WithLabelValues("outInterfaceSelector", outInt.String(), "count").Inc()
-		r.pG.Set(float64(outInt))
+		if !r.OutsideInterfaces[outInt] {
+			r.log.Warn("outInterfaceSelector() not an outside interface. Ignoring", "loop", loops, "out", outInt)
+			r.pC.WithLabelValues("outInterfaceSelector", "notOutside", "error").Inc()
+			continue
+		}
 
-		debugLog(r.debugLevel > 10, fmt.Sprintf("outInterfaceSelector() loops:%d outInt:%v", loops, outInt))
+		r.setOutInterface(outInt, outReasonSelector)
 
 		r.pH.WithLabelValues("outInterfaceSelector", "loop", "complete").Observe(time.Since(startTime).Seconds())
 	}
 }
+
+// setOutInterface makes outInt the active outside interface
+// This is used by outInterfaceSelector and the automatic selection modes
+func (r IGMPReporter) setOutInterface(outInt side, reason string) {
+
+	old, _ := r.IntOutName.Swap(IN, outInt)
+
+	r.pC.WithLabelValues("outInterfaceSelector", outInt.String(), "count").Inc()
+	r.pG.Set(float64(outInt))
+
+	r.log.Info("outInterfaceSelector() selected", "out", outInt, "old", old, "reason", reason)
+
+	oldInt, ok := old.(side)
+	if !ok || oldInt == outInt {
+		return
+	}
+
+	if !r.conf.OutSelection.DisableReannounce {
+		r.reannounce(oldInt, outInt, r.conf.OutSelection.LeaveOnSwitch || reason == outReasonQuerier)
+	}
+
+	if r.observing() {
+		ev := OutInterfaceChangeEvent{Event: r.event(outInt), OldInterface: r.IntName[oldInt], OldSide: oldInt.String(), Reason: reason}
+		r.notify(func(o Observer) { o.OnOutInterfaceChange(ev) })
+	}
+}
+
+// reannounce sends membership reports for the current memberships on the new outside interface,
+// and optionally leaves on the old one, so the upstream routers don't have to wait for the next query
+func (r IGMPReporter) reannounce(old side, outInt side, leaves bool) {
+
+	items := mergeMembershipItems(r.Memberships(), r.static.items(outInt, outInt))
+
+	r.log.Info("reannounce()", "old", old, "out", outInt, "items", len(items), "leaves", leaves)
+
+	if len(items) == 0 {
+		return
+	}
+	r.pC.WithLabelValues("reannounce", "items", "count").Add(float64(len(items)))
+
+	if r.conRaw[outInt] == nil {
+		r.log.Warn("reannounce() no raw socket. Not sending reports", "out", outInt)
+		r.pC.WithLabelValues("reannounce", "noRawConn", "error").Inc()
+	} else {
+		r.sendMembershipReport(outInt, items)
+	}
+
+	if !leaves {
+		return
+	}
+
+	if r.conRaw[old] == nil {
+		r.log.Warn("reannounce() no raw socket. Not sending leaves", "old", old)
+		r.pC.WithLabelValues("reannounce", "noRawConn", "error").Inc()
+	} else {
+		r.sendLeave(old, r.static.withoutStatic(items))
+	}
+}
+
+// activeOutInterface returns the active outside interface
+func (r IGMPReporter) activeOutInterface() side {
+	if o, ok := r.IntOutName.Load(IN); ok {
+		return o.(side)
+	}
+	return OUT
+}
@@ -0,0 +1,123 @@
+package goIGMP
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/randomizedcoder/gopacket"
+	"github.com/randomizedcoder/gopacket/layers"
+	"github.com/randomizedcoder/gopacket/pcapgo"
+)
+
+// CapturedIGMP is a single IGMP packet read from a pcap file
+type CapturedIGMP struct {
+	Timestamp   time.Time
+	Src         netip.Addr
+	Dst         netip.Addr
+	TTL         uint8
+	RouterAlert bool
+	Payload     []byte
+}
+
+// ReadIGMPPcap reads a pcap file, like the ones in the pcaps/ directory,
+// and returns the IGMP packets it contains.  Non-IGMP packets are skipped.
+func ReadIGMPPcap(filename string) (packets []CapturedIGMP, err error) {
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	pr, err := pcapgo.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("ReadIGMPPcap(%s) NewReader err:%w", filename, err)
+	}
+
+	for {
+		data, ci, errR := pr.ReadPacketData()
+		if errR == io.EOF {
+			break
+		}
+		if errR != nil {
+			return packets, fmt.Errorf("ReadIGMPPcap(%s) ReadPacketData err:%w", filename, errR)
+		}
+
+		packet := gopacket.NewPacket(data, pr.LinkType(), gopacket.Default)
+
+		ip4, ok := packet.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+		if !ok || ip4.Protocol != layers.IPProtocolIGMP {
+			continue
+		}
+
+		src, errS := ipToAddr(ip4.SrcIP)
+		if errS != nil {
+			return packets, errS
+		}
+		dst, errD := ipToAddr(ip4.DstIP)
+		if errD != nil {
+			return packets, errD
+		}
+
+		packets = append(packets, CapturedIGMP{
+			Timestamp: ci.Timestamp,
+			Src:       src,
+			Dst:       dst,
+			TTL:       ip4.TTL,
+			RouterAlert: slices.ContainsFunc(ip4.Options, func(o layers.IPv4Option) bool {
+				return o.OptionType == ipv4OptionRouterAlertCst
+			}),
+			Payload: ip4.Payload,
+		})
+	}
+
+	return packets, nil
+}
+
+// ReplayPcap reads the IGMP packets from a pcap file and feeds them through the
+// same receive pipeline recvIGMP uses, as if they had arrived on the outside interface.
+// This is intended to be used with TestingOptions.ReplayOnly, so no sockets are opened.
+func (r IGMPReporter) ReplayPcap(ctx context.Context, filename string) (replayed int, err error) {
+
+	startTime := time.Now()
+	defer func() {
+		r.pH.WithLabelValues("ReplayPcap", "start", "complete").Observe(time.Since(startTime).Seconds())
+	}()
+	r.pC.WithLabelValues("ReplayPcap", "start", "count").Inc()
+
+	packets, err := ReadIGMPPcap(filename)
+	if err != nil {
+		return 0, err
+	}
+
+	r.log.Debug("ReplayPcap", "file", filename, "packets", len(packets))
+
+	for i, p := range packets {
+
+		select {
+		case <-ctx.Done():
+			return replayed, ctx.Err()
+		default:
+		}
+
+		g, ok := r.mapNetAddrtoIP[p.Dst]
+		if !ok {
+			// the real sockets are only joined to 224.0.0.1, .2 and .22
+			r.log.Debug("ReplayPcap not one of our groups. Ignoring", "file", filename, "loop", i, "dst", p.Dst)
+			r.pC.WithLabelValues("ReplayPcap", "dstAddr", "ignore").Inc()
+			continue
+		}
+
+		if r.validHeader(OUT, g, p.Src.AsSlice(), igmpHeader{ttl: int(p.TTL), routerAlert: p.RouterAlert}, p.Payload) {
+			r.handleIGMP(OUT, g, i, p.Src.AsSlice(), p.Dst, p.Payload)
+		}
+		replayed++
+	}
+
+	return replayed, nil
+}
@@ -0,0 +1,201 @@
+package goIGMP
+
+import (
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+// PolicyAction is allow or deny
+type PolicyAction int
+
+const (
+	PolicyAllow PolicyAction = iota
+	PolicyDeny
+)
+
+func (a PolicyAction) String() string {
+	switch a {
+	case PolicyAllow:
+		return "allow"
+	case PolicyDeny:
+		return "deny"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	policyDefaultRuleCst = "default"
+)
+
+// PolicyRule matches memberships.  Empty fields match anything.
+//
+// Sources only matches (S,G) memberships, so a rule with Sources never matches a (*,G) join.
+// Reporters is the source IP of the report.  Client-mode joins have no reporter,
+// so a rule with Reporters never matches them.
+// Interfaces is the name of the interface the report arrived on, or for client-mode joins,
+// the outside interface they are sent on.
+type PolicyRule struct {
+	Name       string // used for the hit counter label.  Defaults to "rule<index>"
+	Action     PolicyAction
+	Groups     []netip.Prefix
+	Sources    []netip.Prefix
+	Reporters  []netip.Prefix
+	Interfaces []string
+}
+
+// Policy is an ordered list of rules, and the first matching rule decides.
+// If no rule matches, Default decides, which is allow by default.
+//
+// The policy applies to the reports and leaves that are proxied, multicast or unicast,
+// and to the client-mode joins from MembershipReportToNetworkCh.
+// An IGMPv3 report is only proxied when all the group records are allowed.
+type Policy struct {
+	Rules   []PolicyRule
+	Default PolicyAction
+}
+
+// policyMatch is what decided a single (S,G)
+type policyMatch struct {
+	action PolicyAction
+	rule   int // -1 for the default
+}
+
+func prefixesContain(prefixes []netip.Prefix, addr netip.Addr) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	if !addr.IsValid() {
+		return false
+	}
+	return slices.ContainsFunc(prefixes, func(p netip.Prefix) bool {
+		return p.Contains(addr)
+	})
+}
+
+func (pr *PolicyRule) matches(iface string, reporter netip.Addr, group netip.Addr, source netip.Addr) bool {
+	if len(pr.Interfaces) > 0 && !slices.Contains(pr.Interfaces, iface) {
+		return false
+	}
+	return prefixesContain(pr.Groups, group) &&
+		prefixesContain(pr.Sources, source) &&
+		prefixesContain(pr.Reporters, reporter)
+}
+
+// decide returns the action for a single (S,G), or (*,G) when source is invalid
+func (p *Policy) decide(iface string, reporter netip.Addr, group netip.Addr, source netip.Addr) policyMatch {
+	for i := range p.Rules {
+		if p.Rules[i].matches(iface, reporter, group, source) {
+			return policyMatch{action: p.Rules[i].Action, rule: i}
+		}
+	}
+	return policyMatch{action: p.Default, rule: -1}
+}
+
+// filter returns the allowed part of the membership item, and the decisions made
+// A (*,G) is a single decision.  For (S,G)s each source is decided, and the item
+// is allowed if any source is.
+func (p *Policy) filter(iface string, reporter netip.Addr, mi MembershipItem) (allowed MembershipItem, ok bool, matches []policyMatch) {
+
+	if len(mi.Sources) == 0 {
+		m := p.decide(iface, reporter, mi.Group, netip.Addr{})
+		return mi, m.action == PolicyAllow, []policyMatch{m}
+	}
+
+	allowed.Group = mi.Group
+	for _, s := range mi.Sources {
+		m := p.decide(iface, reporter, mi.Group, s)
+		matches = append(matches, m)
+		if m.action == PolicyAllow {
+			allowed.Sources = append(allowed.Sources, s)
+		}
+	}
+
+	return allowed, len(allowed.Sources) > 0, matches
+}
+
+func (p *Policy) ruleName(i int) string {
+	if i < 0 {
+		return policyDefaultRuleCst
+	}
+	if p.Rules[i].Name != "" {
+		return p.Rules[i].Name
+	}
+	return "rule" + strconv.Itoa(i)
+}
+
+// policyActive is checked first, so there is no cost without rules
+func (r IGMPReporter) policyActive() bool {
+	return len(r.conf.Policy.Rules) > 0 || r.conf.Policy.Default != PolicyAllow
+}
+
+// policyFilter returns the allowed membership items, counting the rule hits
+func (r IGMPReporter) policyFilter(interf side, reporter netip.Addr, items []MembershipItem) (allowed []MembershipItem, denied int) {
+
+	if !r.policyActive() {
+		return items, 0
+	}
+
+	allowed = make([]MembershipItem, 0, len(items))
+	for _, mi := range items {
+		a, ok, matches := r.conf.Policy.filter(r.IntName[interf], reporter, mi)
+		for _, m := range matches {
+			r.pCpolicy.WithLabelValues(r.conf.Policy.ruleName(m.rule), m.action.String()).Inc()
+		}
+		if !ok {
+			denied++
+			continue
+		}
+		if len(a.Sources) != len(mi.Sources) {
+			denied++
+		}
+		allowed = append(allowed, a)
+	}
+
+	return allowed, denied
+}
+
+// policyAllowsMessage is true if every membership in a report or leave is allowed
+// The payload is proxied as is, so a partly allowed message is denied
+func (r IGMPReporter) policyAllowsMessage(interf side, src net.IP, msg IGMPMessage) bool {
+
+	if !r.policyActive() {
+		return true
+	}
+
+	items := msg.MembershipItems
+	switch msg.Type {
+	case layers.IGMPMembershipReportV1, layers.IGMPMembershipReportV2, layers.IGMPLeaveGroup:
+	case layers.IGMPMembershipReportV3:
+		items = make([]MembershipItem, len(msg.GroupRecords))
+		for i, gr := range msg.GroupRecords {
+			items[i] = policyItem(gr.Type, msg.MembershipItems[i])
+		}
+	default:
+		return true
+	}
+
+	_, denied := r.policyFilter(interf, netIPToAddr(src), items)
+
+	return denied == 0
+}
+
+// policyItem is the membership an IGMPv3 group record is decided as
+// The sources of an EXCLUDE record are the sources not wanted, so it is decided as (*,G)
+func policyItem(t layers.IGMPv3GroupRecordType, mi MembershipItem) MembershipItem {
+	if t == layers.IGMPIsEx || t == layers.IGMPToEx {
+		return MembershipItem{Group: mi.Group}
+	}
+	return mi
+}
+
+// policyApplies is true for the messages the policy is checked on, which are the memberships
+// learned from the inside, and the messages proxied from the outside.  The outside reports that are
+// not proxied still reach MembershipReportFromNetworkCh and the observers.
+func (r IGMPReporter) policyApplies(interf side) bool {
+	return interf == IN || r.proxyIt(interf)
+}
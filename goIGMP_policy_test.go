@@ -0,0 +1,106 @@
+package goIGMP
+
+import (
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+func TestPolicyFilter(t *testing.T) {
+
+	p := Policy{
+		Rules: []PolicyRule{
+			{Name: "denyBadSource", Action: PolicyDeny, Sources: []netip.Prefix{netip.MustParsePrefix("10.9.9.0/24")}},
+			{Name: "eth1Only", Action: PolicyDeny, Groups: []netip.Prefix{netip.MustParsePrefix("239.1.0.0/16")}, Interfaces: []string{"eth0"}},
+			{Action: PolicyAllow, Groups: []netip.Prefix{netip.MustParsePrefix("239.0.0.0/8")}, Reporters: []netip.Prefix{netip.MustParsePrefix("192.168.0.0/24")}},
+		},
+		Default: PolicyDeny,
+	}
+
+	reporter := netip.MustParseAddr("192.168.0.10")
+	other := netip.MustParseAddr("172.16.0.10")
+	g := netip.MustParseAddr("239.2.2.2")
+	s1 := netip.MustParseAddr("10.1.1.1")
+	bad := netip.MustParseAddr("10.9.9.9")
+
+	tests := []struct {
+		name     string
+		iface    string
+		reporter netip.Addr
+		item     MembershipItem
+		want     MembershipItem
+		ok       bool
+		rules    []string
+	}{
+		{"anySource", "eth0", reporter, MembershipItem{Group: g}, MembershipItem{Group: g}, true, []string{"rule2"}},
+		{"otherReporter", "eth0", other, MembershipItem{Group: g}, MembershipItem{Group: g}, false, []string{"default"}},
+		{"noReporter", "eth0", netip.Addr{}, MembershipItem{Group: g}, MembershipItem{Group: g}, false, []string{"default"}},
+		{"interface", "eth0", reporter, MembershipItem{Group: netip.MustParseAddr("239.1.1.1")}, MembershipItem{Group: netip.MustParseAddr("239.1.1.1")}, false, []string{"eth1Only"}},
+		{"otherInterface", "eth1", reporter, MembershipItem{Group: netip.MustParseAddr("239.1.1.1")}, MembershipItem{Group: netip.MustParseAddr("239.1.1.1")}, true, []string{"rule2"}},
+		{"partialSources", "eth0", reporter, MembershipItem{Group: g, Sources: []netip.Addr{s1, bad}}, MembershipItem{Group: g, Sources: []netip.Addr{s1}}, true, []string{"rule2", "denyBadSource"}},
+		{"allSourcesDenied", "eth0", reporter, MembershipItem{Group: g, Sources: []netip.Addr{bad}}, MembershipItem{Group: g}, false, []string{"denyBadSource"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok, matches := p.filter(tc.iface, tc.reporter, tc.item)
+			if ok != tc.ok {
+				t.Fatalf("ok:%t, want:%t", ok, tc.ok)
+			}
+			if ok && !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got:%v, want:%v", got, tc.want)
+			}
+			var rules []string
+			for _, m := range matches {
+				rules = append(rules, p.ruleName(m.rule))
+			}
+			if !reflect.DeepEqual(rules, tc.rules) {
+				t.Errorf("rules:%v, want:%v", rules, tc.rules)
+			}
+		})
+	}
+}
+
+func TestPolicyAllowsMessageExclude(t *testing.T) {
+
+	r := *testReporter(t)
+	r.conf.Policy = Policy{Rules: []PolicyRule{
+		{Action: PolicyDeny, Sources: []netip.Prefix{netip.MustParsePrefix("10.9.9.0/24")}},
+		{Action: PolicyDeny, Groups: []netip.Prefix{netip.MustParsePrefix("239.1.0.0/16")}},
+	}}
+
+	bad := netip.MustParseAddr("10.9.9.9")
+	good := netip.MustParseAddr("10.1.1.1")
+	v3 := func(rt layers.IGMPv3GroupRecordType, g string, sources ...netip.Addr) IGMPMessage {
+		return IGMPMessage{
+			Type:            layers.IGMPMembershipReportV3,
+			GroupRecords:    []layers.IGMPv3GroupRecord{{Type: rt}},
+			MembershipItems: []MembershipItem{{Group: netip.MustParseAddr(g), Sources: sources}},
+		}
+	}
+
+	tests := []struct {
+		name string
+		msg  IGMPMessage
+		want bool
+	}{
+		// excluding the denied source is what the policy wants
+		{"exclude denied source", v3(layers.IGMPToEx, "232.1.1.1", bad), true},
+		{"include denied source", v3(layers.IGMPIsIn, "232.1.1.1", bad), false},
+		// any source, other than the allowed one, is still a (*,G) join for the denied group
+		{"exclude into denied group", v3(layers.IGMPIsEx, "239.1.1.1", good), false},
+		{"include allowed source", v3(layers.IGMPAllow, "232.1.1.1", good), true},
+	}
+	for _, tt := range tests {
+		if got := r.policyAllowsMessage(IN, net.ParseIP("192.168.0.1"), tt.msg); got != tt.want {
+			t.Errorf("%s got:%t want:%t", tt.name, got, tt.want)
+		}
+	}
+
+	if !r.policyApplies(IN) || r.policyApplies(OUT) != r.conf.ProxyOutToIn {
+		t.Errorf("policyApplies IN:%t OUT:%t", r.policyApplies(IN), r.policyApplies(OUT))
+	}
+}
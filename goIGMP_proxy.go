@@ -5,9 +5,11 @@ import (
 	"log"
 	"net"
 	"time"
+
+	"golang.org/x/net/ipv4"
 )
 
-func (r IGMPReporter) proxy(interf side, dest destIP, buf *[]byte) {
+func (r IGMPReporter) proxy(interf side, dest destIP, buf *[]byte, rm rateMsg) {
 
 	startTime := time.Now()
 	defer func() {
@@ -15,25 +17,28 @@ func (r IGMPReporter) proxy(interf side, dest destIP, buf *[]byte) {
 	}()
 	r.pC.WithLabelValues("proxy", "start", "count").Inc()
 
-	debugLog(r.debugLevel > 100, fmt.Sprintf("proxy:%s dest:%s", interf, r.mapIPtoNetAddr[dest]))
+	if r.traceOn() {
+		r.trace("proxy", "iface", interf, "dst", r.mapIPtoNetAddr[dest])
+	}
 
-	iph := r.ipv4Header(len(*buf), dest)
+	iph := r.ipv4Header(interf, len(*buf), dest)
 
-	err := r.conRaw[interf].SetWriteDeadline(time.Now().Add(writeDeadlineCst))
-	if err != nil {
-		log.Fatal(fmt.Sprintf("proxy(%s) SetWriteDeadline err:", interf), err)
+	if r.rateLimited(pendingMsg{fn: "proxy", interf: interf, host: rm.host, dst: iph.Dst, payload: *buf, proxied: true}, rm) {
+		return
 	}
 
-	if errW := r.conRaw[interf].WriteTo(iph, *buf, r.ContMsg[interf]); errW != nil {
-		log.Fatal(fmt.Sprintf("proxy(%s) WriteTo errW:", interf), errW)
+	if !r.writeIGMP("proxy", interf, iph, *buf) {
+		return
 	}
-	r.pC.WithLabelValues("proxy", "WriteTo", "count").Inc()
-	r.pC.WithLabelValues("proxy", "WriteToBytes", "count").Add(float64(len(*buf)))
 
-	debugLog(r.debugLevel > 10, fmt.Sprintf("proxy(%s) WriteTo success! len(payload):%d", interf, len(*buf)))
+	r.notifyProxy(interf, iph.Dst, len(*buf))
+
+	if r.debugOn() {
+		r.log.Debug("proxy WriteTo success!", "iface", interf, "len", len(*buf))
+	}
 }
 
-func (r IGMPReporter) proxyUniToMultiv1or2(interf side, dest net.IP, buf *[]byte) {
+func (r IGMPReporter) proxyUniToMultiv1or2(interf side, dest net.IP, buf *[]byte, rm rateMsg) {
 
 	startTime := time.Now()
 	defer func() {
@@ -41,20 +46,53 @@ func (r IGMPReporter) proxyUniToMultiv1or2(interf side, dest net.IP, buf *[]byte
 	}()
 	r.pC.WithLabelValues("proxyUniToMultiv1or2", "start", "count").Inc()
 
-	debugLog(r.debugLevel > 100, fmt.Sprintf("proxyUniToMultiv1or2:%s dest:%s", interf, dest.String()))
+	if r.traceOn() {
+		r.trace("proxyUniToMultiv1or2", "iface", interf, "dst", dest)
+	}
 
-	iph := r.ipv4HeaderNetIP(len(*buf), dest)
+	iph := r.ipv4HeaderNetIP(interf, len(*buf), dest)
+
+	if r.rateLimited(pendingMsg{fn: "proxyUniToMultiv1or2", interf: interf, host: rm.host, dst: dest, payload: *buf, proxied: true}, rm) {
+		return
+	}
+
+	if !r.writeIGMP("proxyUniToMultiv1or2", interf, iph, *buf) {
+		return
+	}
+
+	r.notifyProxy(interf, iph.Dst, len(*buf))
+
+	if r.debugOn() {
+		r.log.Debug("proxyUniToMultiv1or2 WriteTo success!", "iface", interf, "len", len(*buf))
+	}
+}
+
+// writeIGMP writes the payload to the raw socket, returning false on failure
+// The payloads can come from the network, so a write failure must not take the process down
+func (r IGMPReporter) writeIGMP(fn string, interf side, iph *ipv4.Header, payload []byte) bool {
 
 	err := r.conRaw[interf].SetWriteDeadline(time.Now().Add(writeDeadlineCst))
 	if err != nil {
-		log.Fatal(fmt.Sprintf("proxyUniToMultiv1or2(%s) SetWriteDeadline err:", interf), err)
+		log.Fatal(fmt.Sprintf("%s(%s) SetWriteDeadline err:", fn, interf), err)
 	}
 
-	if errW := r.conRaw[interf].WriteTo(iph, *buf, r.ContMsg[interf]); errW != nil {
-		log.Fatal(fmt.Sprintf("proxyUniToMultiv1or2(%s) WriteTo errW:", interf), errW)
+	if errW := r.conRaw[interf].WriteTo(iph, payload, r.ContMsg[interf]); errW != nil {
+		r.log.Warn(fn+" WriteTo", "iface", interf, "err", errW)
+		r.pC.WithLabelValues(fn, "WriteTo", "error").Inc()
+		r.notifyDrop(interf, DropWriteError, nil, errW)
+		return false
 	}
-	r.pC.WithLabelValues("proxyUniToMultiv1or2", "WriteTo", "count").Inc()
-	r.pC.WithLabelValues("proxyUniToMultiv1or2", "WriteToBytes", "count").Add(float64(len(*buf)))
+	r.pC.WithLabelValues(fn, "WriteTo", "count").Inc()
+	r.pC.WithLabelValues(fn, "WriteToBytes", "count").Add(float64(len(payload)))
+
+	return true
+}
 
-	debugLog(r.debugLevel > 10, fmt.Sprintf("proxyUniToMultiv1or2(%s) WriteTo success! len(payload):%d", interf, len(*buf)))
+// notifyProxy tells the observers about a successful proxy write
+func (r IGMPReporter) notifyProxy(interf side, dst net.IP, n int) {
+	if !r.observing() {
+		return
+	}
+	ev := ProxyEvent{Event: r.event(interf), Dst: netIPToAddr(dst), Bytes: n}
+	r.notify(func(o Observer) { o.OnProxy(ev) })
 }
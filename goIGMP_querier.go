@@ -0,0 +1,47 @@
+package goIGMP
+
+import (
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// querierState is the source of the last query seen on each interface
+type querierState struct {
+	mu   sync.RWMutex
+	addr map[side]netip.Addr
+	seen map[side]time.Time
+}
+
+func newQuerierState() *querierState {
+	return &querierState{
+		addr: make(map[side]netip.Addr),
+		seen: make(map[side]time.Time),
+	}
+}
+
+// setQuerier records a query from addr on interf, and returns the previous querier
+func (r IGMPReporter) setQuerier(interf side, addr netip.Addr) (old netip.Addr, changed bool) {
+	r.querier.mu.Lock()
+	defer r.querier.mu.Unlock()
+
+	old = r.querier.addr[interf]
+	r.querier.addr[interf] = addr
+	r.querier.seen[interf] = time.Now()
+
+	return old, old != addr
+}
+
+// querierAddr returns the querier on the active outside interface
+// which is where the unicast membership reports are sent
+func (r IGMPReporter) querierAddr() netip.Addr {
+	out := OUT
+	if o, ok := r.IntOutName.Load(IN); ok {
+		out = o.(side)
+	}
+
+	r.querier.mu.RLock()
+	defer r.querier.mu.RUnlock()
+
+	return r.querier.addr[out]
+}
@@ -0,0 +1,346 @@
+package goIGMP
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+// RateLimit is a token bucket.  Rate is messages per second, and zero is unlimited.
+type RateLimit struct {
+	Rate  float64
+	Burst int // Defaults to Rate, and at least 1
+}
+
+// RateLimits paces the IGMP sent by proxy, proxyUniToMultiv1or2 and sendMembershipReport,
+// so a query storm or a broken client can't cause an IGMP storm upstream
+//
+// PerInterface is per output interface.  PerHost is per source host of the proxied
+// messages, and doesn't apply to the reports generated by goIGMP.
+//
+// A message over the limit is queued until there are tokens.  Messages that describe the
+// current state of the same groups, from the same host, are coalesced, so only the latest is sent:
+// IGMPv1/v2 reports and leaves, queries, IGMPv3 reports with only MODE_IS records, and the generated reports.
+// Other messages, like IGMPv3 state changes, are queued in order.  When MaxPending messages
+// are queued, new ones are dropped.
+type RateLimits struct {
+	PerInterface RateLimit
+	PerHost      RateLimit
+	MaxPending   int // Defaults to 1000
+}
+
+const (
+	maxPendingCst = 1000
+
+	minRateTickCst     = time.Millisecond
+	maxRateTickCst     = time.Second
+	hostBucketPruneCst = time.Minute
+)
+
+func (l *RateLimits) active() bool {
+	return l.PerInterface.Rate > 0 || l.PerHost.Rate > 0
+}
+
+// tokenBucket is nil when unlimited
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(l RateLimit, now time.Time) *tokenBucket {
+	if l.Rate <= 0 {
+		return nil
+	}
+	burst := float64(l.Burst)
+	if burst <= 0 {
+		burst = max(1, l.Rate)
+	}
+	return &tokenBucket{rate: l.Rate, burst: burst, tokens: burst, last: now}
+}
+
+func (b *tokenBucket) ready(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	return b.tokens >= 1
+}
+
+func (b *tokenBucket) take() {
+	if b != nil {
+		b.tokens--
+	}
+}
+
+// full is true when the bucket is back to its burst, so it can be forgotten
+func (b *tokenBucket) full(now time.Time) bool {
+	b.ready(now)
+	return b.tokens >= b.burst
+}
+
+// rateResult is what the rate limiter did with a message
+type rateResult int
+
+const (
+	rateSend rateResult = iota
+	rateQueued
+	rateCoalesced
+	rateDropped
+)
+
+func (r rateResult) String() string {
+	switch r {
+	case rateSend:
+		return "send"
+	case rateQueued:
+		return "queued"
+	case rateCoalesced:
+		return "coalesced"
+	case rateDropped:
+		return "dropped"
+	default:
+		return "unknown"
+	}
+}
+
+// rateMsg is what the rate limiter needs to know about a message
+// key is empty for messages that can't be coalesced
+type rateMsg struct {
+	host netip.Addr
+	key  string
+}
+
+// pendingMsg is a message waiting for tokens
+type pendingMsg struct {
+	fn      string // the sending function, for the metrics
+	interf  side
+	host    netip.Addr
+	dst     net.IP
+	payload []byte
+	proxied bool
+}
+
+type pendingKey struct {
+	interf side
+	key    string
+}
+
+// rateLimiter is the token buckets, and the messages waiting for them
+type rateLimiter struct {
+	conf RateLimits
+
+	mu         sync.Mutex
+	interfaces map[side]*tokenBucket
+	hosts      map[netip.Addr]*tokenBucket
+	pending    map[pendingKey]*pendingMsg
+	order      []pendingKey
+	seq        int // unique keys for the messages that can't be coalesced
+	pruned     time.Time
+}
+
+func newRateLimiter(conf RateLimits, now time.Time) *rateLimiter {
+	if conf.MaxPending <= 0 {
+		conf.MaxPending = maxPendingCst
+	}
+	return &rateLimiter{
+		conf:       conf,
+		interfaces: make(map[side]*tokenBucket),
+		hosts:      make(map[netip.Addr]*tokenBucket),
+		pending:    make(map[pendingKey]*pendingMsg),
+		pruned:     now,
+	}
+}
+
+func (l *rateLimiter) bucketsLocked(interf side, host netip.Addr, now time.Time) (*tokenBucket, *tokenBucket) {
+	ib, ok := l.interfaces[interf]
+	if !ok {
+		ib = newTokenBucket(l.conf.PerInterface, now)
+		l.interfaces[interf] = ib
+	}
+	if !host.IsValid() {
+		return ib, nil
+	}
+	hb, ok := l.hosts[host]
+	if !ok {
+		hb = newTokenBucket(l.conf.PerHost, now)
+		if hb != nil {
+			l.hosts[host] = hb
+		}
+	}
+	return ib, hb
+}
+
+// admit decides if the message can be sent now.  Otherwise it's queued, coalesced or dropped.
+// The payload is copied when it is queued, because the caller's buffer is reused.
+func (l *rateLimiter) admit(m pendingMsg, rm rateMsg, now time.Time) rateResult {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	pk := pendingKey{interf: m.interf, key: rm.key}
+
+	// a newer message replaces the queued one, so it can't overtake it
+	if p, ok := l.pending[pk]; ok && rm.key != "" {
+		*p = m
+		p.payload = slices.Clone(m.payload)
+		return rateCoalesced
+	}
+
+	ib, hb := l.bucketsLocked(m.interf, m.host, now)
+	if ib.ready(now) && hb.ready(now) {
+		ib.take()
+		hb.take()
+		return rateSend
+	}
+
+	if len(l.pending) >= l.conf.MaxPending {
+		return rateDropped
+	}
+
+	if rm.key == "" {
+		l.seq++
+		pk.key = "#" + strconv.Itoa(l.seq)
+	}
+	p := m
+	p.payload = slices.Clone(m.payload)
+	l.pending[pk] = &p
+	l.order = append(l.order, pk)
+
+	return rateQueued
+}
+
+// flush returns the queued messages that now have tokens, in order
+func (l *rateLimiter) flush(now time.Time) (ready []pendingMsg) {
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	order := l.order[:0]
+	for _, pk := range l.order {
+		p := l.pending[pk]
+		ib, hb := l.bucketsLocked(p.interf, p.host, now)
+		if ib.ready(now) && hb.ready(now) {
+			ib.take()
+			hb.take()
+			ready = append(ready, *p)
+			delete(l.pending, pk)
+			continue
+		}
+		order = append(order, pk)
+	}
+	l.order = order
+
+	if now.Sub(l.pruned) > hostBucketPruneCst {
+		for h, b := range l.hosts {
+			if b.full(now) {
+				delete(l.hosts, h)
+			}
+		}
+		l.pruned = now
+	}
+
+	return ready
+}
+
+// tick is how often the queued messages are checked
+func (l *rateLimiter) tick() time.Duration {
+	rate := max(l.conf.PerInterface.Rate, l.conf.PerHost.Rate)
+	t := time.Duration(float64(time.Second) / rate)
+	return max(minRateTickCst, min(t, maxRateTickCst))
+}
+
+// rateKey is the coalescing key for the message from host, or empty if it can't be coalesced
+// The reports and leaves only coalesce with the same host's, as the other hosts may still be joined
+func rateKey(host netip.Addr, msg IGMPMessage) string {
+
+	switch msg.Type {
+
+	case layers.IGMPMembershipQuery:
+		return "q" + msg.Group.String()
+
+	case layers.IGMPMembershipReportV1, layers.IGMPMembershipReportV2, layers.IGMPLeaveGroup:
+		// a leave replaces the host's queued report for the group, and the other way around
+		return "g" + host.String() + " " + msg.Group.String()
+
+	case layers.IGMPMembershipReportV3:
+		var sb strings.Builder
+		sb.WriteString("v3 " + host.String())
+		for i, gr := range msg.GroupRecords {
+			if gr.Type != layers.IGMPIsIn && gr.Type != layers.IGMPIsEx {
+				return ""
+			}
+			sb.WriteString(" " + msg.MembershipItems[i].Group.String())
+		}
+		return sb.String()
+	}
+
+	return ""
+}
+
+// rateMsgFor is the rate limiter information for a received message
+func rateMsgFor(src net.IP, msg IGMPMessage) rateMsg {
+	host := netIPToAddr(src)
+	return rateMsg{host: host, key: rateKey(host, msg)}
+}
+
+// rateLimited is true if the message was queued, coalesced or dropped by the rate limits,
+// and so must not be sent now
+func (r IGMPReporter) rateLimited(m pendingMsg, rm rateMsg) bool {
+
+	if r.rate == nil {
+		return false
+	}
+
+	res := r.rate.admit(m, rm, time.Now())
+	if res == rateSend {
+		return false
+	}
+
+	r.pC.WithLabelValues("rateLimit", m.fn, res.String()).Inc()
+	if r.debugOn() {
+		r.log.Debug("rateLimited", "fn", m.fn, "iface", m.interf, "host", m.host, "dst", m.dst, "result", res)
+	}
+	if res == rateDropped {
+		r.notifyDrop(m.interf, DropRateLimit, m.host.AsSlice(), nil)
+	}
+
+	return true
+}
+
+// rateLimitFlusher sends the queued messages as the tokens become available
+func (r IGMPReporter) rateLimitFlusher(wg *sync.WaitGroup, ctx context.Context) {
+
+	defer wg.Done()
+
+	r.log.Debug("rateLimitFlusher()", "tick", r.rate.tick())
+
+	ticker := time.NewTicker(r.rate.tick())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.log.Debug("rateLimitFlusher ctx.Done()")
+			return
+		case <-ticker.C:
+		}
+
+		for _, p := range r.rate.flush(time.Now()) {
+			r.pC.WithLabelValues("rateLimit", p.fn, "flushed").Inc()
+			iph := r.ipv4HeaderNetIP(p.interf, len(p.payload), p.dst)
+			if r.writeIGMP(p.fn, p.interf, iph, p.payload) && p.proxied {
+				r.notifyProxy(p.interf, iph.Dst, len(p.payload))
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package goIGMP
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+func TestRateLimiter(t *testing.T) {
+
+	now := time.Now()
+	l := newRateLimiter(RateLimits{PerInterface: RateLimit{Rate: 10, Burst: 2}, MaxPending: 3}, now)
+
+	g1 := rateMsg{key: "g239.0.0.1"}
+	g2 := rateMsg{key: "g239.0.0.2"}
+	msg := func(b byte) pendingMsg {
+		return pendingMsg{fn: "test", interf: OUT, payload: []byte{b}}
+	}
+
+	want := []struct {
+		m   pendingMsg
+		rm  rateMsg
+		res rateResult
+	}{
+		{msg(1), g1, rateSend},
+		{msg(2), g1, rateSend},
+		{msg(3), g1, rateQueued},
+		{msg(4), g1, rateCoalesced},
+		{msg(5), g2, rateQueued},
+		{msg(6), rateMsg{}, rateQueued},
+		{msg(7), rateMsg{}, rateDropped},
+	}
+	for i, w := range want {
+		if res := l.admit(w.m, w.rm, now); res != w.res {
+			t.Fatalf("%d: res:%s, want:%s", i, res, w.res)
+		}
+	}
+
+	// another interface has its own bucket
+	if res := l.admit(pendingMsg{interf: ALTOUT}, g1, now); res != rateSend {
+		t.Errorf("ALTOUT res:%s, want:send", res)
+	}
+
+	if ready := l.flush(now); len(ready) != 0 {
+		t.Errorf("flushed %d with no tokens", len(ready))
+	}
+
+	// 100ms is one token
+	ready := l.flush(now.Add(100 * time.Millisecond))
+	if len(ready) != 1 || ready[0].payload[0] != 4 {
+		t.Fatalf("ready:%v, want the coalesced payload 4", ready)
+	}
+
+	ready = l.flush(now.Add(time.Second))
+	if len(ready) != 2 || ready[0].payload[0] != 5 || ready[1].payload[0] != 6 {
+		t.Fatalf("ready:%v, want payloads 5,6 in order", ready)
+	}
+}
+
+func TestRateLimiterPerHost(t *testing.T) {
+
+	now := time.Now()
+	l := newRateLimiter(RateLimits{PerHost: RateLimit{Rate: 1}}, now)
+
+	h1 := netip.MustParseAddr("192.168.0.1")
+	h2 := netip.MustParseAddr("192.168.0.2")
+
+	if res := l.admit(pendingMsg{interf: OUT, host: h1}, rateMsg{host: h1, key: "a"}, now); res != rateSend {
+		t.Errorf("h1 res:%s, want:send", res)
+	}
+	if res := l.admit(pendingMsg{interf: OUT, host: h1}, rateMsg{host: h1, key: "b"}, now); res != rateQueued {
+		t.Errorf("h1 res:%s, want:queued", res)
+	}
+	if res := l.admit(pendingMsg{interf: OUT, host: h2}, rateMsg{host: h2, key: "c"}, now); res != rateSend {
+		t.Errorf("h2 res:%s, want:send", res)
+	}
+}
+
+func TestRateKey(t *testing.T) {
+
+	g := netip.MustParseAddr("239.0.0.1")
+
+	h1 := netip.MustParseAddr("10.0.0.1")
+	h2 := netip.MustParseAddr("10.0.0.2")
+
+	report := IGMPMessage{Type: layers.IGMPMembershipReportV2, Group: g}
+	leave := IGMPMessage{Type: layers.IGMPLeaveGroup, Group: g}
+	if rateKey(h1, report) != rateKey(h1, leave) {
+		t.Errorf("report and leave for the same group should coalesce")
+	}
+	if rateKey(h1, report) == rateKey(h2, leave) {
+		t.Errorf("a leave must not replace another host's report")
+	}
+
+	current := IGMPMessage{Type: layers.IGMPMembershipReportV3,
+		GroupRecords:    []layers.IGMPv3GroupRecord{{Type: layers.IGMPIsEx}},
+		MembershipItems: []MembershipItem{{Group: g}}}
+	if rateKey(h1, current) == "" {
+		t.Errorf("MODE_IS reports should coalesce")
+	}
+
+	change := IGMPMessage{Type: layers.IGMPMembershipReportV3,
+		GroupRecords:    []layers.IGMPv3GroupRecord{{Type: layers.IGMPAllow}},
+		MembershipItems: []MembershipItem{{Group: g}}}
+	if rateKey(h1, change) != "" {
+		t.Errorf("state change reports should not coalesce")
+	}
+}
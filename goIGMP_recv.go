@@ -2,15 +2,16 @@ package goIGMP
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net"
-	"reflect"
+	"net/netip"
 	"sync"
 	"time"
 
-	"github.com/randomizedcoder/gopacket"
 	"github.com/randomizedcoder/gopacket/layers"
+	"golang.org/x/net/ipv4"
 )
 
 var (
@@ -26,27 +27,33 @@ const (
 	ignoreNonActiveInterfaceModulusCst = 100
 )
 
+var (
+	errQueryNotifyChFull                 = errors.New("QueryNotifyCh full")
+	errMembershipReportFromNetworkChFull = errors.New("MembershipReportFromNetworkCh full")
+)
+
 func (r IGMPReporter) recvIGMP(wg *sync.WaitGroup, ctx context.Context, interf side, g destIP) {
 
 	defer wg.Done()
 
-	debugLog(r.debugLevel > 10, fmt.Sprintf("recvIGMP(%s) g:%s started", interf, r.mapIPtoNetAddr[g]))
+	r.log.Debug("recvIGMP started", "iface", interf, "group", r.mapIPtoNetAddr[g])
 
 forLoop:
 	for loops := 0; ; loops++ {
 
 		select {
 		case <-ctx.Done():
-			debugLog(r.debugLevel > 10, fmt.Sprintf("recvIGMP(%s) g:%s loops:%d ctx.Done()", interf, r.mapIPtoNetAddr[g], loops))
+			r.log.Debug("recvIGMP ctx.Done()", "iface", interf, "group", r.mapIPtoNetAddr[g], "loop", loops)
 			break forLoop
 		default:
-			debugLog(r.debugLevel > 100, fmt.Sprintf("recvIGMP(%s) g:%s loops:%d ctx is not cancelled", interf, r.mapIPtoNetAddr[g], loops))
 		}
 
 		loopStartTime := time.Now()
 		r.pCrecvIGMP.WithLabelValues("loop", interf.String(), r.mapIPtoNetAddr[g].String(), "counter").Inc()
 
-		debugLog(r.debugLevel > 100, fmt.Sprintf("recvIGMP(%s) g:%s loops:%d", interf, r.mapIPtoNetAddr[g], loops))
+		if r.traceOn() {
+			r.trace("recvIGMP loop", "iface", interf, "group", r.mapIPtoNetAddr[g], "loop", loops)
+		}
 
 		err := r.mConIGMP[interf][r.mapIPtoNetAddr[g]].SetReadDeadline(time.Now().Add(r.conf.SocketReadDeadLine))
 		if err != nil {
@@ -54,10 +61,12 @@ forLoop:
 		}
 
 		buf := bytePool.Get().(*[]byte)
-		n, cm, src, err := r.mConIGMP[interf][r.mapIPtoNetAddr[g]].ReadFrom(*buf)
+		payload, cm, src, hdr, err := r.readIGMP(interf, g, *buf)
 		if err != nil {
 			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
-				debugLog(r.debugLevel > 10, fmt.Sprintf("recvIGMP(%s) g:%s ReadFrom timeout", interf, r.mapIPtoNetAddr[g]))
+				if r.debugOn() {
+					r.log.Debug("recvIGMP ReadFrom timeout", "iface", interf, "group", r.mapIPtoNetAddr[g], "loop", loops)
+				}
 				r.pCrecvIGMP.WithLabelValues("timeout", interf.String(), r.mapIPtoNetAddr[g].String(), "counter").Inc()
 				bytePool.Put(buf)
 				continue
@@ -67,21 +76,16 @@ forLoop:
 			continue
 		}
 		packetStartTime := time.Now()
-		r.pCrecvIGMP.WithLabelValues("n", interf.String(), r.mapIPtoNetAddr[g].String(), "counter").Add(float64(n))
-
-		//------------------
-		// Ignore traffic on the non-active outside interface
-		if r.AltOutExists {
-			if r.ignoreOnNonActiveOutOrAltInterface(&interf) {
-				if loops%ignoreNonActiveInterfaceModulusCst == 0 {
-					debugLog(r.debugLevel > 10,
-						fmt.Sprintf("recvIGMP(%s) g:%s loops:%d ignoring on non active outside interface",
-							interf, r.mapIPtoNetAddr[g], loops))
-				}
+		r.pCrecvIGMP.WithLabelValues("n", interf.String(), r.mapIPtoNetAddr[g].String(), "counter").Add(float64(len(payload)))
 
-				bytePool.Put(buf)
-				continue
+		if cm == nil {
+			if r.debugOn() {
+				r.log.Debug("recvIGMP no control message. Ignoring", "iface", interf, "group", r.mapIPtoNetAddr[g], "loop", loops)
 			}
+			r.pCrecvIGMP.WithLabelValues("controlMessage", interf.String(), r.mapIPtoNetAddr[g].String(), "error").Inc()
+			r.notifyDrop(interf, DropNoControlMessage, nil, nil)
+			bytePool.Put(buf)
+			continue
 		}
 
 		//------------------
@@ -90,179 +94,328 @@ forLoop:
 		// https://pkg.go.dev/net#Interface
 
 		if r.NetIFIndex[cm.IfIndex] != interf {
-			debugLog(r.debugLevel > 100, fmt.Sprintf("recvIGMP(%s) g:%s loops:%d r.NetIFIndex[%d]:%s != interf:%s. Packet not for our interface. Ignoring",
-				interf, r.mapIPtoNetAddr[g], loops, cm.IfIndex, r.NetIFIndex[cm.IfIndex], interf))
+			if r.traceOn() {
+				r.trace("recvIGMP packet not for our interface. Ignoring", "iface", interf, "group", r.mapIPtoNetAddr[g], "loop", loops, "ifIndex", cm.IfIndex, "ifIndexSide", r.NetIFIndex[cm.IfIndex])
+			}
 			r.pCrecvIGMP.WithLabelValues("interf", interf.String(), r.mapIPtoNetAddr[g].String(), "ignore").Inc()
+			r.notifyDrop(interf, DropNotOurInterface, cm.Src, nil)
 			bytePool.Put(buf)
 			continue
 		}
 
-		debugLog(r.debugLevel > 100, fmt.Sprintf("recvIGMP(%s) g:%s loops:%d n:%d, cm:%s, src:%s", interf, r.mapIPtoNetAddr[g], loops, n, cm, src))
-
-		if r.debugLevel > 100 {
+		if r.traceOn() {
+			r.trace("recvIGMP read", "iface", interf, "group", r.mapIPtoNetAddr[g], "loop", loops, "n", len(payload), "cm", cm, "src", src)
 			if !cm.Dst.IsMulticast() {
-				debugLog(r.debugLevel > 10, fmt.Sprintf("recvIGMP(%s) g:%s loops:%d not multicast. ??! warning", interf, r.mapIPtoNetAddr[g], loops))
+				r.log.Warn("recvIGMP not multicast", "iface", interf, "group", r.mapIPtoNetAddr[g], "loop", loops, "dst", cm.Dst)
 			}
 		}
 
-		// check this is not from our own interface IP
-		if reflect.DeepEqual(src, r.NetIP[interf]) {
-			debugLog(r.debugLevel > 10, fmt.Sprintf(
-				"recvIGMP(%s) g:%s loops:%d src:%s is ourself:%s. Ignoring", interf, r.mapIPtoNetAddr[g], loops, src.String(), r.NetIP[interf].String()))
-			r.pCrecvIGMP.WithLabelValues("srcSelf", interf.String(), r.mapIPtoNetAddr[g].String(), "ignore").Inc()
-
-			bytePool.Put(buf)
-			continue
-		}
-
-		//------------------
-		// Validate destination IP is correct
 		dstAddr, err := r.netip2Addr(cm.Dst)
 		if err != nil {
-			log.Fatal(fmt.Sprintf("recvIGMP(%s) g:%s loops:%d mapNetAddrtoIP err:", interf, r.mapIPtoNetAddr[g], loops), err)
+			if r.debugOn() {
+				r.log.Debug("recvIGMP netip2Addr(cm.Dst). Ignoring", "iface", interf, "group", r.mapIPtoNetAddr[g], "loop", loops, "err", err)
+			}
 			r.pCrecvIGMP.WithLabelValues("netip2Addr", interf.String(), r.mapIPtoNetAddr[g].String(), "error").Inc()
-		}
-
-		if dstAddr != r.mapIPtoNetAddr[g] {
-			debugLog(r.debugLevel > 100, fmt.Sprintf("recvIGMP(%s) g:%s loops:%d Packet not for our multicast group. Ignoring", interf, r.mapIPtoNetAddr[g], loops))
-			r.pCrecvIGMP.WithLabelValues("dstAddr", interf.String(), r.mapIPtoNetAddr[g].String(), "ignore").Inc()
+			r.notifyDrop(interf, DropNotOurGroup, cm.Src, err)
 			bytePool.Put(buf)
 			continue
 		}
 
-		//------------------
-		// Validate this is IGMP and it's the correct type of IGMP
-
-		// type IGMPType uint8
-
-		// const (
-		// 	IGMPMembershipQuery    IGMPType = 0x11 // General or group specific query
-		// 	IGMPMembershipReportV1 IGMPType = 0x12 // Version 1 Membership Report
-		// 	IGMPMembershipReportV2 IGMPType = 0x16 // Version 2 Membership Report
-		// 	IGMPLeaveGroup         IGMPType = 0x17 // Leave Group
-		// 	IGMPMembershipReportV3 IGMPType = 0x22 // Version 3 Membership Report
-		// )
-		// https://github.com/randomizedcoder/gopacket/blob/master/layers/igmp.go#L18C1-L27C2
-
-		igmpType := layers.IGMPType((*buf)[0])
-		debugLog(r.debugLevel > 10, fmt.Sprintf("recvIGMP(%s) g:%s loops:%d type:%s", interf, r.mapIPtoNetAddr[g], loops, igmpType))
-		r.pC.WithLabelValues("recvIGMP", igmpType.String(), "count").Inc()
-
-		// https://pkg.go.dev/github.com/tsg/gopacket#hdr-Basic_Usage
-		// https://github.com/randomizedcoder/gopacket/blob/master/layers/igmp.go#L224
-		packet := gopacket.NewPacket(*buf, layers.LayerTypeIGMP, gopacket.Default)
-
-		igmpLayer := packet.Layer(layers.LayerTypeIGMP)
-		if igmpLayer == nil {
-			debugLog(r.debugLevel > 10, fmt.Sprintf("recvIGMP(%s) g:%s loops:%d This isn't deserializing to IGMP.  Ignoring", interf, r.mapIPtoNetAddr[g], loops))
-			r.pCrecvIGMP.WithLabelValues("deserializing", interf.String(), r.mapIPtoNetAddr[g].String(), "error").Inc()
+		if hdr != nil && !r.validHeader(interf, g, cm.Src, *hdr, payload) {
 			bytePool.Put(buf)
 			continue
 		}
 
-		switch igmpType {
+		r.handleIGMP(interf, g, loops, cm.Src, dstAddr, payload)
+
+		bytePool.Put(buf)
+
+		r.pHrecvIGMP.WithLabelValues("sincePacketStartTime", interf.String(), r.mapIPtoNetAddr[g].String(), "counter").Observe(time.Since(packetStartTime).Seconds())
+		r.pHrecvIGMP.WithLabelValues("sinceLoopStartTime", interf.String(), r.mapIPtoNetAddr[g].String(), "counter").Observe(time.Since(loopStartTime).Seconds())
+
+	}
+}
 
-		case layers.IGMPMembershipQuery:
-			r.pCrecvIGMP.WithLabelValues("IGMPMembershipQuery", interf.String(), r.mapIPtoNetAddr[g].String(), "counter").Inc()
+// readIGMP reads from the multicast socket, or with HeaderValidation from the raw socket, which has the IP header
+// hdr is nil without HeaderValidation
+func (r IGMPReporter) readIGMP(interf side, g destIP, b []byte) (payload []byte, cm *ipv4.ControlMessage, src net.Addr, hdr *igmpHeader, err error) {
+
+	if raw := r.recvRaw[interf][r.mapIPtoNetAddr[g]]; raw != nil {
+		h, p, cm, err := raw.ReadFrom(b)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		ih := igmpHeaderOf(h)
+		return p, cm, &net.IPAddr{IP: h.Src}, &ih, nil
+	}
 
-			srcIP, err := r.netip2Addr(cm.Src)
-			if err != nil {
-				r.pCrecvIGMP.WithLabelValues("srcNetip2Addr", interf.String(), r.mapIPtoNetAddr[g].String(), "error").Inc()
+	n, cm, src, err := r.mConIGMP[interf][r.mapIPtoNetAddr[g]].ReadFrom(b)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return b[:n], cm, src, nil, nil
+}
+
+// handleIGMP is the receive pipeline for a single IGMP payload, after it has been read from the socket.
+// It is split from recvIGMP so that ReplayPcap can feed captured packets through the same path.
+func (r IGMPReporter) handleIGMP(interf side, g destIP, loops int, src net.IP, dstAddr netip.Addr, payload []byte) {
+
+	//------------------
+	// Ignore traffic on the non-active outside interface
+	if r.AltOutExists {
+		if r.ignoreOnNonActiveOutOrAltInterface(&interf) {
+			if loops%ignoreNonActiveInterfaceModulusCst == 0 {
+				if r.debugOn() {
+					r.log.Debug("recvIGMP ignoring on non active outside interface", "iface", interf, "group", r.mapIPtoNetAddr[g], "loop", loops)
+				}
 			}
-			r.querierSourceIP = srcIP
-
-			if r.conf.QueryNotify {
-				select {
-				case r.QueryNotifyCh <- struct{}{}:
-					r.pCrecvIGMP.WithLabelValues("QueryNotifyCh", interf.String(), r.mapIPtoNetAddr[g].String(), "counter").Inc()
-					debugLog(r.debugLevel > 10, fmt.Sprintf("recvIGMP(%s) g:%s loops:%d QueryNotifyCh <- struct{}{}", interf, r.mapIPtoNetAddr[g], loops))
-				default:
-					r.pCrecvIGMP.WithLabelValues("QueryNotifyCh", interf.String(), r.mapIPtoNetAddr[g].String(), "error").Inc()
-					debugLog(r.debugLevel > 10, fmt.Sprintf("recvIGMP(%s) g:%s loops:%d QueryNotifyCh failed.  Channel full?  Is something reading from the channel?", interf, r.mapIPtoNetAddr[g], loops))
+			// the querier selection needs to know the queries are still arriving on the non-active interface,
+			// and the static joins pinned to the non-active interface are still answered
+			if (r.conf.OutSelection.Mode == OutSelectQuerier || r.static != nil) && len(payload) > 0 && layers.IGMPType(payload[0]) == layers.IGMPMembershipQuery {
+				if msg, err := DecodeIGMP(payload); err == nil && msg.Type == layers.IGMPMembershipQuery && !src.Equal(r.NetIP[interf]) {
+					if r.conf.OutSelection.Mode == OutSelectQuerier {
+						r.recordQuery(interf, g, src)
+					}
+					r.answerStaticJoins(interf, msg)
 				}
 			}
+			r.notifyDrop(interf, DropNonActiveInterface, src, nil)
+			return
+		}
+	}
 
-		case layers.IGMPMembershipReportV2:
-			r.pCrecvIGMP.WithLabelValues("IGMPMembershipReportV2", interf.String(), r.mapIPtoNetAddr[g].String(), "counter").Inc()
+	// check this is not from our own interface IP
+	if src.Equal(r.NetIP[interf]) {
+		if r.debugOn() {
+			r.log.Debug("recvIGMP src is ourself. Ignoring", "iface", interf, "group", r.mapIPtoNetAddr[g], "loop", loops, "src", src)
+		}
+		r.pCrecvIGMP.WithLabelValues("srcSelf", interf.String(), r.mapIPtoNetAddr[g].String(), "ignore").Inc()
+		r.notifyDrop(interf, DropSelf, src, nil)
+		return
+	}
 
-			igmpv1or2, okC := igmpLayer.(*layers.IGMPv1or2)
-			if !okC {
-				debugLog(r.debugLevel > 10, fmt.Sprintf("recvIGMP(%s) g:%s loops:%d type cast error igmpLayer.(*layers.IGMPv1or2)", interf, r.mapIPtoNetAddr[g], loops))
-				r.pC.WithLabelValues("recvIGMP", "cast", "error").Inc()
-			}
+	//------------------
+	// Validate destination IP is correct
+	if dstAddr != r.mapIPtoNetAddr[g] {
+		if r.traceOn() {
+			r.trace("recvIGMP packet not for our multicast group. Ignoring", "iface", interf, "group", r.mapIPtoNetAddr[g], "loop", loops, "dst", dstAddr)
+		}
+		r.pCrecvIGMP.WithLabelValues("dstAddr", interf.String(), r.mapIPtoNetAddr[g].String(), "ignore").Inc()
+		r.notifyDrop(interf, DropNotOurGroup, src, nil)
+		return
+	}
 
-			na, err := r.netip2Addr(igmpv1or2.GroupAddress)
-			if err != nil {
-				log.Fatal("recvIGMP netip2Addr(sa) err", err)
-			}
+	//------------------
+	// Validate this is IGMP and it's the correct type of IGMP
 
-			var mi MembershipItem
-			mi.Group = na
-			mitems := []MembershipItem{mi}
-
-			if r.conf.MembershipReportsFromNetwork {
-				select {
-				case r.MembershipReportFromNetworkCh <- mitems:
-					r.pCrecvIGMP.WithLabelValues("MembershipReportFromNetworkCh", interf.String(), r.mapIPtoNetAddr[g].String(), "counter").Inc()
-					debugLog(r.debugLevel > 10, fmt.Sprintf("recvIGMP(%s) g:%s loops:%d MembershipReportFromNetworkCh", interf, r.mapIPtoNetAddr[g], loops))
-				default:
-					r.pCrecvIGMP.WithLabelValues("MembershipReportFromNetworkCh", interf.String(), r.mapIPtoNetAddr[g].String(), "error").Inc()
-					debugLog(r.debugLevel > 10, fmt.Sprintf("recvIGMP(%s) g:%s loops:%d MembershipReportFromNetworkCh failed.  Channel full?  Is something reading from the channel?", interf, r.mapIPtoNetAddr[g], loops))
-				}
+	// type IGMPType uint8
+
+	// const (
+	// 	IGMPMembershipQuery    IGMPType = 0x11 // General or group specific query
+	// 	IGMPMembershipReportV1 IGMPType = 0x12 // Version 1 Membership Report
+	// 	IGMPMembershipReportV2 IGMPType = 0x16 // Version 2 Membership Report
+	// 	IGMPLeaveGroup         IGMPType = 0x17 // Leave Group
+	// 	IGMPMembershipReportV3 IGMPType = 0x22 // Version 3 Membership Report
+	// )
+	// https://github.com/randomizedcoder/gopacket/blob/master/layers/igmp.go#L18C1-L27C2
+
+	msg, err := DecodeIGMP(payload)
+	if err != nil {
+		if r.debugOn() {
+			r.log.Debug("recvIGMP DecodeIGMP. Ignoring", "iface", interf, "group", r.mapIPtoNetAddr[g], "loop", loops, "src", src, "err", err)
+		}
+		r.pCrecvIGMP.WithLabelValues("deserializing", interf.String(), r.mapIPtoNetAddr[g].String(), "error").Inc()
+		r.notifyDrop(interf, DropDecode, src, err)
+		return
+	}
+
+	if r.debugOn() {
+		r.log.Debug("recvIGMP", "iface", interf, "group", r.mapIPtoNetAddr[g], "loop", loops, "src", src, "type", msg.Type)
+	}
+	r.pC.WithLabelValues("recvIGMP", msg.Type.String(), "count").Inc()
+
+	// the outside reports that are not proxied are only passed on, so like the policy, SSM doesn't apply
+	if r.policyApplies(interf) {
+		var verdict ssmVerdict
+		msg, payload, verdict = r.ssmCheck(interf, src, msg, payload)
+		switch verdict {
+		case ssmReject:
+			if r.debugOn() {
+				r.log.Debug("recvIGMP rejected by SSM. Ignoring", "iface", interf, "group", r.mapIPtoNetAddr[g], "loop", loops, "src", src, "type", msg.Type)
 			}
+			r.pCrecvIGMP.WithLabelValues("ssm", interf.String(), r.mapIPtoNetAddr[g].String(), "reject").Inc()
+			return
+		case ssmMapped, ssmFiltered:
+			// the IGMPv3 report is sent to 224.0.0.22
+			g = IGMPHosts
+		}
+	}
 
-		case layers.IGMPMembershipReportV3:
+	if r.policyApplies(interf) && !r.policyAllowsMessage(interf, src, msg) {
+		if r.debugOn() {
+			r.log.Debug("recvIGMP denied by policy. Ignoring", "iface", interf, "group", r.mapIPtoNetAddr[g], "loop", loops, "src", src, "type", msg.Type)
+		}
+		r.pCrecvIGMP.WithLabelValues("policy", interf.String(), r.mapIPtoNetAddr[g].String(), "deny").Inc()
+		r.notifyDrop(interf, DropPolicy, src, nil)
+		return
+	}
 
-			igmp, ok := igmpLayer.(*layers.IGMP)
-			if !ok {
-				debugLog(r.debugLevel > 10, fmt.Sprintf("recvIGMP(%s) g:%s loops:%d type cast error igmpLayer.(*layers.IGMP)", interf, r.mapIPtoNetAddr[g], loops))
-				r.pCrecvIGMP.WithLabelValues("typeCast", interf.String(), r.mapIPtoNetAddr[g].String(), "error").Inc()
-				bytePool.Put(buf)
-				continue
+	if interf == IN {
+		if err := r.admit(interf, src, msg); err != nil {
+			if r.debugOn() {
+				r.log.Debug("recvIGMP limit exceeded. Ignoring", "iface", interf, "group", r.mapIPtoNetAddr[g], "loop", loops, "src", src, "err", err)
 			}
+			r.pCrecvIGMP.WithLabelValues("limit", interf.String(), r.mapIPtoNetAddr[g].String(), "drop").Inc()
+			return
+		}
+	}
 
-			mitems := r.IGMPv3GroupRecordsToMembershipItem(igmp.GroupRecords)
+	switch msg.Type {
 
-			if r.conf.MembershipReportsFromNetwork {
-				select {
-				case r.MembershipReportFromNetworkCh <- mitems:
-					r.pCrecvIGMP.WithLabelValues("MembershipReportFromNetworkCh", interf.String(), r.mapIPtoNetAddr[g].String(), "counter").Inc()
-					debugLog(r.debugLevel > 10, fmt.Sprintf("recvIGMP(%s) g:%s loops:%d MembershipReportFromNetworkCh", interf, r.mapIPtoNetAddr[g], loops))
-				default:
-					r.pCrecvIGMP.WithLabelValues("MembershipReportFromNetworkCh", interf.String(), r.mapIPtoNetAddr[g].String(), "error").Inc()
-					debugLog(r.debugLevel > 10, fmt.Sprintf("recvIGMP(%s) g:%s loops:%d MembershipReportFromNetworkCh failed.  Channel full?  Is something reading from the channel?", interf, r.mapIPtoNetAddr[g], loops))
-				}
+	case layers.IGMPMembershipQuery:
+		r.pCrecvIGMP.WithLabelValues("IGMPMembershipQuery", interf.String(), r.mapIPtoNetAddr[g].String(), "counter").Inc()
+
+		srcIP := r.recordQuery(interf, g, src)
+
+		if r.observing() {
+			ev := QueryEvent{Event: r.event(interf), Querier: srcIP, Group: msg.Group, Version: msg.Version}
+			if ev.Group.IsUnspecified() {
+				ev.Group = netip.Addr{}
 			}
-		//case layers.IGMPLeaveGroup:
-		// TODO handle leave
+			r.notify(func(o Observer) { o.OnQuery(ev) })
+		}
 
-		default:
-			r.pCrecvIGMP.WithLabelValues("WrongType", interf.String(), r.mapIPtoNetAddr[g].String(), "error").Inc()
-			debugLog(r.debugLevel > 10, fmt.Sprintf("recvIGMP(%s) g:%s loops:%d This shouldn't happen.  Bug?", interf, r.mapIPtoNetAddr[g], loops))
+		r.answerStaticJoins(interf, msg)
 
+		if r.conf.QueryNotify {
+			res := sendWithPolicy(r.QueryNotifyCh, struct{}{}, r.conf.QueryNotifyPolicy, nil)
+			r.channelSendResult(interf, g, loops, src, "QueryNotifyCh", res, errQueryNotifyChFull)
 		}
 
-		if r.proxyIt(interf) {
-			r.pCrecvIGMP.WithLabelValues("proxyIt", interf.String(), r.mapIPtoNetAddr[g].String(), "counter").Inc()
-			r.pCrecvIGMP.WithLabelValues("proxyIt", interf.String(), r.mapIPtoNetAddr[g].String(), "bytes").Add(float64(len(*buf)))
+	case layers.IGMPMembershipReportV2, layers.IGMPMembershipReportV3:
+		r.pCrecvIGMP.WithLabelValues(msgTypeLabel(msg.Type), interf.String(), r.mapIPtoNetAddr[g].String(), "counter").Inc()
+		r.countGroups(interf, netIPToAddr(src), msg)
 
-			out, ok := r.IntOutName.Load(interf)
-			if !ok {
-				debugLog(r.debugLevel > 10, fmt.Sprintf("recvIGMP(%s) Load !ok", interf))
-				r.pC.WithLabelValues("recvIGMP", "Load", "error").Inc()
-				bytePool.Put(buf)
-				continue
+		if r.observing() {
+			ev := ReportEvent{Event: r.event(interf), Src: netIPToAddr(src), Type: msg.Type, Items: msg.MembershipItems}
+			r.notify(func(o Observer) { o.OnReport(ev) })
+		}
+
+		if r.conf.MembershipReportsFromNetwork {
+			res := sendWithPolicy(r.MembershipReportFromNetworkCh, msg.MembershipItems, r.conf.MembershipReportsPolicy, mergeMembershipItems)
+			r.channelSendResult(interf, g, loops, src, "MembershipReportFromNetworkCh", res, errMembershipReportFromNetworkChFull)
+		}
+
+	case layers.IGMPLeaveGroup:
+		r.pCrecvIGMP.WithLabelValues(msgTypeLabel(msg.Type), interf.String(), r.mapIPtoNetAddr[g].String(), "counter").Inc()
+		r.countGroups(interf, netIPToAddr(src), msg)
+
+		if r.observing() {
+			ev := LeaveEvent{Event: r.event(interf), Src: netIPToAddr(src), Items: msg.MembershipItems}
+			r.notify(func(o Observer) { o.OnLeave(ev) })
+		}
+
+	default:
+		r.pCrecvIGMP.WithLabelValues("WrongType", interf.String(), r.mapIPtoNetAddr[g].String(), "error").Inc()
+		if r.debugOn() {
+			r.log.Debug("recvIGMP unexpected type", "iface", interf, "group", r.mapIPtoNetAddr[g], "loop", loops, "type", msg.Type)
+		}
+
+	}
+
+	if r.proxyIt(interf) {
+		if interf == IN && r.static.isStaticLeave(msg) {
+			if r.debugOn() {
+				r.log.Debug("recvIGMP leave for a static join. Not proxying", "iface", interf, "group", msg.Group, "loop", loops)
 			}
-			debugLog(r.debugLevel > 10, fmt.Sprintf("recvIGMP(%s) g:%s loops:%d proxying to:%s", interf, r.mapIPtoNetAddr[g], loops, out.(side)))
+			r.pCrecvIGMP.WithLabelValues("staticLeave", interf.String(), r.mapIPtoNetAddr[g].String(), "ignore").Inc()
+			return
+		}
 
-			r.proxy(out.(side), g, buf)
+		r.pCrecvIGMP.WithLabelValues("proxyIt", interf.String(), r.mapIPtoNetAddr[g].String(), "counter").Inc()
+		r.pCrecvIGMP.WithLabelValues("proxyIt", interf.String(), r.mapIPtoNetAddr[g].String(), "bytes").Add(float64(len(payload)))
 
-			bytePool.Put(buf)
+		out, ok := r.IntOutName.Load(interf)
+		if !ok {
+			r.log.Error("recvIGMP IntOutName.Load !ok", "iface", interf)
+			r.pC.WithLabelValues("recvIGMP", "Load", "error").Inc()
+			return
 		}
 
-		r.pHrecvIGMP.WithLabelValues("sincePacketStartTime", interf.String(), r.mapIPtoNetAddr[g].String(), "counter").Observe(time.Since(packetStartTime).Seconds())
-		r.pHrecvIGMP.WithLabelValues("sinceLoopStartTime", interf.String(), r.mapIPtoNetAddr[g].String(), "counter").Observe(time.Since(loopStartTime).Seconds())
+		if r.conRaw[out.(side)] == nil {
+			// e.g. TestingOptions.ReplayOnly
+			if r.debugOn() {
+				r.log.Debug("recvIGMP no raw socket. Not proxying", "iface", interf, "group", r.mapIPtoNetAddr[g], "loop", loops, "out", out.(side))
+			}
+			r.pC.WithLabelValues("recvIGMP", "noRawConn", "ignore").Inc()
+			r.notifyDrop(out.(side), DropNoRawConn, src, nil)
+			return
+		}
+		if r.debugOn() {
+			r.log.Debug("recvIGMP proxying", "iface", interf, "group", r.mapIPtoNetAddr[g], "loop", loops, "out", out.(side))
+		}
 
+		r.proxy(out.(side), g, &payload, rateMsgFor(src, msg))
+	}
+}
+
+// recordQuery records the querier for the interface, and notifies when it changes
+func (r IGMPReporter) recordQuery(interf side, g destIP, src net.IP) (srcIP netip.Addr) {
+
+	srcIP, err := r.netip2Addr(src)
+	if err != nil {
+		r.pCrecvIGMP.WithLabelValues("srcNetip2Addr", interf.String(), r.mapIPtoNetAddr[g].String(), "error").Inc()
+	}
+
+	if old, changed := r.setQuerier(interf, srcIP); changed {
+		r.log.Info("recvIGMP querier changed", "iface", interf, "old", old, "new", srcIP)
+		r.pCrecvIGMP.WithLabelValues("querierChange", interf.String(), r.mapIPtoNetAddr[g].String(), "counter").Inc()
+		if r.observing() {
+			ev := QuerierChangeEvent{Event: r.event(interf), Old: old, New: srcIP}
+			r.notify(func(o Observer) { o.OnQuerierChange(ev) })
+		}
+	}
+
+	return srcIP
+}
+
+// channelSendResult counts the result of sending to a notification channel
+// Anything other than sendOK means the channel was full
+func (r IGMPReporter) channelSendResult(interf side, g destIP, loops int, src net.IP, name string, res sendResult, errFull error) {
+
+	if res == sendOK {
+		r.pCrecvIGMP.WithLabelValues(name, interf.String(), r.mapIPtoNetAddr[g].String(), "counter").Inc()
+		if r.debugOn() {
+			r.log.Debug("recvIGMP sent", "iface", interf, "group", r.mapIPtoNetAddr[g], "loop", loops, "channel", name)
+		}
+		return
+	}
+
+	r.pCrecvIGMP.WithLabelValues(name, interf.String(), r.mapIPtoNetAddr[g].String(), res.String()).Inc()
+	if r.debugOn() {
+		r.log.Debug("recvIGMP channel full.  Is something reading from the channel?", "iface", interf, "group", r.mapIPtoNetAddr[g], "loop", loops, "channel", name, "result", res)
+	}
+
+	if res != sendCoalesced {
+		r.notifyDrop(interf, DropChannelFull, src, errFull)
+	}
+}
+
+// msgTypeLabel returns the prometheus label recvIGMP has always used for the message type
+func msgTypeLabel(t layers.IGMPType) string {
+	switch t {
+	case layers.IGMPMembershipQuery:
+		return "IGMPMembershipQuery"
+	case layers.IGMPMembershipReportV1:
+		return "IGMPMembershipReportV1"
+	case layers.IGMPMembershipReportV2:
+		return "IGMPMembershipReportV2"
+	case layers.IGMPMembershipReportV3:
+		return "IGMPMembershipReportV3"
+	case layers.IGMPLeaveGroup:
+		return "IGMPLeaveGroup"
+	default:
+		return "unknown"
 	}
 }
 
@@ -285,7 +438,7 @@ func (r IGMPReporter) ignoreOnNonActiveOutOrAltInterface(interf *side) (ignore b
 
 		out, ok := r.IntOutName.Load(IN)
 		if !ok {
-			debugLog(r.debugLevel > 10, fmt.Sprintf("ignoreOnNonActiveOutOrAltInterface(%s) Load !ok", *interf))
+			r.log.Error("ignoreOnNonActiveOutOrAltInterface IntOutName.Load !ok", "iface", *interf)
 			r.pC.WithLabelValues("ignoreOnNonActiveOutOrAltInterface", "Load", "error").Inc()
 			ignore = true
 			return ignore
@@ -294,7 +447,9 @@ func (r IGMPReporter) ignoreOnNonActiveOutOrAltInterface(interf *side) (ignore b
 		if *interf != out.(side) {
 			ignore = true
 			r.pC.WithLabelValues("ignoreOnNonActiveOutOrAltInterface", "ignore", "count").Inc()
-			debugLog(r.debugLevel > 100, fmt.Sprintf("ignoreOnNonActiveOutOrAltInterface(%s) ignoring non-active outside interface", *interf))
+			if r.traceOn() {
+				r.trace("ignoreOnNonActiveOutOrAltInterface ignoring non-active outside interface", "iface", *interf)
+			}
 		}
 	}
 
@@ -303,7 +458,8 @@ func (r IGMPReporter) ignoreOnNonActiveOutOrAltInterface(interf *side) (ignore b
 
 // IGMPv3GroupRecordsToMembershipItem converts the real IGMP packet group memberships
 // into the internal representatino as a list of []membershipItem
-func (r IGMPReporter) IGMPv3GroupRecordsToMembershipItem(groupRecords []layers.IGMPv3GroupRecord) (mitems []MembershipItem) {
+// Malformed addresses are returned as an error, rather than crashing, because anyone can send us IGMP
+func (r IGMPReporter) IGMPv3GroupRecordsToMembershipItem(groupRecords []layers.IGMPv3GroupRecord) (mitems []MembershipItem, err error) {
 
 	startTime := time.Now()
 	defer func() {
@@ -311,28 +467,13 @@ func (r IGMPReporter) IGMPv3GroupRecordsToMembershipItem(groupRecords []layers.I
 	}()
 	r.pC.WithLabelValues("IGMPv3GroupRecordsToMembershipItem", "start", "count").Inc()
 
-	debugLog(r.debugLevel > 100, "IGMPv3GroupRecordsToMembershipItem()")
-
-	for _, gr := range groupRecords {
-		var g MembershipItem
-		for _, sa := range gr.SourceAddresses {
-			na, err := r.netip2Addr(sa)
-			if err != nil {
-				log.Fatal("recvIGMP netip2Addr(sa) err", err)
-			}
-			g.Sources = append(g.Sources, na)
-		}
-
-		na, err := r.netip2Addr(gr.MulticastAddress)
-		if err != nil {
-			log.Fatal("recvIGMP netip2Addr(sa) err", err)
-		}
-		g.Group = na
-
-		mitems = append(mitems, g)
+	mitems, err = groupRecordsToMembershipItems(groupRecords)
+	if err != nil {
+		r.pC.WithLabelValues("IGMPv3GroupRecordsToMembershipItem", "groupRecordsToMembershipItems", "error").Inc()
+		return mitems, err
 	}
 
-	debugLog(r.debugLevel > 10, fmt.Sprintf("groupRecordsToMembershipItem() len(mitems):%d", len(mitems)))
+	r.log.Debug("IGMPv3GroupRecordsToMembershipItem()", "items", len(mitems))
 
-	return mitems
+	return mitems, nil
 }
@@ -9,7 +9,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/randomizedcoder/gopacket"
 	"github.com/randomizedcoder/gopacket/layers"
 )
 
@@ -26,23 +25,24 @@ func (r IGMPReporter) recvUnicastIGMP(wg *sync.WaitGroup, ctx context.Context, i
 		log.Fatalf("recvUnicastIGMP(%s) interface IP lookup error", interf)
 	}
 
-	debugLog(r.debugLevel > 10, fmt.Sprintf("recvUnicastIGMP(%s) localIP:%s started", interf, localIP))
+	r.log.Debug("recvUnicastIGMP started", "iface", interf, "local", localIP)
 
 forLoop:
 	for loops := 0; ; loops++ {
 
 		select {
 		case <-ctx.Done():
-			debugLog(r.debugLevel > 10, fmt.Sprintf("recvIGMP(%s) loops:%d ctx.Done()", interf, loops))
+			r.log.Debug("recvUnicastIGMP ctx.Done()", "iface", interf, "loop", loops)
 			break forLoop
 		default:
-			debugLog(r.debugLevel > 100, fmt.Sprintf("recvIGMP(%s) loops:%d ctx is not cancelled", interf, loops))
 		}
 
 		loopStartTime := time.Now()
 		r.pC.WithLabelValues("recvUnicastIGMP", "loops", "counter").Inc()
 
-		debugLog(r.debugLevel > 100, fmt.Sprintf("recvUnicastIGMP(%s) localIP:%s loops:%d", interf, localIP, loops))
+		if r.traceOn() {
+			r.trace("recvUnicastIGMP loop", "iface", interf, "loop", loops)
+		}
 
 		err := r.uCon[IN].SetReadDeadline(time.Now().Add(r.conf.SocketReadDeadLine))
 		if err != nil {
@@ -53,15 +53,25 @@ forLoop:
 		n, addr, err := r.uCon[IN].ReadFrom(*buf)
 		if err != nil {
 			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
-				debugLog(r.debugLevel > 10, fmt.Sprintf("recvUnicastIGMP(%s) localIP:%s loops:%d ReadFrom timeout", interf, localIP, loops))
+				if r.debugOn() {
+					r.log.Debug("recvUnicastIGMP ReadFrom timeout", "iface", interf, "loop", loops)
+				}
 				r.pC.WithLabelValues("recvUnicastIGMP", "timeout", "counter").Inc()
 				bytePool.Put(buf)
 				continue
 			}
+			if r.debugOn() {
+				r.log.Debug("recvUnicastIGMP ReadFrom", "iface", interf, "local", localIP, "loop", loops, "err", err)
+			}
+			r.pC.WithLabelValues("recvUnicastIGMP", "ReadFrom", "error").Inc()
+			bytePool.Put(buf)
+			continue
 		}
 		packetStartTime := time.Now()
 
-		debugLog(r.debugLevel > 10, fmt.Sprintf("recvUnicastIGMP(%s) localIP:%s loops:%d n:%d, addr:%s", interf, localIP, loops, n, addr))
+		if r.debugOn() {
+			r.log.Debug("recvUnicastIGMP read", "iface", interf, "local", localIP, "loop", loops, "n", n, "src", addr)
+		}
 		r.pC.WithLabelValues("recvUnicastIGMP", "n", "counter").Add(float64(n))
 
 		//------------------
@@ -78,102 +88,224 @@ forLoop:
 		// )
 		// https://github.com/randomizedcoder/gopacket/blob/master/layers/igmp.go#L18C1-L27C2
 
-		igmpType := layers.IGMPType((*buf)[0])
-		debugLog(r.debugLevel > 10, fmt.Sprintf("recvUnicastIGMP(%s) localIP:%s loops:%d type:%s", interf, localIP, loops, igmpType))
-		r.pC.WithLabelValues("recvUnicastIGMP", igmpType.String(), "count").Inc()
+		r.handleUnicastIGMP(interf, loops, packetConnAddrIP(addr), (*buf)[:n])
 
-		// https://pkg.go.dev/github.com/tsg/gopacket#hdr-Basic_Usage
-		// https://github.com/randomizedcoder/gopacket/blob/master/layers/igmp.go#L224
-		packet := gopacket.NewPacket(*buf, layers.LayerTypeIGMP, gopacket.Default)
+		bytePool.Put(buf)
 
-		igmpLayer := packet.Layer(layers.LayerTypeIGMP)
-		if igmpLayer == nil {
-			debugLog(r.debugLevel > 10, fmt.Sprintf("recvUnicastIGMP(%s) localIP:%s loops:%d This isn't deserializing to IGMP.  Ignoring", interf, localIP, loops))
-			r.pC.WithLabelValues("recvUnicastIGMP", "deserializing", "error").Inc()
-			bytePool.Put(buf)
-			continue
+		r.pH.WithLabelValues("recvUnicastIGMP", "sincePacketStartTime", "counter").Observe(time.Since(packetStartTime).Seconds())
+		r.pH.WithLabelValues("recvUnicastIGMP", "sinceLoopStartTime", "counter").Observe(time.Since(loopStartTime).Seconds())
+
+	}
+}
+
+// handleUnicastIGMP is the pipeline for a single unicast IGMP payload from the inside
+// It is split from recvUnicastIGMP so the UDP encapsulated memberships go through the same checks
+func (r IGMPReporter) handleUnicastIGMP(interf side, loops int, src net.IP, payload []byte) {
+
+	if !r.unicastClientAllowed(interf, src) {
+		return
+	}
+
+	msg, err := DecodeIGMP(payload)
+	if err != nil {
+		if r.debugOn() {
+			r.log.Debug("recvUnicastIGMP DecodeIGMP. Ignoring", "iface", interf, "loop", loops, "src", src, "err", err)
 		}
+		r.pC.WithLabelValues("recvUnicastIGMP", "deserializing", "error").Inc()
+		r.notifyDrop(interf, DropDecode, src, err)
+		return
+	}
 
-		// outside interface can change between ethernet/GRE
-		o, ok := r.IntOutName.Load(interf)
-		if !ok {
-			debugLog(r.debugLevel > 10, fmt.Sprintf("recvUnicastIGMP(%s) Load !ok", interf))
-			r.pC.WithLabelValues("recvUnicastIGMP", "Load", "error").Inc()
-			bytePool.Put(buf)
-			continue
+	if r.debugOn() {
+		r.log.Debug("recvUnicastIGMP", "iface", interf, "loop", loops, "src", src, "type", msg.Type)
+	}
+	r.pC.WithLabelValues("recvUnicastIGMP", msg.Type.String(), "count").Inc()
+
+	var verdict ssmVerdict
+	msg, payload, verdict = r.ssmCheck(interf, src, msg, payload)
+	if verdict == ssmReject {
+		if r.debugOn() {
+			r.log.Debug("recvUnicastIGMP rejected by SSM. Ignoring", "iface", interf, "loop", loops, "src", src, "type", msg.Type)
+		}
+		return
+	}
+
+	if msg.Type == layers.IGMPMembershipReportV3 {
+		m, p, ok, errV3 := r.unicastV3Records(interf, src, msg)
+		if errV3 != nil {
+			r.log.Warn("recvUnicastIGMP unicastV3Records", "iface", interf, "loop", loops, "src", src, "err", errV3)
+			r.pC.WithLabelValues("recvUnicastIGMP", "unicastV3Records", "error").Inc()
+			return
 		}
-		out, ok := o.(side)
 		if !ok {
-			debugLog(r.debugLevel > 10, fmt.Sprintf("recvUnicastIGMP(%s) localIP:%s loops:%d o.(side) type cast error", interf, localIP, loops))
-			continue
+			if r.debugOn() {
+				r.log.Debug("recvUnicastIGMP no IGMPv3 records left. Ignoring", "iface", interf, "loop", loops, "src", src)
+			}
+			r.pC.WithLabelValues("recvUnicastIGMP", "policy", "deny").Inc()
+			r.notifyDrop(interf, DropPolicy, src, nil)
+			return
+		}
+		msg, payload = m, p
+	} else if !r.unicastClientAllowsMessage(interf, src, msg) {
+		r.pC.WithLabelValues("recvUnicastIGMP", "clientGroup", "deny").Inc()
+		return
+	} else if !r.policyAllowsMessage(interf, src, msg) {
+		if r.debugOn() {
+			r.log.Debug("recvUnicastIGMP denied by policy. Ignoring", "iface", interf, "loop", loops, "src", src, "type", msg.Type)
+		}
+		r.pC.WithLabelValues("recvUnicastIGMP", "policy", "deny").Inc()
+		r.notifyDrop(interf, DropPolicy, src, nil)
+		return
+	}
+
+	// outside interface can change between ethernet/GRE
+	o, ok := r.IntOutName.Load(interf)
+	if !ok {
+		r.log.Error("recvUnicastIGMP IntOutName.Load !ok", "iface", interf)
+		r.pC.WithLabelValues("recvUnicastIGMP", "Load", "error").Inc()
+		return
+	}
+	out, ok := o.(side)
+	if !ok {
+		r.log.Error("recvUnicastIGMP o.(side) type cast error", "iface", interf, "loop", loops)
+		r.pC.WithLabelValues("recvUnicastIGMP", "typeCast", "error").Inc()
+		return
+	}
+
+	if err := r.admit(interf, src, msg); err != nil {
+		if r.debugOn() {
+			r.log.Debug("recvUnicastIGMP limit exceeded. Ignoring", "iface", interf, "loop", loops, "src", src, "err", err)
 		}
+		return
+	}
 
-		// For type1/2 we need to decode to find the group address
-		switch igmpType {
+	r.notifyUnicast(interf, msg, src)
 
-		//case layers.IGMPMembershipQuery:
-		//TODO implment this
+	action := unicastActionFor(msg)
 
-		case layers.IGMPMembershipReportV1:
-			r.sendIGMPv1or2(interf, loops, out, igmpLayer, buf)
+	if action != unicastQuery && r.conRaw[out] == nil {
+		// e.g. TestingOptions.ReplayOnly
+		r.pC.WithLabelValues("recvUnicastIGMP", "noRawConn", "ignore").Inc()
+		r.notifyDrop(out, DropNoRawConn, src, nil)
+		return
+	}
 
-		case layers.IGMPMembershipReportV2:
-			r.sendIGMPv1or2(interf, loops, out, igmpLayer, buf)
+	// For type1/2 we need to decode to find the group address
+	switch action {
 
-		case layers.IGMPMembershipReportV3:
-			r.sendIGMPv3(interf, loops, out, buf)
+	case unicastQuery:
+		r.unicastQuery(interf, src, msg, &payload, rateMsgFor(src, msg))
 
-		case layers.IGMPLeaveGroup:
-			r.sendIGMPLeave(interf, loops, out, buf)
+	case unicastToGroup:
+		r.sendIGMPv1or2(interf, loops, out, msg, &payload, rateMsgFor(src, msg))
 
-		default:
-			debugLog(r.debugLevel > 10, fmt.Sprintf("recvUnicastIGMP(%s) localIP:%s loops:%d unexpected igmp.Type", interf, localIP, loops))
-			r.pC.WithLabelValues("recvUnicastIGMP", "unexpectedIgmpType", "error").Inc()
+	case unicastToIGMPHosts:
+		r.sendIGMPv3(interf, loops, out, &payload, rateMsgFor(src, msg))
+
+	case unicastToAllRouters:
+		if r.static.isStaticLeave(msg) {
+			r.pC.WithLabelValues("recvUnicastIGMP", "staticLeave", "ignore").Inc()
+			break
 		}
+		r.sendIGMPLeave(interf, loops, out, &payload, rateMsgFor(src, msg))
 
-		r.pH.WithLabelValues("recvUnicastIGMP", "sincePacketStartTime", "counter").Observe(time.Since(packetStartTime).Seconds())
-		r.pH.WithLabelValues("recvUnicastIGMP", "sinceLoopStartTime", "counter").Observe(time.Since(loopStartTime).Seconds())
+	default:
+		if r.debugOn() {
+			r.log.Debug("recvUnicastIGMP unexpected type", "iface", interf, "loop", loops, "src", src, "type", msg.Type)
+		}
+		r.pC.WithLabelValues("recvUnicastIGMP", "unexpectedIgmpType", "error").Inc()
+		r.notifyDrop(interf, DropUnexpectedType, src, nil)
+	}
+}
 
+// notifyUnicast tells the observers and the group metrics about the reports and leaves received on the unicast socket
+func (r IGMPReporter) notifyUnicast(interf side, msg IGMPMessage, src net.IP) {
+	r.countGroups(interf, netIPToAddr(src), msg)
+	if !r.observing() {
+		return
+	}
+	switch msg.Type {
+	case layers.IGMPMembershipReportV1, layers.IGMPMembershipReportV2, layers.IGMPMembershipReportV3:
+		ev := ReportEvent{Event: r.event(interf), Src: netIPToAddr(src), Type: msg.Type, Items: msg.MembershipItems, Unicast: true}
+		r.notify(func(o Observer) { o.OnReport(ev) })
+	case layers.IGMPLeaveGroup:
+		ev := LeaveEvent{Event: r.event(interf), Src: netIPToAddr(src), Items: msg.MembershipItems, Unicast: true}
+		r.notify(func(o Observer) { o.OnLeave(ev) })
 	}
 }
 
-// sendIGMPv1or2 needs to send to the multicast destination, so it decodes the payload to find the group
-func (r IGMPReporter) sendIGMPv1or2(interf side, loops int, out side, igmpLayer gopacket.Layer, buf *[]byte) {
+// packetConnAddrIP returns the IP of the "ip4:igmp" socket peer address
+func packetConnAddrIP(addr net.Addr) net.IP {
+	if a, ok := addr.(*net.IPAddr); ok {
+		return a.IP
+	}
+	return nil
+}
 
-	igmpv1or2, ok := igmpLayer.(*layers.IGMPv1or2)
-	if !ok {
-		debugLog(r.debugLevel > 10, fmt.Sprintf("recvUnicastIGMP(%s) loops:%d sendIGMPv1or2 igmpLayer.(*layers.IGMPv1or2) type cast error", interf, loops))
+type unicastAction int
+
+const (
+	unicastIgnore unicastAction = iota
+	unicastToGroup
+	unicastToIGMPHosts
+	unicastToAllRouters
+	unicastQuery
+)
+
+// unicastActionFor decides how a decoded unicast IGMP message is translated to multicast
+// - v1/v2 reports go to the group being reported
+// - v3 reports go to 224.0.0.22
+// - leaves go to 224.0.0.2
+// - queries are translated or answered, see UnicastQueryMode
+func unicastActionFor(msg IGMPMessage) unicastAction {
+	switch msg.Type {
+	case layers.IGMPMembershipQuery:
+		return unicastQuery
+	case layers.IGMPMembershipReportV1, layers.IGMPMembershipReportV2:
+		if msg.Group.IsMulticast() {
+			return unicastToGroup
+		}
+	case layers.IGMPMembershipReportV3:
+		return unicastToIGMPHosts
+	case layers.IGMPLeaveGroup:
+		return unicastToAllRouters
 	}
+	return unicastIgnore
+}
 
-	debugLog(r.debugLevel > 10, fmt.Sprintf("recvUnicastIGMP(%s) loops:%d sendIGMPv1or2 proxyUniToMultiv1or2 to:%s", interf, loops, out))
+// sendIGMPv1or2 needs to send to the multicast destination, so it decodes the payload to find the group
+func (r IGMPReporter) sendIGMPv1or2(interf side, loops int, out side, msg IGMPMessage, buf *[]byte, rm rateMsg) {
+
+	if r.debugOn() {
+		r.log.Debug("recvUnicastIGMP sendIGMPv1or2 proxyUniToMultiv1or2", "iface", interf, "loop", loops, "out", out, "group", msg.Group)
+	}
 
-	r.proxyUniToMultiv1or2(out, igmpv1or2.GroupAddress, buf)
+	r.proxyUniToMultiv1or2(out, msg.Group.AsSlice(), buf, rm)
 }
 
 // sendIGMPv3 is more simple, and just sends to the IGMPv3 destination 224.0.0.22
-func (r IGMPReporter) sendIGMPv3(interf side, loops int, out side, buf *[]byte) {
+func (r IGMPReporter) sendIGMPv3(interf side, loops int, out side, buf *[]byte, rm rateMsg) {
 
 	var dest destIP
 	if r.conf.UnicastMembershipReports {
-		debugLog(r.debugLevel > 10, fmt.Sprintf("recvUnicastIGMP(%s) loops:%d sendIGMPv3 UnicastMembershipReports dest = QueryHost", interf, loops))
 		dest = QueryHost
 	} else {
-		debugLog(r.debugLevel > 10, fmt.Sprintf("recvUnicastIGMP(%s) loops:%d sendIGMPv3 dest = IGMPHosts", interf, loops))
 		dest = IGMPHosts
 	}
 
-	debugLog(r.debugLevel > 10, fmt.Sprintf("recvUnicastIGMP(%s) loops:%d sendIGMPv3 proxying to:%s", interf, loops, out))
-
-	r.proxy(out, dest, buf)
-
-	bytePool.Put(buf)
+	if r.debugOn() {
+		r.log.Debug("recvUnicastIGMP sendIGMPv3 proxying", "iface", interf, "loop", loops, "out", out, "dest", dest)
+	}
 
+	r.proxy(out, dest, buf, rm)
 }
 
 // sendIGMPv1or2 needs to send to the multicast destination, so it decodes the payload to find the group
-func (r IGMPReporter) sendIGMPLeave(interf side, loops int, out side, buf *[]byte) {
+func (r IGMPReporter) sendIGMPLeave(interf side, loops int, out side, buf *[]byte, rm rateMsg) {
 
-	debugLog(r.debugLevel > 10, fmt.Sprintf("recvUnicastIGMP(%s) loops:%d sendIGMPLeave proxyUniToMultiv1or2 to:%s", interf, loops, out))
+	if r.debugOn() {
+		r.log.Debug("recvUnicastIGMP sendIGMPLeave proxyUniToMultiv1or2", "iface", interf, "loop", loops, "out", out)
+	}
 
-	r.proxyUniToMultiv1or2(out, net.IPv4allrouter, buf)
+	r.proxyUniToMultiv1or2(out, net.IPv4allrouter, buf, rm)
 }
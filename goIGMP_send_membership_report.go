@@ -24,73 +24,110 @@ func (r IGMPReporter) sendMembershipReport(interf side, membershipItems []Member
 	}()
 	r.pC.WithLabelValues("sendMembershipReport", "start", "count").Inc()
 
-	debugLog(r.debugLevel > 10, fmt.Sprintf("sendMembershipReport(%s) start", interf))
+	r.log.Debug("sendMembershipReport() start", "iface", interf, "items", len(membershipItems))
 
-	for i, membershipItem := range membershipItems {
-
-		debugLog(r.debugLevel > 10, fmt.Sprintf("sendMembershipReport(%s) i:%d, membershipItem:%v", interf, i, membershipItem))
+	// client mode, the proxy sends the IGMP and MLD
+	if r.udpClient != nil {
+		r.sendUDPEncap("sendMembershipReport", false, membershipItems)
+		return
+	}
 
-		buffer := gopacket.NewSerializeBuffer()
-		options := gopacket.SerializeOptions{
-			ComputeChecksums: true,
-			FixLengths:       true,
-		}
+	membershipItems, mld := splitMLD(membershipItems)
+	if len(mld) > 0 {
+		r.sendMLDReport(interf, mld)
+	}
 
-		g, errN := addr2NetIP(membershipItem.Group)
-		if errN != nil {
-			log.Fatalf("sendMembershipReport(%s) addr2NetIP(%s) err:%v", interf, membershipItem.Group, errN)
-		}
+	for i, membershipItem := range membershipItems {
 
-		igmp := layers.IGMPv1or2{
-			Type:            layers.IGMPMembershipReportV2,
-			MaxResponseTime: MaxResponseTimeCst,
-			GroupAddress:    g,
-			Version:         2,
+		if r.debugOn() {
+			r.log.Debug("sendMembershipReport()", "iface", interf, "i", i, "group", membershipItem.Group, "sources", membershipItem.Sources)
 		}
 
-		//err := gopacket.SerializeLayers(buffer, options, r.pbp.ethernetLayer, r.pbp.ipLayer, igmp)
-		err := gopacket.SerializeLayers(buffer, options, &igmp)
-		if err != nil {
-			log.Fatal(fmt.Sprintf("sendMembershipReport(%s) SerializeLayers err:", interf), err)
+		igmpPayload, errP := reportPayload(membershipItem)
+		if errP != nil {
+			r.log.Warn("sendMembershipReport() reportPayload", "iface", interf, "group", membershipItem.Group, "err", errP)
+			r.pC.WithLabelValues("sendMembershipReport", "reportPayload", "error").Inc()
+			continue
 		}
 
-		igmpPayload := buffer.Bytes()
-
 		var dest destIP
 		if r.conf.UnicastMembershipReports {
-			debugLog(r.debugLevel > 10, fmt.Sprintf("sendMembershipReport(%s) UnicastMembershipReports dest = QueryHost", interf))
 			dest = QueryHost
 		} else {
 			dest = IGMPHosts
 		}
 
-		iph := r.ipv4Header(len(igmpPayload), dest)
+		iph := r.ipv4Header(interf, len(igmpPayload), dest)
+
+		if r.debugOn() {
+			r.log.Debug("sendMembershipReport()", "iface", interf, "iph", iph)
+		}
 
-		if r.debugLevel > 10 {
-			debugLog(r.debugLevel > 10, fmt.Sprintf("sendMembershipReport(%s) iph:%v", interf, iph))
+		// the generated reports have no host, and are coalesced by group
+		if r.rateLimited(pendingMsg{fn: "sendMembershipReport", interf: interf, dst: iph.Dst, payload: igmpPayload}, rateMsg{key: "g" + membershipItem.Group.String()}) {
+			continue
 		}
 
 		errSWD := r.conRaw[interf].SetWriteDeadline(time.Now().Add(writeDeadlineCst))
 		if errSWD != nil {
 			log.Fatal(fmt.Sprintf("sendMembershipReport(%s) SetWriteDeadline errSWD:", interf), errSWD)
 		}
+		// a tunnel outside interface can fail, which must not take the process down
 		if errW := r.conRaw[interf].WriteTo(iph, igmpPayload, r.ContMsg[interf]); errW != nil {
-			log.Fatal(fmt.Sprintf("sendMembershipReport(%s) WriteTo errW:", interf), errW)
+			r.log.Warn("sendMembershipReport() WriteTo", "iface", interf, "group", membershipItem.Group, "err", errW)
+			r.pC.WithLabelValues("sendMembershipReport", "WriteTo", "error").Inc()
+			continue
 		}
 		r.pC.WithLabelValues("sendMembershipReport", "WriteTo", "count").Inc()
 		r.pC.WithLabelValues("sendMembershipReport", "WriteToBytes", "count").Add(float64(len(igmpPayload)))
 
-		debugLog(r.debugLevel > 10, fmt.Sprintf("sendMembershipReport(%s) WriteTo success! len(igmpPayload):%d", interf, len(igmpPayload)))
+		if r.debugOn() {
+			r.log.Debug("sendMembershipReport() WriteTo success!", "iface", interf, "group", membershipItem.Group, "len", len(igmpPayload))
+		}
+	}
+
+	r.log.Debug("sendMembershipReport() complete", "iface", interf)
+}
+
+// reportPayload is an IGMPv2 report for (*,G), or an IGMPv3 MODE_IS_INCLUDE report for (S,G)
+// IGMPv2 can't carry sources, e.g. for SSM groups
+func reportPayload(mi MembershipItem) ([]byte, error) {
+
+	if len(mi.Sources) > 0 {
+		return igmpv3Report([]layers.IGMPv3GroupRecord{membershipItemRecord(layers.IGMPIsIn, mi)})
+	}
+
+	g, err := addr2NetIP(mi.Group)
+	if err != nil {
+		return nil, err
+	}
+
+	igmp := layers.IGMPv1or2{
+		Type:            layers.IGMPMembershipReportV2,
+		MaxResponseTime: MaxResponseTimeCst,
+		GroupAddress:    g,
+		Version:         2,
+	}
+
+	buffer := gopacket.NewSerializeBuffer()
+	options := gopacket.SerializeOptions{
+		ComputeChecksums: true,
+		FixLengths:       true,
+	}
+
+	//err := gopacket.SerializeLayers(buffer, options, r.pbp.ethernetLayer, r.pbp.ipLayer, igmp)
+	if err := gopacket.SerializeLayers(buffer, options, &igmp); err != nil {
+		return nil, err
 	}
 
-	debugLog(r.debugLevel > 10, fmt.Sprintf("sendMembershipReport(%s) complete", interf))
+	return buffer.Bytes(), nil
 }
 
 // // netip2Addr
 // // https://djosephsen.github.io/posts/ipnet/
 // func netip2Addr(ip net.IP) (netip.Addr, error) {
 
-// 	//debugLog(m.debugLevel > 100, fmt.Sprintf("netip2Addr() ip:%s, multicast:%t", ip.String(), ip.IsMulticast()))
+// 	//r.trace("netip2Addr()", "ip", ip, "multicast", ip.IsMulticast())
 
 // 	if addr, ok := netip.AddrFromSlice(ip); ok {
 // 		return addr, nil
@@ -111,7 +148,7 @@ func addr2NetIP(addr netip.Addr) (net.IP, error) {
 //groupRecords := []IGMPv2GroupRecord{}
 
 // for _, mItem := range membershipItems {
-// 	debugLog(r.debugLevel > 10, fmt.Sprintf("NewIGMPReporter() mItem:%v", mItem))
+// 	r.log.Debug("NewIGMPReporter()", "mItem", mItem)
 
 // 	s, err := r.addr2NetIP(mItem.Source)
 // 	if err != nil {
@@ -1,23 +1,28 @@
 package goIGMP
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"time"
 
 	"github.com/randomizedcoder/gopacket"
 	"github.com/randomizedcoder/gopacket/layers"
+	"golang.org/x/net/ipv4"
 )
 
 // See also
 // https://pkg.go.dev/golang.org/x/net@v0.22.0/ipv4#RawConn
 // https://pkg.go.dev/golang.org/x/net@v0.22.0/ipv4#example-RawConn-AdvertisingOSPFHello
 
+const (
+	igmpQueryMaxResponseTimeCst = 10 * time.Second
+	minQueryDurationCst         = 1 * time.Second
+)
+
+var errNoRawConn = errors.New("no raw socket for the interface")
+
 func (r IGMPReporter) selfQuery(interf side) {
-	const (
-		minQueryDurationCst         = 1 * time.Second
-		igmpQueryMaxResponseTimeCst = 10 * time.Second
-	)
 
 	startTime := time.Now()
 	defer func() {
@@ -25,37 +30,18 @@ func (r IGMPReporter) selfQuery(interf side) {
 	}()
 	r.pC.WithLabelValues("selfQuery", "start", "count").Inc()
 
-	debugLog(r.debugLevel > 10, fmt.Sprintf("selfQuery(%s) - don't do this at home folks", interf))
+	r.log.Debug("selfQuery() - don't do this at home folks", "iface", interf)
 
 	if r.TimerDuration[QUERY] < minQueryDurationCst {
-		debugLog(r.debugLevel > 10, fmt.Sprintf("selfQuery(%s) - queryTime < minQueryDurationCst", interf))
+		r.log.Warn("selfQuery() - queryTime < minQueryDurationCst", "iface", interf, "queryTime", r.TimerDuration[QUERY])
 		return
 	}
 
-	buffer := gopacket.NewSerializeBuffer()
-	options := gopacket.SerializeOptions{
-		ComputeChecksums: true,
-		FixLengths:       true,
-	}
-
-	// https://github.com/randomizedcoder/gopacket/blob/master/layers/igmp.go#L224
-	igmp := &layers.IGMPv1or2{
-		Type:         layers.IGMPMembershipQuery,
-		Version:      2,
-		GroupAddress: r.mapIPtoNetIP[allZerosHosts],
-		//GroupAddress:    net.ParseIP("232.1.1.1"), There is a bug.  This turns out as 232.1.0.0 currently
-		MaxResponseTime: igmpQueryMaxResponseTimeCst,
-	}
-
-	err := gopacket.SerializeLayers(buffer, options, igmp)
+	iph, igmpPayload, err := r.generalQuery(interf)
 	if err != nil {
-		log.Fatal(fmt.Sprintf("selfQuery(%s) SerializeLayers err:", interf), err)
+		log.Fatal(fmt.Sprintf("selfQuery(%s) generalQuery err:", interf), err)
 	}
 
-	igmpPayload := buffer.Bytes()
-	//iph := r.ipv4Header(len(igmpPayload), IGMPHosts)
-	iph := r.ipv4Header(len(igmpPayload), IGMPHosts)
-
 	t := time.NewTicker(r.TimerDuration[QUERY])
 	defer t.Stop()
 
@@ -64,11 +50,9 @@ func (r IGMPReporter) selfQuery(interf side) {
 		loopStartTime := time.Now()
 		r.pC.WithLabelValues("selfQuery", "loops", "count").Inc()
 
-		debugLog(r.debugLevel > 10, fmt.Sprintf("selfQuery(%s) loops:%d", interf, loops))
-
 		<-t.C
 
-		debugLog(r.debugLevel > 10, fmt.Sprintf("selfQuery(%s) tick loops:%d", interf, loops))
+		r.log.Debug("selfQuery() tick", "iface", interf, "loop", loops)
 
 		err := r.conRaw[interf].SetWriteDeadline(time.Now().Add(writeDeadlineCst))
 		if err != nil {
@@ -81,7 +65,64 @@ func (r IGMPReporter) selfQuery(interf side) {
 		r.pC.WithLabelValues("selfQuery", "WriteTo", "count").Inc()
 		r.pC.WithLabelValues("selfQuery", "WriteToBytes", "count").Add(float64(len(igmpPayload)))
 
-		debugLog(r.debugLevel > 10, fmt.Sprintf("selfQuery(%s) - WriteTo success, len(igmpPayload):%d", interf, len(igmpPayload)))
+		r.log.Debug("selfQuery() WriteTo success", "iface", interf, "len", len(igmpPayload))
 		r.pH.WithLabelValues("selfQuery", "loopStartTime", "complete").Observe(time.Since(loopStartTime).Seconds())
 	}
 }
+
+// generalQuery builds an IGMPv2 general query for the interface
+func (r IGMPReporter) generalQuery(interf side) (*ipv4.Header, []byte, error) {
+
+	buffer := gopacket.NewSerializeBuffer()
+	options := gopacket.SerializeOptions{
+		ComputeChecksums: true,
+		FixLengths:       true,
+	}
+
+	// https://github.com/randomizedcoder/gopacket/blob/master/layers/igmp.go#L224
+	igmp := &layers.IGMPv1or2{
+		Type:         layers.IGMPMembershipQuery,
+		Version:      2,
+		GroupAddress: r.mapIPtoNetIP[allZerosHosts],
+		//GroupAddress:    net.ParseIP("232.1.1.1"), There is a bug.  This turns out as 232.1.0.0 currently
+		MaxResponseTime: igmpQueryMaxResponseTimeCst,
+	}
+
+	if err := gopacket.SerializeLayers(buffer, options, igmp); err != nil {
+		return nil, nil, err
+	}
+
+	igmpPayload := buffer.Bytes()
+
+	return r.ipv4Header(interf, len(igmpPayload), IGMPHosts), igmpPayload, nil
+}
+
+// sendGeneralQuery sends a single general query, e.g. from the admin API
+func (r IGMPReporter) sendGeneralQuery(interf side) error {
+
+	if r.conRaw[interf] == nil {
+		r.pC.WithLabelValues("sendGeneralQuery", "noRawConn", "error").Inc()
+		return errNoRawConn
+	}
+
+	iph, igmpPayload, err := r.generalQuery(interf)
+	if err != nil {
+		r.pC.WithLabelValues("sendGeneralQuery", "generalQuery", "error").Inc()
+		return err
+	}
+
+	if err := r.conRaw[interf].SetWriteDeadline(time.Now().Add(writeDeadlineCst)); err != nil {
+		r.pC.WithLabelValues("sendGeneralQuery", "SetWriteDeadline", "error").Inc()
+		return err
+	}
+
+	if err := r.conRaw[interf].WriteTo(iph, igmpPayload, r.ContMsg[interf]); err != nil {
+		r.pC.WithLabelValues("sendGeneralQuery", "WriteTo", "error").Inc()
+		return err
+	}
+	r.pC.WithLabelValues("sendGeneralQuery", "WriteTo", "count").Inc()
+
+	r.log.Debug("sendGeneralQuery() WriteTo success", "iface", interf, "len", len(igmpPayload))
+
+	return nil
+}
@@ -20,7 +20,7 @@ func (r IGMPReporter) openUnicastPacketConn(interf side) (c net.PacketConn) {
 		ok      bool
 	)
 
-	debugLog(r.debugLevel > 10, fmt.Sprintf("openPacketUnicastConnection(%s)", interf))
+	r.log.Debug("openUnicastPacketConn()", "iface", interf)
 
 	if localIP, ok = r.NetAddr[interf]; !ok {
 		log.Fatalf("openUnicastPacketConn(%s) interface IP lookup error", interf)
@@ -31,14 +31,14 @@ func (r IGMPReporter) openUnicastPacketConn(interf side) (c net.PacketConn) {
 		log.Fatal(fmt.Sprintf("openUnicastPacketConn(%s) ListenPacket(%s,%s) err:", interf, protocolIGMP, localIP.String()), err)
 	}
 
-	debugLog(r.debugLevel > 10, fmt.Sprintf("openPacketUnicastConnection(%s) open on IP:%s", interf, localIP.String()))
+	r.log.Debug("openUnicastPacketConn() open", "iface", interf, "local", localIP)
 
 	return c
 }
 
 func (r IGMPReporter) createPacketConns(interf side) {
 
-	debugLog(r.debugLevel > 10, fmt.Sprintf("createPacketConns(%s)", interf))
+	r.log.Debug("createPacketConns()", "iface", interf)
 
 	if r.anyCon[interf] == nil {
 		r.anyCon[interf] = make(map[netip.Addr]net.PacketConn)
@@ -49,13 +49,19 @@ func (r IGMPReporter) createPacketConns(interf side) {
 	for _, g := range r.multicastGroups {
 		if r.anyCon[interf][r.mapIPtoNetAddr[g]] == nil {
 			r.anyCon[interf][r.mapIPtoNetAddr[g]], r.mConIGMP[interf][r.mapIPtoNetAddr[g]] = r.openPacketMulticastPacketConn(interf, r.mapIPtoNetAddr[g])
-			debugLog(r.debugLevel > 10, fmt.Sprintf("createPacketConns(%s) group:%s", interf, r.mapIPtoNetAddr[g]))
+			if _, ok := r.validation[interf]; ok {
+				if r.recvRaw[interf] == nil {
+					r.recvRaw[interf] = make(map[netip.Addr]*ipv4.RawConn)
+				}
+				r.recvRaw[interf][r.mapIPtoNetAddr[g]] = r.openRecvRawConn(interf, r.anyCon[interf][r.mapIPtoNetAddr[g]])
+			}
+			r.log.Debug("createPacketConns()", "iface", interf, "group", r.mapIPtoNetAddr[g])
 		}
 	}
 
-	if r.debugLevel > 10 {
+	if r.debugOn() {
 		for key, val := range r.anyCon {
-			debugLog(r.debugLevel > 10, fmt.Sprintf("createPacketConns(%s) IntName Key: %v, Value: %v", interf, key, val))
+			r.log.Debug("createPacketConns() anyCon", "iface", interf, "key", key, "value", val)
 		}
 	}
 }
@@ -70,7 +76,7 @@ func (r IGMPReporter) openPacketMulticastPacketConn(interf side, destinationIP n
 		err error
 	)
 
-	debugLog(r.debugLevel > 100, fmt.Sprintf("openPacketMulticastConnection(%s) destinationIP:%s", interf, destinationIP))
+	r.trace("openPacketMulticastPacketConn()", "iface", interf, "dst", destinationIP)
 
 	if !destinationIP.IsMulticast() {
 		log.Fatalf("openPacketMulticastPacketConn(%s) !destinationIP.IsMulticast()", interf)
@@ -85,7 +91,7 @@ func (r IGMPReporter) openPacketMulticastPacketConn(interf side, destinationIP n
 	}
 
 	if _, ok := r.NetIF[interf]; !ok {
-		debugLog(r.debugLevel > 10, fmt.Sprintf("openPacketMulticastConnection(%s) !r.NetIF[%s]", interf, interf))
+		r.log.Debug("openPacketMulticastPacketConn() !r.NetIF[interf]", "iface", interf)
 		r.NetIF[interf], r.NetIP[interf], r.NetAddr[interf] = r.getInterfaceHandle(interf)
 	}
 
@@ -106,7 +112,7 @@ func (r IGMPReporter) openPacketMulticastPacketConn(interf side, destinationIP n
 		log.Fatal(fmt.Sprintf("openPacketMulticastPacketConn(%s) SetControlMessage err:", interf), err)
 	}
 
-	debugLog(r.debugLevel > 10, fmt.Sprintf("openPacketMulticastPacketConn(%s) set FlagSrc, FlagDst, FlagInterface", interf))
+	r.log.Debug("openPacketMulticastPacketConn() set FlagSrc, FlagDst, FlagInterface", "iface", interf)
 
 	//---------------
 	// Join multicast
@@ -116,14 +122,14 @@ func (r IGMPReporter) openPacketMulticastPacketConn(interf side, destinationIP n
 	if err := p.JoinGroup(r.NetIF[interf], &net.UDPAddr{IP: joinIP}); err != nil {
 		log.Fatal(fmt.Sprintf("openPacketMulticastPacketConn(%s) JoinGroup err:", interf), err)
 	}
-	debugLog(r.debugLevel > 10, fmt.Sprintf("openPacketMulticastPacketConn(%s) joined:%s", interf, destinationIP))
+	r.log.Debug("openPacketMulticastPacketConn() joined", "iface", interf, "group", destinationIP)
 
 	return c, p
 }
 
 func (r IGMPReporter) openRawConnection(interf side) (raw *ipv4.RawConn) {
 
-	debugLog(r.debugLevel > 100, fmt.Sprintf("openRawConnection(%s)", interf))
+	r.trace("openRawConnection()", "iface", interf)
 
 	// inspired by https://godoc.org/golang.org/x/net/ipv4#example-RawConn--AdvertisingOSPFHello
 	c, err := net.ListenPacket(protocolIGMP, "0.0.0.0")
@@ -134,7 +140,7 @@ func (r IGMPReporter) openRawConnection(interf side) (raw *ipv4.RawConn) {
 	var netIF *net.Interface
 	var ok bool
 	if netIF, ok = r.NetIF[interf]; !ok {
-		debugLog(r.debugLevel > 10, fmt.Sprintf("openRawConnection(%s) !r.NetIF[%s]", interf, interf))
+		r.log.Debug("openRawConnection() !r.NetIF[interf]", "iface", interf)
 		netIF, _, _ = r.getInterfaceHandle(interf)
 		r.NetIF[interf] = netIF
 	}
@@ -151,13 +157,13 @@ func (r IGMPReporter) openRawConnection(interf side) (raw *ipv4.RawConn) {
 	if err := raw.SetMulticastTTL(igmpTTLCst); err != nil {
 		log.Fatal("openRawConnection() SetMulticastTTL err:", err)
 	}
-	debugLog(r.debugLevel > 10, fmt.Sprintf("openRawConnection(%s) SetMulticastInterface and SetMulticastTTL:%d set", interf, igmpTTLCst))
+	r.log.Debug("openRawConnection() SetMulticastInterface and SetMulticastTTL set", "iface", interf, "ttl", igmpTTLCst)
 
 	if r.conf.Testing.MulticastLoopback {
 		if err := raw.SetMulticastLoopback(true); err != nil {
 			log.Fatal("openRawConnection() SetMulticastLoopback err:", err)
 		}
-		debugLog(r.debugLevel > 10, fmt.Sprintf("openRawConnection(%s) SetMulticastLoopback set", interf))
+		r.log.Debug("openRawConnection() SetMulticastLoopback set", "iface", interf)
 
 	}
 
@@ -170,13 +176,13 @@ func (r IGMPReporter) getInterfaceHandle(interf side) (netIF *net.Interface, net
 		err error
 	)
 
-	debugLog(r.debugLevel > 100, fmt.Sprintf("getInterfaceHandle(%s)", interf))
+	r.trace("getInterfaceHandle()", "iface", interf)
 
 	netIF, err = net.InterfaceByName(r.IntName[interf])
 	if err != nil {
 		log.Fatal(fmt.Sprintf("getInterfaceHandle(%s) InterfaceByName err:", r.IntName[interf]), err)
 	}
-	debugLog(r.debugLevel > 10, fmt.Sprintf("getInterfaceHandle(%s) netIF:%v", interf, netIF))
+	r.log.Debug("getInterfaceHandle()", "iface", interf, "netIF", netIF)
 
 	addrs, err := netIF.Addrs()
 	if err != nil {
@@ -185,7 +191,7 @@ func (r IGMPReporter) getInterfaceHandle(interf side) (netIF *net.Interface, net
 
 forLoop:
 	for _, addr := range addrs {
-		debugLog(r.debugLevel > 10, fmt.Sprintf("getInterfaceHandle(%s) addr:%s", interf, addr))
+		r.log.Debug("getInterfaceHandle()", "iface", interf, "addr", addr)
 		switch v := addr.(type) {
 		case *net.IPAddr:
 			netIP = v.IP
@@ -194,12 +200,12 @@ forLoop:
 			netIP = v.IP
 			break forLoop
 		default:
-			debugLog(r.debugLevel > 10, fmt.Sprintf("getInterfaceHandle(%s) some strange addr:%s", interf, addr))
+			r.log.Debug("getInterfaceHandle() some strange addr", "iface", interf, "addr", addr)
 			continue
 		}
 	}
 
-	debugLog(r.debugLevel > 10, fmt.Sprintf("getInterfaceHandle(%s) netIP:%s", interf, netIP))
+	r.log.Debug("getInterfaceHandle()", "iface", interf, "netIP", netIP)
 
 	netaddr, err = r.netip2Addr(netIP)
 	if err != nil {
@@ -0,0 +1,284 @@
+package goIGMP
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"slices"
+
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+// SSMMode is what to do with any source (*,G) joins for groups in the SSM ranges
+type SSMMode int
+
+const (
+	// SSMOff is the original behaviour, the SSM ranges are not checked
+	SSMOff SSMMode = iota
+	// SSMReject drops (*,G) joins and IGMPv1/v2 reports for groups in the SSM ranges
+	SSMReject
+	// SSMMap turns (*,G) joins and IGMPv1/v2 reports into (S,G) using SSM.Mappings, and rejects them without a mapping
+	SSMMap
+)
+
+func (m SSMMode) String() string {
+	switch m {
+	case SSMOff:
+		return "off"
+	case SSMReject:
+		return "reject"
+	case SSMMap:
+		return "map"
+	default:
+		return "unknown"
+	}
+}
+
+// ASMSourcesMode is what to do with source lists for groups outside the SSM ranges
+type ASMSourcesMode int
+
+const (
+	ASMSourcesAllow ASMSourcesMode = iota
+	ASMSourcesReject
+)
+
+func (m ASMSourcesMode) String() string {
+	switch m {
+	case ASMSourcesAllow:
+		return "allow"
+	case ASMSourcesReject:
+		return "reject"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	ssmRangeCst = "232.0.0.0/8" // RFC 4607
+)
+
+var (
+	errSSMAnySource = errors.New("any source join for an SSM group")
+	errASMSources   = errors.New("source list for a group outside the SSM ranges")
+	errSSMRange     = errors.New("SSM.Ranges must be IPv4 multicast prefixes")
+	errSSMMapping   = errors.New("SSM.Mappings must be IPv4 multicast prefixes, with IPv4 unicast sources")
+)
+
+// SSMMapping are the sources for the groups, like Cisco's "ip igmp ssm-map static"
+type SSMMapping struct {
+	Groups  netip.Prefix
+	Sources []netip.Addr
+}
+
+// SSM configures the source specific multicast ranges
+//
+// With SSMMap, an IGMPv1/v2 report for a mapped group is proxied as an IGMPv3
+// MODE_IS_INCLUDE report with the mapped sources, and a leave as BLOCK_OLD_SOURCES.
+// The same mapping applies to the (*,G) joins and leaves from the application.
+// IGMPv3 EXCLUDE records for SSM groups are removed, as they are not mapped, and
+// the rest of the report is proxied, as RFC 4604 4.1 ignores only those records.
+type SSM struct {
+	Mode       SSMMode
+	Ranges     []netip.Prefix // Defaults to 232.0.0.0/8
+	Mappings   []SSMMapping   // first match wins
+	ASMSources ASMSourcesMode
+}
+
+// ssmVerdict is the result of checking a report or leave against the SSM config
+type ssmVerdict int
+
+const (
+	ssmPass ssmVerdict = iota
+	ssmReject
+	ssmMapped
+	ssmFiltered // some IGMPv3 records were removed
+)
+
+// active is checked first, so there is no cost without SSM config
+func (c *SSM) active() bool {
+	return c.Mode != SSMOff || c.ASMSources != ASMSourcesAllow
+}
+
+// defaults fills in the default range, and checks the config
+func (c *SSM) defaults() error {
+	if len(c.Ranges) == 0 {
+		c.Ranges = []netip.Prefix{netip.MustParsePrefix(ssmRangeCst)}
+	}
+	for _, p := range c.Ranges {
+		if !p.Addr().Is4() || !p.Addr().IsMulticast() {
+			return errSSMRange
+		}
+	}
+	for _, m := range c.Mappings {
+		if !m.Groups.Addr().Is4() || !m.Groups.Addr().IsMulticast() || len(m.Sources) == 0 {
+			return errSSMMapping
+		}
+		for _, s := range m.Sources {
+			if !s.Is4() || s.IsMulticast() || s.IsUnspecified() {
+				return errSSMMapping
+			}
+		}
+	}
+	return nil
+}
+
+func (c *SSM) inRange(g netip.Addr) bool {
+	return slices.ContainsFunc(c.Ranges, func(p netip.Prefix) bool {
+		return p.Contains(g)
+	})
+}
+
+// mapping returns the mapped sources for the group
+func (c *SSM) mapping(g netip.Addr) ([]netip.Addr, bool) {
+	if c.Mode != SSMMap {
+		return nil, false
+	}
+	for _, m := range c.Mappings {
+		if m.Groups.Contains(g) {
+			return m.Sources, true
+		}
+	}
+	return nil, false
+}
+
+// check decides what to do with a received report or leave
+// For ssmMapped and ssmFiltered, records is the IGMPv3 report to send instead, and for
+// ssmFiltered err is why the other records were removed
+func (c *SSM) check(msg IGMPMessage) (verdict ssmVerdict, records []layers.IGMPv3GroupRecord, err error) {
+
+	switch msg.Type {
+
+	case layers.IGMPMembershipReportV1, layers.IGMPMembershipReportV2, layers.IGMPLeaveGroup:
+		if c.Mode == SSMOff || !c.inRange(msg.Group) {
+			return ssmPass, nil, nil
+		}
+		if sources, ok := c.mapping(msg.Group); ok {
+			t := layers.IGMPIsIn
+			if msg.Type == layers.IGMPLeaveGroup {
+				t = layers.IGMPBlock
+			}
+			return ssmMapped, []layers.IGMPv3GroupRecord{membershipItemRecord(t, MembershipItem{Group: msg.Group, Sources: sources})}, nil
+		}
+		return ssmReject, nil, errSSMAnySource
+
+	case layers.IGMPMembershipReportV3:
+		for i, gr := range msg.GroupRecords {
+			mi := msg.MembershipItems[i]
+			if errR := c.checkRecord(gr.Type, mi); errR != nil {
+				err = errR
+				continue
+			}
+			records = append(records, membershipItemRecord(gr.Type, mi))
+		}
+		switch {
+		case err == nil:
+			return ssmPass, nil, nil
+		case len(records) == 0:
+			return ssmReject, nil, err
+		}
+		return ssmFiltered, records, err
+	}
+
+	return ssmPass, nil, nil
+}
+
+// checkRecord checks one IGMPv3 record
+func (c *SSM) checkRecord(t layers.IGMPv3GroupRecordType, mi MembershipItem) error {
+	if c.inRange(mi.Group) {
+		// RFC 4604 4.1 EXCLUDE is not allowed for SSM
+		if c.Mode != SSMOff && (t == layers.IGMPIsEx || t == layers.IGMPToEx) {
+			return errSSMAnySource
+		}
+		return nil
+	}
+	if c.ASMSources == ASMSourcesReject && len(mi.Sources) > 0 {
+		return errASMSources
+	}
+	return nil
+}
+
+// checkItems maps or removes the membership items from the application
+func (c *SSM) checkItems(items []MembershipItem) (out []MembershipItem, rejected int) {
+
+	out = make([]MembershipItem, 0, len(items))
+	for _, mi := range items {
+		if !c.inRange(mi.Group) {
+			if c.ASMSources == ASMSourcesReject && len(mi.Sources) > 0 {
+				rejected++
+				continue
+			}
+			out = append(out, mi)
+			continue
+		}
+		if c.Mode == SSMOff || len(mi.Sources) > 0 {
+			out = append(out, mi)
+			continue
+		}
+		if sources, ok := c.mapping(mi.Group); ok {
+			out = append(out, MembershipItem{Group: mi.Group, Sources: slices.Clone(sources)})
+			continue
+		}
+		rejected++
+	}
+
+	return out, rejected
+}
+
+// ssmCheck applies the SSM config to a received report or leave
+// A mapped or filtered message is replaced with the IGMPv3 report, which must be sent to IGMPHosts
+func (r IGMPReporter) ssmCheck(interf side, src net.IP, msg IGMPMessage, payload []byte) (out IGMPMessage, outPayload []byte, verdict ssmVerdict) {
+
+	if !r.conf.SSM.active() {
+		return msg, payload, ssmPass
+	}
+
+	verdict, records, err := r.conf.SSM.check(msg)
+
+	switch verdict {
+
+	case ssmReject:
+		r.pC.WithLabelValues("ssmCheck", msg.Type.String(), "reject").Inc()
+		r.notifyDrop(interf, DropSSM, src, err)
+		return msg, payload, verdict
+
+	case ssmMapped, ssmFiltered:
+		p, errR := igmpv3Report(records)
+		if errR != nil {
+			r.pC.WithLabelValues("ssmCheck", "igmpv3Report", "error").Inc()
+			r.notifyDrop(interf, DropSSM, src, errR)
+			return msg, payload, ssmReject
+		}
+		m, errD := DecodeIGMP(p)
+		if errD != nil {
+			r.pC.WithLabelValues("ssmCheck", "DecodeIGMP", "error").Inc()
+			r.notifyDrop(interf, DropSSM, src, errD)
+			return msg, payload, ssmReject
+		}
+		if verdict == ssmFiltered {
+			r.pC.WithLabelValues("ssmCheck", msg.Type.String(), "filtered").Inc()
+			r.notifyDrop(interf, DropSSM, src, err)
+			return m, p, verdict
+		}
+		r.pC.WithLabelValues("ssmCheck", msg.Type.String(), "mapped").Inc()
+		return m, p, verdict
+	}
+
+	return msg, payload, verdict
+}
+
+// ssmItems applies the SSM config to the joins and leaves from the application
+func (r IGMPReporter) ssmItems(interf side, name string, items []MembershipItem) []MembershipItem {
+
+	if !r.conf.SSM.active() {
+		return items
+	}
+
+	out, rejected := r.conf.SSM.checkItems(items)
+	if rejected > 0 {
+		r.log.Debug(name+"() rejected by SSM", "rejected", rejected)
+		r.pC.WithLabelValues(name, "ssm", "reject").Add(float64(rejected))
+		r.notifyDrop(interf, DropSSM, nil, nil)
+	}
+
+	return out
+}
@@ -0,0 +1,187 @@
+package goIGMP
+
+import (
+	"net"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+func TestSSMCheck(t *testing.T) {
+
+	c := SSM{
+		Mode: SSMMap,
+		Mappings: []SSMMapping{
+			{Groups: netip.MustParsePrefix("232.1.0.0/16"), Sources: []netip.Addr{netip.MustParseAddr("10.0.0.1")}},
+		},
+		ASMSources: ASMSourcesReject,
+	}
+	if err := c.defaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	mapped := netip.MustParseAddr("232.1.1.1")
+	unmapped := netip.MustParseAddr("232.2.2.2")
+	asm := netip.MustParseAddr("239.1.1.1")
+	src := netip.MustParseAddr("10.0.0.9")
+
+	v2 := func(t layers.IGMPType, g netip.Addr) IGMPMessage {
+		return IGMPMessage{Type: t, Group: g, MembershipItems: []MembershipItem{{Group: g}}}
+	}
+	v3 := func(rt layers.IGMPv3GroupRecordType, mi MembershipItem) IGMPMessage {
+		return IGMPMessage{Type: layers.IGMPMembershipReportV3, GroupRecords: []layers.IGMPv3GroupRecord{{Type: rt}}, MembershipItems: []MembershipItem{mi}}
+	}
+
+	tests := []struct {
+		name    string
+		msg     IGMPMessage
+		verdict ssmVerdict
+		record  layers.IGMPv3GroupRecordType
+		err     error
+	}{
+		{"v2ASM", v2(layers.IGMPMembershipReportV2, asm), ssmPass, 0, nil},
+		{"v2Mapped", v2(layers.IGMPMembershipReportV2, mapped), ssmMapped, layers.IGMPIsIn, nil},
+		{"v2LeaveMapped", v2(layers.IGMPLeaveGroup, mapped), ssmMapped, layers.IGMPBlock, nil},
+		{"v2Unmapped", v2(layers.IGMPMembershipReportV2, unmapped), ssmReject, 0, errSSMAnySource},
+		{"v3Include", v3(layers.IGMPIsIn, MembershipItem{Group: unmapped, Sources: []netip.Addr{src}}), ssmPass, 0, nil},
+		{"v3Exclude", v3(layers.IGMPToEx, MembershipItem{Group: mapped}), ssmReject, 0, errSSMAnySource},
+		{"v3ASMExclude", v3(layers.IGMPIsEx, MembershipItem{Group: asm}), ssmPass, 0, nil},
+		{"v3ASMSources", v3(layers.IGMPAllow, MembershipItem{Group: asm, Sources: []netip.Addr{src}}), ssmReject, 0, errASMSources},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			verdict, records, err := c.check(tc.msg)
+			if verdict != tc.verdict || err != tc.err {
+				t.Fatalf("verdict:%d err:%v, want:%d err:%v", verdict, err, tc.verdict, tc.err)
+			}
+			if verdict == ssmMapped && (len(records) != 1 || records[0].Type != tc.record || len(records[0].SourceAddresses) != 1) {
+				t.Errorf("records:%v", records)
+			}
+		})
+	}
+}
+
+func TestSSMCheckMixedV3(t *testing.T) {
+
+	r := *testReporter(t)
+	r.conf.SSM = SSM{Mode: SSMReject, ASMSources: ASMSourcesReject}
+	if err := r.conf.SSM.defaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	o := new(recordingObserver)
+	remove := r.AddObserver(o)
+	defer remove()
+
+	valid := MembershipItem{Group: netip.MustParseAddr("232.2.2.2"), Sources: []netip.Addr{netip.MustParseAddr("10.0.0.9")}}
+	payload, err := igmpv3Report([]layers.IGMPv3GroupRecord{
+		membershipItemRecord(layers.IGMPIsEx, MembershipItem{Group: netip.MustParseAddr("232.1.1.1")}),
+		membershipItemRecord(layers.IGMPIsIn, valid),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := DecodeIGMP(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the EXCLUDE record is removed
+	out, _, verdict := r.ssmCheck(IN, net.ParseIP("192.0.2.1"), msg, payload)
+	if verdict != ssmFiltered || !reflect.DeepEqual(out.MembershipItems, []MembershipItem{valid}) {
+		t.Errorf("verdict:%d items:%v, want:%d %v", verdict, out.MembershipItems, ssmFiltered, []MembershipItem{valid})
+	}
+
+	// and the ASM record with sources, leaving nothing
+	asm, _ := igmpv3Report([]layers.IGMPv3GroupRecord{
+		membershipItemRecord(layers.IGMPIsEx, MembershipItem{Group: netip.MustParseAddr("232.1.1.1")}),
+		membershipItemRecord(layers.IGMPAllow, MembershipItem{Group: netip.MustParseAddr("239.1.1.1"), Sources: valid.Sources}),
+	})
+	msg, _ = DecodeIGMP(asm)
+	if _, _, verdict = r.ssmCheck(IN, net.ParseIP("192.0.2.1"), msg, asm); verdict != ssmReject {
+		t.Errorf("verdict:%d, want:%d", verdict, ssmReject)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.drops[DropSSM] != 2 {
+		t.Errorf("drops[%s]:%d want:2", DropSSM, o.drops[DropSSM])
+	}
+}
+
+func TestSSMUnproxiedOut(t *testing.T) {
+
+	r := *testReporter(t)
+	r.conf.ProxyOutToIn = false
+	r.conf.SSM = SSM{Mode: SSMReject}
+	if err := r.conf.SSM.defaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	o := new(recordingObserver)
+	remove := r.AddObserver(o)
+	defer remove()
+
+	select {
+	case <-r.MembershipReportFromNetworkCh:
+	default:
+	}
+
+	// an IGMPv2 report for an SSM group, from another host on the outside
+	group := netip.MustParseAddr("232.1.1.1")
+	payload := append([]byte{byte(layers.IGMPMembershipReportV2), 0, 0, 0}, group.AsSlice()...)
+	r.handleIGMP(OUT, allHosts, 0, net.ParseIP("192.0.2.1").To4(), r.mapIPtoNetAddr[allHosts], payload)
+
+	select {
+	case items := <-r.MembershipReportFromNetworkCh:
+		if !reflect.DeepEqual(items, []MembershipItem{{Group: group}}) {
+			t.Errorf("items:%v, want:%v", items, []MembershipItem{{Group: group}})
+		}
+	default:
+		t.Error("MembershipReportFromNetworkCh is empty")
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.drops[DropSSM] != 0 {
+		t.Errorf("drops[%s]:%d want:0", DropSSM, o.drops[DropSSM])
+	}
+}
+
+func TestSSMCheckItems(t *testing.T) {
+
+	c := SSM{
+		Mode:     SSMMap,
+		Mappings: []SSMMapping{{Groups: netip.MustParsePrefix("232.1.0.0/16"), Sources: []netip.Addr{netip.MustParseAddr("10.0.0.1")}}},
+	}
+	if err := c.defaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	sg := MembershipItem{Group: netip.MustParseAddr("232.2.2.2"), Sources: []netip.Addr{netip.MustParseAddr("10.0.0.2")}}
+	asm := MembershipItem{Group: netip.MustParseAddr("239.1.1.1"), Sources: []netip.Addr{netip.MustParseAddr("10.0.0.3")}}
+
+	out, rejected := c.checkItems([]MembershipItem{
+		{Group: netip.MustParseAddr("232.1.1.1")},
+		{Group: netip.MustParseAddr("232.2.2.2")},
+		sg,
+		asm,
+	})
+
+	want := []MembershipItem{
+		{Group: netip.MustParseAddr("232.1.1.1"), Sources: []netip.Addr{netip.MustParseAddr("10.0.0.1")}},
+		sg,
+		asm,
+	}
+	if rejected != 1 || !reflect.DeepEqual(out, want) {
+		t.Errorf("out:%v rejected:%d, want:%v rejected:1", out, rejected, want)
+	}
+
+	bad := SSM{Mode: SSMReject, Ranges: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}}
+	if err := bad.defaults(); err != errSSMRange {
+		t.Errorf("err:%v, want:%v", err, errSSMRange)
+	}
+}
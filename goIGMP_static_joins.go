@@ -0,0 +1,179 @@
+package goIGMP
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+const (
+	// used when Config.Gratuitous is not set
+	staticJoinIntervalCst = 60 * time.Second
+)
+
+var (
+	errStaticJoinGroup     = errors.New("StaticJoins Group must be an IPv4 multicast address")
+	errStaticJoinSource    = errors.New("StaticJoins Sources must be IPv4 unicast addresses")
+	errStaticJoinInterface = errors.New("StaticJoins Interface must be empty, OutIntName or AltOutIntName")
+)
+
+// StaticJoin is a membership that is always reported upstream, e.g. for fast channel change
+//
+// Static joins are reported every Config.Gratuitous (default 60s), and in answer to queries.
+// Leaves are never sent for them, including the leaves from LeaveToNetworkCh, the proxied
+// IGMPv2 leaves, and the leaves on an outside interface change.
+type StaticJoin struct {
+	Interface string // OutIntName or AltOutIntName.  Empty is the active outside interface
+	Group     netip.Addr
+	Sources   []netip.Addr // empty for (*,G)
+}
+
+// staticJoins are the static joins by outside interface
+// active are the joins that follow the active outside interface
+type staticJoins struct {
+	pinned map[side][]MembershipItem
+	active []MembershipItem
+	groups map[netip.Addr]bool
+}
+
+// newStaticJoins checks and sorts the static joins
+func (r *IGMPReporter) newStaticJoins(joins []StaticJoin) (*staticJoins, error) {
+
+	s := &staticJoins{
+		pinned: make(map[side][]MembershipItem),
+		groups: make(map[netip.Addr]bool),
+	}
+
+	for _, j := range joins {
+
+		if !j.Group.Is4() || !j.Group.IsMulticast() {
+			return nil, errStaticJoinGroup
+		}
+		for _, src := range j.Sources {
+			if !src.Is4() || src.IsMulticast() || src.IsUnspecified() {
+				return nil, errStaticJoinSource
+			}
+		}
+
+		mi := MembershipItem{Group: j.Group, Sources: slices.Clone(j.Sources)}
+		s.groups[j.Group] = true
+
+		switch {
+		case j.Interface == "":
+			s.active = append(s.active, mi)
+		case j.Interface == r.conf.OutIntName:
+			s.pinned[OUT] = append(s.pinned[OUT], mi)
+		case r.AltOutExists && j.Interface == r.conf.AltOutIntName:
+			s.pinned[ALTOUT] = append(s.pinned[ALTOUT], mi)
+		default:
+			return nil, errStaticJoinInterface
+		}
+	}
+
+	return s, nil
+}
+
+// items returns the static joins to report on the outside interface
+func (s *staticJoins) items(interf side, active side) []MembershipItem {
+	if s == nil {
+		return nil
+	}
+	items := slices.Clone(s.pinned[interf])
+	if interf == active && len(s.active) > 0 {
+		items = mergeMembershipItems(items, s.active)
+	}
+	return items
+}
+
+// query returns the static joins answering a query, all of them for a general query
+func (s *staticJoins) query(interf side, active side, group netip.Addr) []MembershipItem {
+	items := s.items(interf, active)
+	if !group.IsValid() || group.IsUnspecified() {
+		return items
+	}
+	return slices.DeleteFunc(items, func(mi MembershipItem) bool {
+		return mi.Group != group
+	})
+}
+
+// withoutStatic removes the static groups, so they are never left
+func (s *staticJoins) withoutStatic(items []MembershipItem) []MembershipItem {
+	if s == nil || len(s.groups) == 0 {
+		return items
+	}
+	out := make([]MembershipItem, 0, len(items))
+	for _, mi := range items {
+		if !s.groups[mi.Group] {
+			out = append(out, mi)
+		}
+	}
+	return out
+}
+
+// isStaticLeave is true for an IGMPv2 leave of a static group, which must not be proxied
+func (s *staticJoins) isStaticLeave(msg IGMPMessage) bool {
+	return s != nil && msg.Type == layers.IGMPLeaveGroup && s.groups[msg.Group]
+}
+
+// answerStaticJoins sends membership reports for the static joins, in answer to a query on an outside interface
+func (r IGMPReporter) answerStaticJoins(interf side, msg IGMPMessage) {
+
+	if r.static == nil || !r.OutsideInterfaces[interf] || r.conRaw[interf] == nil {
+		return
+	}
+
+	items := r.static.query(interf, r.activeOutInterface(), msg.Group)
+	if len(items) == 0 {
+		return
+	}
+
+	if r.debugOn() {
+		r.log.Debug("answerStaticJoins()", "iface", interf, "group", msg.Group, "items", len(items))
+	}
+	r.pC.WithLabelValues("answerStaticJoins", interf.String(), "count").Inc()
+
+	r.sendMembershipReport(interf, items)
+}
+
+// staticJoinReporter reports the static joins on the outside interfaces every Config.Gratuitous
+func (r IGMPReporter) staticJoinReporter(wg *sync.WaitGroup, ctx context.Context) {
+
+	defer wg.Done()
+
+	interval := r.TimerDuration[GRATUITOUS]
+	if interval <= 0 {
+		interval = staticJoinIntervalCst
+	}
+
+	r.log.Debug("staticJoinReporter()", "interval", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for loops := 0; ; loops++ {
+
+		r.pC.WithLabelValues("staticJoinReporter", "loops", "count").Inc()
+
+		active := r.activeOutInterface()
+		for interf := range r.OutsideInterfaces {
+			if r.conRaw[interf] == nil {
+				continue
+			}
+			if items := r.static.items(interf, active); len(items) > 0 {
+				r.sendMembershipReport(interf, items)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			r.log.Debug("staticJoinReporter ctx.Done()", "loop", loops)
+			return
+		case <-ticker.C:
+		}
+	}
+}
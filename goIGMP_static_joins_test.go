@@ -0,0 +1,69 @@
+package goIGMP
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+func TestStaticJoins(t *testing.T) {
+
+	r := &IGMPReporter{conf: Config{OutIntName: "eth0", AltOutIntName: "gre0"}, AltOutExists: true}
+
+	g1 := netip.MustParseAddr("239.0.0.1")
+	g2 := netip.MustParseAddr("232.0.0.2")
+	g3 := netip.MustParseAddr("239.0.0.3")
+	s1 := netip.MustParseAddr("10.0.0.1")
+
+	s, err := r.newStaticJoins([]StaticJoin{
+		{Group: g1},
+		{Interface: "eth0", Group: g2, Sources: []netip.Addr{s1}},
+		{Interface: "gre0", Group: g3},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := s.items(OUT, OUT), []MembershipItem{{Group: g2, Sources: []netip.Addr{s1}}, {Group: g1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("items(OUT) active:%v, want:%v", got, want)
+	}
+	if got, want := s.items(ALTOUT, OUT), []MembershipItem{{Group: g3}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("items(ALTOUT) inactive:%v, want:%v", got, want)
+	}
+
+	if got := s.query(OUT, OUT, netip.IPv4Unspecified()); len(got) != 2 {
+		t.Errorf("general query:%v", got)
+	}
+	if got, want := s.query(OUT, OUT, g1), []MembershipItem{{Group: g1}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("group query:%v, want:%v", got, want)
+	}
+	if got := s.query(OUT, OUT, g3); len(got) != 0 {
+		t.Errorf("group query for another interface:%v", got)
+	}
+
+	other := MembershipItem{Group: netip.MustParseAddr("239.9.9.9")}
+	if got := s.withoutStatic([]MembershipItem{{Group: g1}, other, {Group: g3}}); !reflect.DeepEqual(got, []MembershipItem{other}) {
+		t.Errorf("withoutStatic:%v", got)
+	}
+
+	if !s.isStaticLeave(IGMPMessage{Type: layers.IGMPLeaveGroup, Group: g3}) || s.isStaticLeave(IGMPMessage{Type: layers.IGMPLeaveGroup, Group: other.Group}) {
+		t.Error("isStaticLeave")
+	}
+
+	var none *staticJoins
+	if none.items(OUT, OUT) != nil || none.isStaticLeave(IGMPMessage{Type: layers.IGMPLeaveGroup, Group: g1}) {
+		t.Error("nil staticJoins should be empty")
+	}
+
+	for _, bad := range []StaticJoin{
+		{Group: netip.MustParseAddr("10.0.0.1")},
+		{Group: g1, Sources: []netip.Addr{g2}},
+		{Interface: "eth9", Group: g1},
+	} {
+		if _, err := r.newStaticJoins([]StaticJoin{bad}); err == nil {
+			t.Errorf("expected an error for %+v", bad)
+		}
+	}
+}
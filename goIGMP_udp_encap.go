@@ -0,0 +1,515 @@
+package goIGMP
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// UDPEncap is the UDP encapsulated membership protocol, an alternative to the special unicast IGMP
+// The clients don't need CAP_NET_RAW, and the packets are ordinary UDP
+//
+// Listen is the proxy side, and Dst is the client side.  A reporter can be both.
+type UDPEncap struct {
+	Listen  string        // proxy, host:port to listen on.  An empty host is the inside interface address
+	Dst     string        // client, the proxy host:port.  The reports and leaves go here, instead of the outside
+	Key     []byte        // HMAC-SHA256 key, shared by the clients and the proxy.  nil for no authentication
+	MaxSkew time.Duration // with Key, the allowed clock difference.  0 for the default
+}
+
+const (
+	udpEncapMagicCst      = "gIGM"
+	udpEncapVersionCst    = 1
+	udpEncapHeaderBytes   = 18 // magic, version, type, flags, reserved, timestamp, count
+	udpEncapItemBytes     = 4  // family, reserved, number of sources
+	udpEncapMACBytes      = sha256.Size
+	udpEncapMaxSkewCst    = 30 * time.Second
+	maxUDPEncapBytesCst   = 1400
+	udpEncapFlagMAC       = 0x01
+	udpEncapFamilyIPv4    = 4
+	udpEncapFamilyIPv6    = 6
+	udpEncapJoin          = 1
+	udpEncapLeave         = 2
+	udpEncapReadBufferCst = 64 * 1024
+)
+
+var (
+	ErrUDPEncapTooShort  = errors.New("udp encap too short")
+	ErrUDPEncapMagic     = errors.New("udp encap bad magic")
+	ErrUDPEncapVersion   = errors.New("udp encap unknown version")
+	ErrUDPEncapType      = errors.New("udp encap unknown type")
+	ErrUDPEncapTruncated = errors.New("udp encap truncated item")
+	ErrUDPEncapFamily    = errors.New("udp encap unknown address family")
+	ErrUDPEncapGroup     = errors.New("udp encap invalid group address")
+	ErrUDPEncapNoMAC     = errors.New("udp encap missing hmac")
+	ErrUDPEncapBadMAC    = errors.New("udp encap bad hmac")
+	ErrUDPEncapSkew      = errors.New("udp encap timestamp outside MaxSkew")
+	ErrUDPEncapReplay    = errors.New("udp encap message already seen")
+	ErrUDPEncapTooLarge  = errors.New("udp encap item does not fit in a message")
+)
+
+// udpEncapMsg is one decoded UDP encapsulated message
+type udpEncapMsg struct {
+	leave bool
+	time  time.Time
+	mac   []byte // nil without a key
+	items []MembershipItem
+}
+
+// udpEncapReplay is the HMACs of the authenticated messages seen within MaxSkew
+// The HMAC covers the timestamp, so each message sent has a different one, and a captured
+// message can only be replayed until its timestamp is outside MaxSkew
+type udpEncapReplay struct {
+	mu     sync.Mutex
+	seen   map[[udpEncapMACBytes]byte]time.Time // the message timestamps
+	pruned time.Time
+}
+
+func newUDPEncapReplay() *udpEncapReplay {
+	return &udpEncapReplay{
+		seen:   make(map[[udpEncapMACBytes]byte]time.Time),
+		pruned: time.Now(),
+	}
+}
+
+// check records the message, and returns ErrUDPEncapReplay if it has been seen before
+func (c *udpEncapReplay) check(msg udpEncapMsg, maxSkew time.Duration, now time.Time) error {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// decodeUDPEncap rejects the messages outside maxSkew, so they don't need remembering
+	if now.Sub(c.pruned) > maxSkew {
+		for mac, t := range c.seen {
+			if now.Sub(t) > maxSkew {
+				delete(c.seen, mac)
+			}
+		}
+		c.pruned = now
+	}
+
+	mac := [udpEncapMACBytes]byte(msg.mac)
+	if _, ok := c.seen[mac]; ok {
+		return ErrUDPEncapReplay
+	}
+	c.seen[mac] = msg.time
+
+	return nil
+}
+
+func (u UDPEncap) maxSkew() time.Duration {
+	if u.MaxSkew > 0 {
+		return u.MaxSkew
+	}
+	return udpEncapMaxSkewCst
+}
+
+// udpEncapItemSize is the encoded size of a MembershipItem
+func udpEncapItemSize(mi MembershipItem) int {
+	return udpEncapItemBytes + mi.Group.BitLen()/8*(1+len(mi.Sources))
+}
+
+// encodeUDPEncap encodes the items into as many messages as are needed to stay within maxUDPEncapBytesCst
+//
+//	0      4        5     6      7         8              16      18
+//	| gIGM | version | type | flags | reserved | unix nanos | count | items ... | hmac
+//
+// each item is family(4|6), reserved, number of sources, group, sources
+// The HMAC-SHA256 covers everything before it
+func encodeUDPEncap(leave bool, items []MembershipItem, key []byte, now time.Time) (msgs [][]byte, err error) {
+
+	limit := maxUDPEncapBytesCst
+	if len(key) > 0 {
+		limit -= udpEncapMACBytes
+	}
+
+	var (
+		b     []byte
+		count int
+	)
+	flush := func() {
+		if count == 0 {
+			return
+		}
+		binary.BigEndian.PutUint16(b[16:18], uint16(count))
+		if len(key) > 0 {
+			b = append(b, udpEncapMAC(key, b)...)
+		}
+		msgs = append(msgs, b)
+		b, count = nil, 0
+	}
+
+	for _, mi := range items {
+		if !mi.Group.IsValid() {
+			return msgs, fmt.Errorf("%w:%v", ErrUDPEncapFamily, mi.Group)
+		}
+		n := udpEncapItemSize(mi)
+		if udpEncapHeaderBytes+n > limit {
+			return msgs, fmt.Errorf("%w:%s sources:%d", ErrUDPEncapTooLarge, mi.Group, len(mi.Sources))
+		}
+		if len(b)+n > limit {
+			flush()
+		}
+		if b == nil {
+			b = udpEncapHeader(leave, len(key) > 0, now)
+		}
+
+		family := byte(udpEncapFamilyIPv4)
+		if !mi.Group.Is4() {
+			family = udpEncapFamilyIPv6
+		}
+		b = append(b, family, 0)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(mi.Sources)))
+		b = append(b, mi.Group.AsSlice()...)
+		for _, s := range mi.Sources {
+			if s.BitLen() != mi.Group.BitLen() {
+				return msgs, fmt.Errorf("%w:group:%s source:%s", ErrUDPEncapFamily, mi.Group, s)
+			}
+			b = append(b, s.AsSlice()...)
+		}
+		count++
+	}
+	flush()
+
+	return msgs, nil
+}
+
+func udpEncapHeader(leave bool, mac bool, now time.Time) []byte {
+	b := make([]byte, udpEncapHeaderBytes, maxUDPEncapBytesCst)
+	copy(b, udpEncapMagicCst)
+	b[4] = udpEncapVersionCst
+	b[5] = udpEncapJoin
+	if leave {
+		b[5] = udpEncapLeave
+	}
+	if mac {
+		b[6] = udpEncapFlagMAC
+	}
+	binary.BigEndian.PutUint64(b[8:16], uint64(now.UnixNano()))
+	return b
+}
+
+func udpEncapMAC(key []byte, b []byte) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write(b)
+	return m.Sum(nil)
+}
+
+// decodeUDPEncap checks and decodes a message
+// With a key, the message must have a valid HMAC, and a timestamp within maxSkew of now
+func decodeUDPEncap(b []byte, key []byte, maxSkew time.Duration, now time.Time) (msg udpEncapMsg, err error) {
+
+	if len(b) < udpEncapHeaderBytes {
+		return msg, fmt.Errorf("%w:%d", ErrUDPEncapTooShort, len(b))
+	}
+	if string(b[:4]) != udpEncapMagicCst {
+		return msg, ErrUDPEncapMagic
+	}
+	if b[4] != udpEncapVersionCst {
+		return msg, fmt.Errorf("%w:%d", ErrUDPEncapVersion, b[4])
+	}
+	switch b[5] {
+	case udpEncapJoin:
+	case udpEncapLeave:
+		msg.leave = true
+	default:
+		return msg, fmt.Errorf("%w:%d", ErrUDPEncapType, b[5])
+	}
+
+	if b[6]&udpEncapFlagMAC != 0 {
+		if len(b) < udpEncapHeaderBytes+udpEncapMACBytes {
+			return msg, fmt.Errorf("%w:%d", ErrUDPEncapTooShort, len(b))
+		}
+		body, mac := b[:len(b)-udpEncapMACBytes], b[len(b)-udpEncapMACBytes:]
+		if len(key) > 0 {
+			if !hmac.Equal(mac, udpEncapMAC(key, body)) {
+				return msg, ErrUDPEncapBadMAC
+			}
+			msg.mac = mac
+		}
+		b = body
+	} else if len(key) > 0 {
+		return msg, ErrUDPEncapNoMAC
+	}
+
+	msg.time = time.Unix(0, int64(binary.BigEndian.Uint64(b[8:16])))
+	if len(key) > 0 {
+		if d := now.Sub(msg.time); d > maxSkew || d < -maxSkew {
+			return msg, fmt.Errorf("%w:%s", ErrUDPEncapSkew, d)
+		}
+	}
+
+	count := int(binary.BigEndian.Uint16(b[16:18]))
+	off := udpEncapHeaderBytes
+	for i := 0; i < count; i++ {
+		if len(b) < off+udpEncapItemBytes {
+			return msg, fmt.Errorf("%w:item:%d", ErrUDPEncapTruncated, i)
+		}
+		var alen int
+		switch b[off] {
+		case udpEncapFamilyIPv4:
+			alen = net.IPv4len
+		case udpEncapFamilyIPv6:
+			alen = net.IPv6len
+		default:
+			return msg, fmt.Errorf("%w:%d", ErrUDPEncapFamily, b[off])
+		}
+		nsrc := int(binary.BigEndian.Uint16(b[off+2 : off+4]))
+		off += udpEncapItemBytes
+		if len(b) < off+alen*(1+nsrc) {
+			return msg, fmt.Errorf("%w:item:%d", ErrUDPEncapTruncated, i)
+		}
+
+		mi := MembershipItem{Group: udpEncapAddr(b[off : off+alen])}
+		off += alen
+		if !mi.Group.IsMulticast() || mi.Group.Is4In6() {
+			return msg, fmt.Errorf("%w:%s", ErrUDPEncapGroup, mi.Group)
+		}
+		for j := 0; j < nsrc; j++ {
+			mi.Sources = append(mi.Sources, udpEncapAddr(b[off:off+alen]))
+			off += alen
+		}
+		msg.items = append(msg.items, mi)
+	}
+
+	return msg, nil
+}
+
+func udpEncapAddr(b []byte) netip.Addr {
+	a, _ := netip.AddrFromSlice(b)
+	return a
+}
+
+// openUDPEncapListener opens the proxy side socket
+func (r IGMPReporter) openUDPEncapListener() net.PacketConn {
+
+	host, port, err := net.SplitHostPort(r.conf.UDPEncap.Listen)
+	if err != nil {
+		log.Fatal("openUDPEncapListener() UDPEncap.Listen err:", err)
+	}
+	if host == "" {
+		host = r.NetAddr[IN].String()
+	}
+	addr := net.JoinHostPort(host, port)
+
+	c, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("openUDPEncapListener() ListenPacket(udp,%s) err:", addr), err)
+	}
+
+	r.log.Debug("openUDPEncapListener() open", "local", addr)
+
+	return c
+}
+
+// openUDPEncapClient opens the client side socket
+func (r IGMPReporter) openUDPEncapClient() net.Conn {
+
+	c, err := net.Dial("udp", r.conf.UDPEncap.Dst)
+	if err != nil {
+		log.Fatal(fmt.Sprintf("openUDPEncapClient() Dial(udp,%s) err:", r.conf.UDPEncap.Dst), err)
+	}
+
+	r.log.Debug("openUDPEncapClient() open", "dst", r.conf.UDPEncap.Dst)
+
+	return c
+}
+
+// sendUDPEncap sends the membership reports, or leaves, to the proxy
+// It replaces the raw IGMP of sendMembershipReport and sendLeave in client mode
+func (r IGMPReporter) sendUDPEncap(fn string, leave bool, membershipItems []MembershipItem) {
+
+	msgs, err := encodeUDPEncap(leave, membershipItems, r.conf.UDPEncap.Key, time.Now())
+	if err != nil {
+		// the items that fit are still sent
+		r.log.Warn(fn+"() encodeUDPEncap", "err", err)
+		r.pC.WithLabelValues(fn, "encodeUDPEncap", "error").Inc()
+	}
+
+	for _, m := range msgs {
+		errSWD := r.udpClient.SetWriteDeadline(time.Now().Add(writeDeadlineCst))
+		if errSWD != nil {
+			log.Fatal(fmt.Sprintf("%s() udpEncap SetWriteDeadline errSWD:", fn), errSWD)
+		}
+		// the proxy may not be listening yet, e.g. ECONNREFUSED
+		if _, errW := r.udpClient.Write(m); errW != nil {
+			r.log.Warn(fn+"() udpEncap Write", "dst", r.conf.UDPEncap.Dst, "err", errW)
+			r.pC.WithLabelValues(fn, "udpEncapWrite", "error").Inc()
+			continue
+		}
+		r.pC.WithLabelValues(fn, "udpEncapWrite", "count").Inc()
+		r.pC.WithLabelValues(fn, "udpEncapWriteBytes", "count").Add(float64(len(m)))
+	}
+
+	if r.debugOn() {
+		r.log.Debug(fn+"() udpEncap sent", "dst", r.conf.UDPEncap.Dst, "items", len(membershipItems), "msgs", len(msgs))
+	}
+}
+
+// recvUDPEncap is the proxy side listener
+func (r IGMPReporter) recvUDPEncap(wg *sync.WaitGroup, ctx context.Context) {
+
+	defer wg.Done()
+
+	r.log.Debug("recvUDPEncap started", "local", r.udpListener.LocalAddr())
+
+	buf := make([]byte, udpEncapReadBufferCst)
+
+forLoop:
+	for loops := 0; ; loops++ {
+
+		select {
+		case <-ctx.Done():
+			r.log.Debug("recvUDPEncap ctx.Done()", "loop", loops)
+			break forLoop
+		default:
+		}
+
+		loopStartTime := time.Now()
+		r.pC.WithLabelValues("recvUDPEncap", "loops", "counter").Inc()
+
+		err := r.udpListener.SetReadDeadline(time.Now().Add(r.conf.SocketReadDeadLine))
+		if err != nil {
+			log.Fatal(fmt.Sprintf("recvUDPEncap() loops:%d SetReadDeadline err:", loops), err)
+		}
+
+		n, addr, err := r.udpListener.ReadFrom(buf)
+		if err != nil {
+			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+				r.pC.WithLabelValues("recvUDPEncap", "timeout", "counter").Inc()
+				continue
+			}
+			r.pC.WithLabelValues("recvUDPEncap", "ReadFrom", "error").Inc()
+			continue
+		}
+		r.pC.WithLabelValues("recvUDPEncap", "n", "counter").Add(float64(n))
+
+		var src net.IP
+		if ua, ok := addr.(*net.UDPAddr); ok {
+			src = ua.IP
+		}
+
+		r.handleUDPEncap(loops, src, buf[:n])
+
+		r.pH.WithLabelValues("recvUDPEncap", "sinceLoopStartTime", "counter").Observe(time.Since(loopStartTime).Seconds())
+	}
+}
+
+// handleUDPEncap turns a UDP encapsulated message back into IGMP, or MLD, from the client on the inside
+// The IGMP goes through handleUnicastIGMP, so it gets the same checks as the special unicast IGMP
+func (r IGMPReporter) handleUDPEncap(loops int, src net.IP, b []byte) {
+
+	// before the HMAC, which costs more
+	if !r.unicastClientAllowed(IN, src) {
+		return
+	}
+
+	now := time.Now()
+	msg, err := decodeUDPEncap(b, r.conf.UDPEncap.Key, r.conf.UDPEncap.maxSkew(), now)
+	if err == nil && msg.mac != nil && r.udpReplay != nil {
+		err = r.udpReplay.check(msg, r.conf.UDPEncap.maxSkew(), now)
+	}
+	if err != nil {
+		if r.debugOn() {
+			r.log.Debug("recvUDPEncap decodeUDPEncap. Ignoring", "loop", loops, "src", src, "err", err)
+		}
+		reason := DropDecode
+		if errors.Is(err, ErrUDPEncapNoMAC) || errors.Is(err, ErrUDPEncapBadMAC) || errors.Is(err, ErrUDPEncapSkew) || errors.Is(err, ErrUDPEncapReplay) {
+			reason = DropAuth
+		}
+		r.pC.WithLabelValues("recvUDPEncap", string(reason), "error").Inc()
+		r.notifyDrop(IN, reason, src, err)
+		return
+	}
+
+	if r.debugOn() {
+		r.log.Debug("recvUDPEncap", "loop", loops, "src", src, "leave", msg.leave, "items", msg.items)
+	}
+
+	for _, mi := range msg.items {
+
+		if !mi.Group.Is4() {
+			r.handleUDPEncapMLD(loops, src, msg.leave, mi)
+			continue
+		}
+
+		payload, errP := reportPayload(mi)
+		if msg.leave {
+			payload, errP = leavePayload(mi)
+		}
+		if errP != nil {
+			r.log.Warn("recvUDPEncap payload", "src", src, "group", mi.Group, "err", errP)
+			r.pC.WithLabelValues("recvUDPEncap", "payload", "error").Inc()
+			continue
+		}
+
+		r.handleUnicastIGMP(IN, loops, src, payload)
+	}
+}
+
+// handleUDPEncapMLD is the MLD version of handleUnicastIGMP
+func (r IGMPReporter) handleUDPEncapMLD(loops int, src net.IP, leave bool, mi MembershipItem) {
+
+	if !r.conf.MLD {
+		r.pC.WithLabelValues("recvUDPEncap", "mldDisabled", "ignore").Inc()
+		r.notifyDrop(IN, DropNoRawConn, src, nil)
+		return
+	}
+
+	payload, dst, err := mldReportPayload(mi)
+	if leave {
+		payload, dst, err = mldDonePayload(mi)
+	}
+	if err != nil {
+		r.log.Warn("recvUDPEncap mld payload", "src", src, "group", mi.Group, "err", err)
+		r.pC.WithLabelValues("recvUDPEncap", "mldPayload", "error").Inc()
+		return
+	}
+	msg, err := DecodeMLD(payload)
+	if err != nil {
+		r.pC.WithLabelValues("recvUDPEncap", "DecodeMLD", "error").Inc()
+		return
+	}
+
+	if !r.unicastClientAllowsMessage(IN, src, msg) {
+		r.pC.WithLabelValues("recvUDPEncap", "clientGroup", "deny").Inc()
+		return
+	}
+
+	if !r.policyAllowsMessage(IN, src, msg) {
+		if r.debugOn() {
+			r.log.Debug("recvUDPEncap denied by policy. Ignoring", "loop", loops, "src", src, "group", mi.Group)
+		}
+		r.pC.WithLabelValues("recvUDPEncap", "policy", "deny").Inc()
+		r.notifyDrop(IN, DropPolicy, src, nil)
+		return
+	}
+
+	if err := r.admit(IN, src, msg); err != nil {
+		return
+	}
+
+	r.notifyUnicast(IN, msg, src)
+
+	if leave && r.static.isStaticLeave(msg) {
+		r.pC.WithLabelValues("recvUDPEncap", "staticLeave", "ignore").Inc()
+		return
+	}
+
+	o, ok := r.IntOutName.Load(IN)
+	if !ok {
+		r.log.Error("recvUDPEncap IntOutName.Load !ok")
+		r.pC.WithLabelValues("recvUDPEncap", "Load", "error").Inc()
+		return
+	}
+
+	r.proxyMLD(o.(side), dst, payload)
+}
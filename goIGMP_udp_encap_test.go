@@ -0,0 +1,169 @@
+package goIGMP
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestUDPEncapCodec(t *testing.T) {
+
+	now := time.Now()
+	key := []byte("secret")
+	items := []MembershipItem{
+		{Group: netip.MustParseAddr("239.1.1.1")},
+		{Group: netip.MustParseAddr("232.1.1.1"), Sources: []netip.Addr{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.2")}},
+		{Group: netip.MustParseAddr("ff3e::1"), Sources: []netip.Addr{netip.MustParseAddr("2001:db8::1")}},
+	}
+
+	for _, k := range [][]byte{nil, key} {
+		msgs, err := encodeUDPEncap(true, items, k, now)
+		if err != nil || len(msgs) != 1 {
+			t.Fatalf("key:%t msgs:%d err:%v", k != nil, len(msgs), err)
+		}
+		msg, err := decodeUDPEncap(msgs[0], k, udpEncapMaxSkewCst, now)
+		if err != nil {
+			t.Fatalf("key:%t err:%v", k != nil, err)
+		}
+		if !msg.leave || len(msg.items) != len(items) {
+			t.Fatalf("key:%t msg:%+v", k != nil, msg)
+		}
+		for i := range items {
+			if msg.items[i].Group != items[i].Group || !slices.Equal(msg.items[i].Sources, items[i].Sources) {
+				t.Errorf("item:%d got:%v want:%v", i, msg.items[i], items[i])
+			}
+		}
+	}
+
+	// the messages are split to fit the MTU
+	var many []MembershipItem
+	for i := 0; i < 500; i++ {
+		many = append(many, MembershipItem{Group: netip.AddrFrom4([4]byte{239, 2, byte(i >> 8), byte(i)})})
+	}
+	msgs, err := encodeUDPEncap(false, many, key, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, m := range msgs {
+		if len(m) > maxUDPEncapBytesCst {
+			t.Errorf("msg:%d bytes", len(m))
+		}
+		msg, err := decodeUDPEncap(m, key, udpEncapMaxSkewCst, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n += len(msg.items)
+	}
+	if len(msgs) < 2 || n != len(many) {
+		t.Errorf("msgs:%d items:%d", len(msgs), n)
+	}
+
+	tests := []struct {
+		name string
+		b    []byte
+		key  []byte
+		now  time.Time
+		want error
+	}{
+		{"short", msgs[0][:udpEncapHeaderBytes-1], nil, now, ErrUDPEncapTooShort},
+		{"truncated", mustEncodeUDPEncap(t, nil, now)[:udpEncapHeaderBytes+6], nil, now, ErrUDPEncapTruncated},
+		{"wrong key", msgs[0], []byte("other"), now, ErrUDPEncapBadMAC},
+		{"no mac", mustEncodeUDPEncap(t, nil, now), key, now, ErrUDPEncapNoMAC},
+		{"old", msgs[0], key, now.Add(time.Minute), ErrUDPEncapSkew},
+		{"future", msgs[0], key, now.Add(-time.Minute), ErrUDPEncapSkew},
+	}
+	for _, tt := range tests {
+		if _, err := decodeUDPEncap(tt.b, tt.key, udpEncapMaxSkewCst, tt.now); !errors.Is(err, tt.want) {
+			t.Errorf("%s err:%v want:%v", tt.name, err, tt.want)
+		}
+	}
+
+	bad := slices.Clone(msgs[0])
+	bad[udpEncapHeaderBytes+4] = 10 // group 10.2.0.0
+	if _, err := decodeUDPEncap(bad, nil, 0, now); !errors.Is(err, ErrUDPEncapGroup) {
+		t.Errorf("unicast group err:%v", err)
+	}
+}
+
+func mustEncodeUDPEncap(t *testing.T, key []byte, now time.Time) []byte {
+	t.Helper()
+	msgs, err := encodeUDPEncap(false, []MembershipItem{{Group: netip.MustParseAddr("239.1.1.1")}}, key, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msgs[0]
+}
+
+func TestSendUDPEncap(t *testing.T) {
+
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	r := *testReporter(t)
+	r.conf.UDPEncap = UDPEncap{Dst: l.LocalAddr().String(), Key: []byte("secret")}
+	r.udpClient = r.openUDPEncapClient()
+	defer r.udpClient.Close()
+
+	g := netip.MustParseAddr("239.3.3.3")
+	r.sendMembershipReport(OUT, []MembershipItem{{Group: g}})
+
+	if err := l.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, maxUDPEncapBytesCst)
+	n, _, err := l.ReadFrom(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := decodeUDPEncap(b[:n], r.conf.UDPEncap.Key, udpEncapMaxSkewCst, time.Now())
+	if err != nil || msg.leave || len(msg.items) != 1 || msg.items[0].Group != g {
+		t.Errorf("msg:%+v err:%v", msg, err)
+	}
+}
+
+func TestHandleUDPEncap(t *testing.T) {
+
+	r := *testReporter(t)
+	r.conf.UDPEncap.Key = []byte("secret")
+	r.udpReplay = newUDPEncapReplay()
+
+	o := new(recordingObserver)
+	remove := r.AddObserver(o)
+	defer remove()
+
+	src := net.ParseIP("192.0.2.10")
+	items := []MembershipItem{{Group: netip.MustParseAddr("239.4.4.4")}}
+
+	msgs, _ := encodeUDPEncap(false, items, r.conf.UDPEncap.Key, time.Now())
+	r.handleUDPEncap(0, src, msgs[0])
+
+	leaves, _ := encodeUDPEncap(true, items, r.conf.UDPEncap.Key, time.Now())
+	r.handleUDPEncap(0, src, leaves[0])
+	r.handleUDPEncap(0, src, leaves[0]) // replayed within MaxSkew
+
+	forged, _ := encodeUDPEncap(false, items, []byte("guess"), time.Now())
+	r.handleUDPEncap(0, src, forged[0])
+
+	replayed, _ := encodeUDPEncap(false, items, r.conf.UDPEncap.Key, time.Now().Add(-time.Hour))
+	r.handleUDPEncap(0, src, replayed[0])
+
+	// MLD is off
+	v6, _ := encodeUDPEncap(false, []MembershipItem{{Group: netip.MustParseAddr("ff3e::4")}}, r.conf.UDPEncap.Key, time.Now())
+	r.handleUDPEncap(0, src, v6[0])
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.reports != 1 || o.leaves != 1 {
+		t.Errorf("reports:%d leaves:%d want:1 1", o.reports, o.leaves)
+	}
+	if o.drops[DropAuth] != 3 {
+		t.Errorf("drops[%s]:%d want:3", DropAuth, o.drops[DropAuth])
+	}
+}
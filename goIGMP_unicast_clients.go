@@ -0,0 +1,132 @@
+package goIGMP
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"strconv"
+
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+// UnicastClients restricts who may send the special unicast IGMP, and the UDP encapsulated memberships
+//
+// Allow is the client source prefixes.  Empty allows any source, which is the original behaviour.
+// Clients are the optional per-client group policies.  The first client with a prefix containing
+// the source decides the groups it may join and leave.  A source matching no client may use any group.
+type UnicastClients struct {
+	Allow   []netip.Prefix
+	Clients []UnicastClient
+}
+
+// UnicastClient is the groups a client may join and leave
+type UnicastClient struct {
+	Name     string // used for the counter label.  Defaults to "client<index>"
+	Prefixes []netip.Prefix
+	Groups   []netip.Prefix // empty allows any group
+}
+
+const (
+	unicastClientNotAllowed = "notAllowed"
+	unicastClientGroup      = "group"
+)
+
+var (
+	errUnicastClientNotAllowed = errors.New("unicast client source is not in UnicastClients.Allow")
+	errUnicastClientGroup      = errors.New("unicast client may not use the group")
+)
+
+// client returns the index of the first client containing src, or -1
+func (c *UnicastClients) client(src netip.Addr) int {
+	if !src.IsValid() {
+		return -1
+	}
+	for i := range c.Clients {
+		if len(c.Clients[i].Prefixes) > 0 && prefixesContain(c.Clients[i].Prefixes, src) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *UnicastClients) clientName(i int) string {
+	if i < 0 {
+		return policyDefaultRuleCst
+	}
+	if c.Clients[i].Name != "" {
+		return c.Clients[i].Name
+	}
+	return "client" + strconv.Itoa(i)
+}
+
+// groupAllowed is true if the client owning src may use the group
+func (c *UnicastClients) groupAllowed(src netip.Addr, group netip.Addr) bool {
+	i := c.client(src)
+	if i < 0 {
+		return true
+	}
+	return prefixesContain(c.Clients[i].Groups, group)
+}
+
+// unicastClientAllowed checks the source against UnicastClients.Allow
+// The rejected sources are counted by client, and sent to the observers with the source address
+func (r IGMPReporter) unicastClientAllowed(interf side, src net.IP) bool {
+
+	if len(r.conf.UnicastClients.Allow) == 0 {
+		return true
+	}
+
+	addr := netIPToAddr(src)
+	if prefixesContain(r.conf.UnicastClients.Allow, addr.Unmap()) {
+		return true
+	}
+
+	r.unicastClientReject(interf, src, unicastClientNotAllowed, errUnicastClientNotAllowed)
+
+	return false
+}
+
+// unicastClientAllowsMessage is true if the client may use every group in a report or leave
+// The payload is proxied as is, so a partly allowed message is denied, like policyAllowsMessage
+func (r IGMPReporter) unicastClientAllowsMessage(interf side, src net.IP, msg IGMPMessage) bool {
+
+	if len(r.conf.UnicastClients.Clients) == 0 {
+		return true
+	}
+
+	switch msg.Type {
+	case layers.IGMPMembershipReportV1, layers.IGMPMembershipReportV2, layers.IGMPMembershipReportV3, layers.IGMPLeaveGroup:
+	default:
+		return true
+	}
+
+	addr := netIPToAddr(src).Unmap()
+	for _, mi := range msg.MembershipItems {
+		if !r.conf.UnicastClients.groupAllowed(addr, mi.Group) {
+			r.unicastClientReject(interf, src, unicastClientGroup, errUnicastClientGroup)
+			return false
+		}
+	}
+
+	return true
+}
+
+// unicastClientReject counts and notifies a rejected unicast client
+// The counter is labelled by the configured client name, so spoofed sources can't add series
+func (r IGMPReporter) unicastClientReject(interf side, src net.IP, reason string, err error) {
+
+	addr := netIPToAddr(src).Unmap()
+	client := r.conf.UnicastClients.clientName(r.conf.UnicastClients.client(addr))
+
+	if r.debugOn() {
+		r.log.Debug("unicastClient rejected. Ignoring", "iface", interf, "src", addr, "reason", reason, "client", client)
+	}
+
+	r.pCclients.WithLabelValues(client, reason).Inc()
+
+	dr := DropClient
+	if reason == unicastClientGroup {
+		dr = DropClientGroup
+	}
+	r.notifyDrop(interf, dr, src, err)
+}
@@ -0,0 +1,82 @@
+package goIGMP
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+func TestUnicastClientsGroupAllowed(t *testing.T) {
+
+	c := UnicastClients{Clients: []UnicastClient{
+		{Name: "cameras", Prefixes: []netip.Prefix{netip.MustParsePrefix("10.1.0.0/24")}, Groups: []netip.Prefix{netip.MustParsePrefix("239.1.0.0/16")}},
+		{Prefixes: []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16")}},
+	}}
+
+	tests := []struct {
+		src   string
+		group string
+		want  bool
+	}{
+		{"10.1.0.5", "239.1.2.3", true},
+		{"10.1.0.5", "239.2.2.3", false},
+		{"10.1.9.5", "239.2.2.3", true}, // second client, any group
+		{"10.9.0.5", "239.2.2.3", true}, // no client
+	}
+	for _, tt := range tests {
+		if got := c.groupAllowed(netip.MustParseAddr(tt.src), netip.MustParseAddr(tt.group)); got != tt.want {
+			t.Errorf("src:%s group:%s got:%t want:%t", tt.src, tt.group, got, tt.want)
+		}
+	}
+
+	if c.clientName(0) != "cameras" || c.clientName(1) != "client1" || c.clientName(-1) != policyDefaultRuleCst {
+		t.Errorf("names:%s %s %s", c.clientName(0), c.clientName(1), c.clientName(-1))
+	}
+}
+
+func TestHandleUnicastIGMPClients(t *testing.T) {
+
+	r := *testReporter(t)
+	r.conf.UnicastClients = UnicastClients{
+		Allow: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")},
+		Clients: []UnicastClient{
+			{Prefixes: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/28")}, Groups: []netip.Prefix{netip.MustParsePrefix("239.5.0.0/16")}},
+		},
+	}
+
+	o := new(recordingObserver)
+	remove := r.AddObserver(o)
+	defer remove()
+
+	allowed := netip.MustParseAddr("239.5.1.1")
+	other := netip.MustParseAddr("239.6.1.1")
+	v2 := func(g netip.Addr) []byte {
+		p, err := reportPayload(MembershipItem{Group: g})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	r.handleUnicastIGMP(IN, 0, net.ParseIP("192.0.2.1"), v2(allowed))
+	r.handleUnicastIGMP(IN, 0, net.ParseIP("192.0.2.1"), v2(other))
+	r.handleUnicastIGMP(IN, 0, net.ParseIP("198.51.100.1"), v2(allowed))
+
+	// the IGMPv3 records are checked one by one
+	v3, _ := igmpv3Report([]layers.IGMPv3GroupRecord{
+		membershipItemRecord(layers.IGMPIsEx, MembershipItem{Group: allowed}),
+		membershipItemRecord(layers.IGMPIsEx, MembershipItem{Group: other}),
+	})
+	r.handleUnicastIGMP(IN, 0, net.ParseIP("192.0.2.2"), v3)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.reports != 2 {
+		t.Errorf("reports:%d want:2", o.reports)
+	}
+	if o.drops[DropClient] != 1 || o.drops[DropClientGroup] != 2 {
+		t.Errorf("drops client:%d clientGroup:%d want:1 2", o.drops[DropClient], o.drops[DropClientGroup])
+	}
+}
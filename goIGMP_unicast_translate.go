@@ -0,0 +1,218 @@
+package goIGMP
+
+import (
+	"net"
+	"net/netip"
+
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+// UnicastQueryMode is what recvUnicastIGMP does with a unicast query from an inside host
+type UnicastQueryMode int
+
+const (
+	// UnicastQueryIgnore is the original behaviour, the query is counted and dropped
+	UnicastQueryIgnore UnicastQueryMode = iota
+	// UnicastQueryMulticast sends the query on the inside, to 224.0.0.1 or to the group for a group specific query
+	UnicastQueryMulticast
+	// UnicastQueryAnswer answers the query with reports for the inside memberships, unicast to the querier
+	UnicastQueryAnswer
+)
+
+func (m UnicastQueryMode) String() string {
+	switch m {
+	case UnicastQueryIgnore:
+		return "ignore"
+	case UnicastQueryMulticast:
+		return "multicast"
+	case UnicastQueryAnswer:
+		return "answer"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	// the answer reports must fit in the inside MTU, less the IP header with router alert
+	maxIGMPv3ReportBytesCst = 1400
+)
+
+// unicastQuery translates or answers a unicast query received from the inside
+func (r IGMPReporter) unicastQuery(interf side, src net.IP, msg IGMPMessage, buf *[]byte, rm rateMsg) {
+
+	switch r.conf.UnicastQueries {
+
+	case UnicastQueryMulticast:
+		dest := r.mapIPtoNetIP[allHosts]
+		if msg.Group.IsMulticast() {
+			dest = msg.Group.AsSlice()
+		}
+		if r.debugOn() {
+			r.log.Debug("recvUnicastIGMP unicastQuery to multicast", "iface", interf, "src", src, "dst", dest)
+		}
+		r.proxyUniToMultiv1or2(interf, dest, buf, rm)
+
+	case UnicastQueryAnswer:
+		r.answerUnicastQuery(interf, src, msg)
+
+	default:
+		r.pC.WithLabelValues("recvUnicastIGMP", "query", "ignore").Inc()
+	}
+}
+
+// answerUnicastQuery sends the inside and client-mode memberships back to the querier
+// An IGMPv3 querier gets IGMPv3 reports, otherwise the reports are the same as sendMembershipReport
+func (r IGMPReporter) answerUnicastQuery(interf side, src net.IP, msg IGMPMessage) {
+
+	items := queriedItems(mergeMembershipItems(r.downstream.items(), r.joins.items()), msg.Group)
+
+	r.pC.WithLabelValues("answerUnicastQuery", "items", "count").Add(float64(len(items)))
+
+	payloads, err := answerPayloads(msg.Version, items)
+	if err != nil {
+		r.log.Warn("answerUnicastQuery answerPayloads", "iface", interf, "src", src, "err", err)
+		r.pC.WithLabelValues("answerUnicastQuery", "answerPayloads", "error").Inc()
+		return
+	}
+
+	for _, p := range payloads {
+		iph := r.ipv4HeaderNetIP(interf, len(p), src)
+		if r.writeIGMP("answerUnicastQuery", interf, iph, p) && r.debugOn() {
+			r.log.Debug("answerUnicastQuery WriteTo success!", "iface", interf, "dst", src, "len", len(p))
+		}
+	}
+}
+
+// queriedItems are the memberships asked for by a general, or group specific query
+func queriedItems(items []MembershipItem, group netip.Addr) []MembershipItem {
+
+	if !group.IsMulticast() {
+		// the MLD groups can't be carried by IGMP
+		igmp, _ := splitMLD(items)
+		return igmp
+	}
+
+	for _, mi := range items {
+		if mi.Group == group {
+			return []MembershipItem{mi}
+		}
+	}
+	return nil
+}
+
+// answerPayloads are one report per membership for IGMPv1/v2 queriers, or
+// IGMPv3 reports with MODE_IS_EXCLUDE {} for (*,G) and MODE_IS_INCLUDE for (S,G)
+func answerPayloads(version uint8, items []MembershipItem) (payloads [][]byte, err error) {
+
+	if version != 3 {
+		for _, mi := range items {
+			p, errP := reportPayload(mi)
+			if errP != nil {
+				return payloads, errP
+			}
+			payloads = append(payloads, p)
+		}
+		return payloads, nil
+	}
+
+	var (
+		records []layers.IGMPv3GroupRecord
+		size    = igmpv3ReportHeaderBytesCst
+	)
+	flush := func() error {
+		if len(records) == 0 {
+			return nil
+		}
+		p, errR := igmpv3Report(records)
+		if errR != nil {
+			return errR
+		}
+		payloads = append(payloads, p)
+		records = nil
+		size = igmpv3ReportHeaderBytesCst
+		return nil
+	}
+
+	for _, mi := range items {
+		t := layers.IGMPIsIn
+		if len(mi.Sources) == 0 {
+			t = layers.IGMPIsEx
+		}
+		n := igmpv3RecordHeaderBytesCst + net.IPv4len*len(mi.Sources)
+		if size+n > maxIGMPv3ReportBytesCst {
+			if err := flush(); err != nil {
+				return payloads, err
+			}
+		}
+		records = append(records, membershipItemRecord(t, mi))
+		size += n
+	}
+
+	return payloads, flush()
+}
+
+// unicastV3Records applies the policy and the static joins to each group record of a unicast IGMPv3 report,
+// and re-serializes the records that are left.  ok is false when no records are left
+//
+// The sources of the INCLUDE and BLOCK records are filtered.  The sources of the EXCLUDE records
+// are the sources not wanted, so the EXCLUDE records are decided as (*,G), and kept whole.
+func (r IGMPReporter) unicastV3Records(interf side, src net.IP, msg IGMPMessage) (out IGMPMessage, payload []byte, ok bool, err error) {
+
+	reporter := netIPToAddr(src)
+
+	var records []layers.IGMPv3GroupRecord
+	for i, gr := range msg.GroupRecords {
+		mi := msg.MembershipItems[i]
+
+		if r.static != nil && r.static.groups[mi.Group] && isLeaveRecord(gr.Type, mi) {
+			r.pC.WithLabelValues("unicastV3Records", "staticLeave", "ignore").Inc()
+			continue
+		}
+
+		if !r.conf.UnicastClients.groupAllowed(reporter.Unmap(), mi.Group) {
+			r.pC.WithLabelValues("unicastV3Records", "clientGroup", "deny").Inc()
+			r.unicastClientReject(interf, src, unicastClientGroup, errUnicastClientGroup)
+			continue
+		}
+
+		exclude := gr.Type == layers.IGMPIsEx || gr.Type == layers.IGMPToEx
+
+		allowed, denied := r.policyFilter(interf, reporter, []MembershipItem{policyItem(gr.Type, mi)})
+		if len(allowed) == 0 {
+			r.pC.WithLabelValues("unicastV3Records", "policy", "deny").Inc()
+			continue
+		}
+		if denied > 0 {
+			r.pC.WithLabelValues("unicastV3Records", "policy", "partial").Inc()
+		}
+
+		if exclude {
+			allowed[0] = mi
+		}
+		records = append(records, membershipItemRecord(gr.Type, allowed[0]))
+	}
+
+	if len(records) == 0 {
+		return msg, nil, false, nil
+	}
+
+	if payload, err = igmpv3Report(records); err != nil {
+		return msg, nil, false, err
+	}
+	if out, err = DecodeIGMP(payload); err != nil {
+		return msg, nil, false, err
+	}
+
+	return out, payload, true, nil
+}
+
+// isLeaveRecord is true for the records that remove the membership, or some of the sources
+func isLeaveRecord(t layers.IGMPv3GroupRecordType, mi MembershipItem) bool {
+	switch t {
+	case layers.IGMPBlock:
+		return true
+	case layers.IGMPIsIn, layers.IGMPToIn:
+		return len(mi.Sources) == 0
+	}
+	return false
+}
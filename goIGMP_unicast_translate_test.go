@@ -0,0 +1,123 @@
+package goIGMP
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+func TestAnswerPayloads(t *testing.T) {
+
+	g := netip.MustParseAddr("239.1.1.1")
+	ssm := MembershipItem{Group: netip.MustParseAddr("232.1.1.1"), Sources: []netip.Addr{netip.MustParseAddr("10.0.0.1")}}
+
+	v2, err := answerPayloads(2, []MembershipItem{{Group: g}, ssm})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v2) != 2 {
+		t.Fatalf("v2 payloads:%d want:2", len(v2))
+	}
+	if msg, err := DecodeIGMP(v2[0]); err != nil || msg.Type != layers.IGMPMembershipReportV2 || msg.Group != g {
+		t.Errorf("v2 answer:%+v err:%v", msg, err)
+	}
+
+	v3, err := answerPayloads(3, []MembershipItem{{Group: g}, ssm})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := DecodeIGMP(v3[0])
+	if err != nil || len(v3) != 1 || len(msg.GroupRecords) != 2 {
+		t.Fatalf("v3 answer:%d %+v err:%v", len(v3), msg, err)
+	}
+	if msg.GroupRecords[0].Type != layers.IGMPIsEx || msg.GroupRecords[1].Type != layers.IGMPIsIn {
+		t.Errorf("v3 record types:%v %v", msg.GroupRecords[0].Type, msg.GroupRecords[1].Type)
+	}
+
+	// the IGMPv3 answers are split to fit the MTU
+	var many []MembershipItem
+	for i := 0; i < 300; i++ {
+		many = append(many, MembershipItem{Group: netip.AddrFrom4([4]byte{239, 2, byte(i >> 8), byte(i)})})
+	}
+	split, err := answerPayloads(3, many)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := 0
+	for _, p := range split {
+		if len(p) > maxIGMPv3ReportBytesCst {
+			t.Errorf("payload:%d bytes", len(p))
+		}
+		m, _ := DecodeIGMP(p)
+		records += len(m.GroupRecords)
+	}
+	if len(split) < 2 || records != len(many) {
+		t.Errorf("payloads:%d records:%d", len(split), records)
+	}
+}
+
+func TestQueriedItems(t *testing.T) {
+	g := netip.MustParseAddr("239.1.1.1")
+	items := []MembershipItem{{Group: g}, {Group: netip.MustParseAddr("239.1.1.2")}, {Group: netip.MustParseAddr("ff3e::1")}}
+
+	if got := queriedItems(items, netip.IPv4Unspecified()); len(got) != 2 {
+		t.Errorf("general query:%v", got)
+	}
+	if got := queriedItems(items, g); len(got) != 1 || got[0].Group != g {
+		t.Errorf("group query:%v", got)
+	}
+	if got := queriedItems(items, netip.MustParseAddr("239.9.9.9")); len(got) != 0 {
+		t.Errorf("unknown group query:%v", got)
+	}
+}
+
+func TestUnicastV3Records(t *testing.T) {
+
+	r := *testReporter(t)
+	r.conf.Policy = Policy{Rules: []PolicyRule{
+		{Action: PolicyDeny, Groups: []netip.Prefix{netip.MustParsePrefix("239.9.0.0/16")}},
+		{Action: PolicyDeny, Sources: []netip.Prefix{netip.MustParsePrefix("10.9.0.0/16")}},
+	}}
+
+	allowed := netip.MustParseAddr("239.1.1.1")
+	denied := netip.MustParseAddr("239.9.1.1")
+	ssm := netip.MustParseAddr("232.1.1.1")
+	s1 := netip.MustParseAddr("10.0.0.1")
+	s2 := netip.MustParseAddr("10.9.0.1")
+
+	p, err := igmpv3Report([]layers.IGMPv3GroupRecord{
+		membershipItemRecord(layers.IGMPIsEx, MembershipItem{Group: allowed, Sources: []netip.Addr{s2}}),
+		membershipItemRecord(layers.IGMPIsEx, MembershipItem{Group: denied}),
+		membershipItemRecord(layers.IGMPAllow, MembershipItem{Group: ssm, Sources: []netip.Addr{s1, s2}}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := DecodeIGMP(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, _, ok, err := r.unicastV3Records(IN, net.ParseIP("192.0.2.1"), msg)
+	if err != nil || !ok {
+		t.Fatalf("ok:%t err:%v", ok, err)
+	}
+	if len(out.MembershipItems) != 2 {
+		t.Fatalf("items:%v", out.MembershipItems)
+	}
+	// the EXCLUDE record is kept whole, and the denied source is removed from the ALLOW record
+	if out.MembershipItems[0].Group != allowed || len(out.MembershipItems[0].Sources) != 1 {
+		t.Errorf("exclude record:%v", out.MembershipItems[0])
+	}
+	if out.MembershipItems[1].Group != ssm || len(out.MembershipItems[1].Sources) != 1 || out.MembershipItems[1].Sources[0] != s1 {
+		t.Errorf("allow record:%v", out.MembershipItems[1])
+	}
+
+	only, _ := igmpv3Report([]layers.IGMPv3GroupRecord{membershipItemRecord(layers.IGMPIsEx, MembershipItem{Group: denied})})
+	msg, _ = DecodeIGMP(only)
+	if _, _, ok, err := r.unicastV3Records(IN, net.ParseIP("192.0.2.1"), msg); ok || err != nil {
+		t.Errorf("all denied ok:%t err:%v", ok, err)
+	}
+}
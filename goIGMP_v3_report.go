@@ -0,0 +1,90 @@
+package goIGMP
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+const (
+	igmpv3ReportHeaderBytesCst = 8
+	igmpv3RecordHeaderBytesCst = 8
+)
+
+var errIGMPv3RecordNotIPv4 = errors.New("IGMPv3 group record addresses must be IPv4")
+
+// igmpv3Report serializes an IGMPv3 membership report
+// gopacket can only serialize IGMPv1or2, so this builds RFC 3376 4.2 by hand
+//
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|  Type = 0x22  |    Reserved   |           Checksum            |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|           Reserved            |  Number of Group Records (M)  |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+//	|                        Group Record [1..M]                    |
+//	+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+func igmpv3Report(records []layers.IGMPv3GroupRecord) ([]byte, error) {
+
+	size := igmpv3ReportHeaderBytesCst
+	for _, gr := range records {
+		size += igmpv3RecordHeaderBytesCst + net.IPv4len*len(gr.SourceAddresses)
+	}
+
+	b := make([]byte, size)
+	b[0] = byte(layers.IGMPMembershipReportV3)
+	binary.BigEndian.PutUint16(b[6:8], uint16(len(records)))
+
+	o := igmpv3ReportHeaderBytesCst
+	for _, gr := range records {
+		g := gr.MulticastAddress.To4()
+		if g == nil {
+			return nil, errIGMPv3RecordNotIPv4
+		}
+		b[o] = byte(gr.Type)
+		binary.BigEndian.PutUint16(b[o+2:o+4], uint16(len(gr.SourceAddresses)))
+		copy(b[o+4:o+8], g)
+		o += igmpv3RecordHeaderBytesCst
+		for _, s := range gr.SourceAddresses {
+			s4 := s.To4()
+			if s4 == nil {
+				return nil, errIGMPv3RecordNotIPv4
+			}
+			copy(b[o:o+net.IPv4len], s4)
+			o += net.IPv4len
+		}
+	}
+
+	binary.BigEndian.PutUint16(b[2:4], igmpChecksum(b))
+
+	return b, nil
+}
+
+// igmpChecksum is the RFC 1071 internet checksum, with the checksum field zero
+func igmpChecksum(b []byte) uint16 {
+	var csum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		csum += uint32(binary.BigEndian.Uint16(b[i : i+2]))
+	}
+	if len(b)%2 == 1 {
+		csum += uint32(b[len(b)-1]) << 8
+	}
+	for csum > 0xffff {
+		csum = (csum >> 16) + (csum & 0xffff)
+	}
+	return ^uint16(csum)
+}
+
+// membershipItemRecord makes a group record for the membership item
+func membershipItemRecord(t layers.IGMPv3GroupRecordType, mi MembershipItem) layers.IGMPv3GroupRecord {
+	gr := layers.IGMPv3GroupRecord{
+		Type:             t,
+		NumberOfSources:  uint16(len(mi.Sources)),
+		MulticastAddress: mi.Group.AsSlice(),
+	}
+	for _, s := range mi.Sources {
+		gr.SourceAddresses = append(gr.SourceAddresses, s.AsSlice())
+	}
+	return gr
+}
@@ -0,0 +1,47 @@
+package goIGMP
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/randomizedcoder/gopacket/layers"
+)
+
+func TestIGMPv3ReportRoundTrip(t *testing.T) {
+
+	items := []MembershipItem{
+		{Group: netip.MustParseAddr("232.1.1.1"), Sources: []netip.Addr{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.2")}},
+		{Group: netip.MustParseAddr("239.1.1.1")},
+	}
+
+	p, err := igmpv3Report([]layers.IGMPv3GroupRecord{
+		membershipItemRecord(layers.IGMPIsIn, items[0]),
+		membershipItemRecord(layers.IGMPIsEx, items[1]),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if igmpChecksum(p) != 0 {
+		t.Errorf("checksum doesn't verify: %x", p)
+	}
+
+	msg, err := DecodeIGMP(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != layers.IGMPMembershipReportV3 {
+		t.Fatalf("type:%s", msg.Type)
+	}
+	if !reflect.DeepEqual(msg.MembershipItems, items) {
+		t.Errorf("items:%v, want:%v", msg.MembershipItems, items)
+	}
+	if msg.GroupRecords[0].Type != layers.IGMPIsIn || msg.GroupRecords[1].Type != layers.IGMPIsEx {
+		t.Errorf("record types:%s,%s", msg.GroupRecords[0].Type, msg.GroupRecords[1].Type)
+	}
+
+	if _, err := igmpv3Report([]layers.IGMPv3GroupRecord{membershipItemRecord(layers.IGMPIsIn, MembershipItem{})}); err == nil {
+		t.Error("expected an error for an invalid group")
+	}
+}
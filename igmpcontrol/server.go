@@ -0,0 +1,246 @@
+// Package igmpcontrol is the gRPC control plane of a goIGMP IGMPReporter
+//
+// It lets a remote orchestration layer drive the memberships, without linking goIGMP into the clients:
+//
+//	s := grpc.NewServer(grpc.Creds(creds))
+//	igmpcontrol.RegisterControlServer(s, igmpcontrol.NewServer(r))
+//
+// The service has no authentication of its own, so use TLS credentials or listen on a trusted address.
+package igmpcontrol
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/randomizedcoder/goIGMP"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	eventBufferCst = 256
+
+	// sent when a slow WatchEvents client missed events
+	EventsDropped = "eventsDropped"
+)
+
+// Server implements ControlServer for an IGMPReporter
+type Server struct {
+	UnimplementedControlServer
+
+	r *goIGMP.IGMPReporter
+}
+
+// NewServer returns the gRPC service for r
+func NewServer(r *goIGMP.IGMPReporter) *Server {
+	return &Server{r: r}
+}
+
+func (s *Server) Join(ctx context.Context, req *JoinRequest) (*JoinResponse, error) {
+	items, err := membershipItems(req.GetMemberships())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.r.Join(items); err != nil {
+		return nil, statusOf(err)
+	}
+	return &JoinResponse{}, nil
+}
+
+func (s *Server) Leave(ctx context.Context, req *LeaveRequest) (*LeaveResponse, error) {
+	items, err := membershipItems(req.GetMemberships())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.r.Leave(items); err != nil {
+		return nil, statusOf(err)
+	}
+	return &LeaveResponse{}, nil
+}
+
+func (s *Server) ListMemberships(ctx context.Context, req *ListMembershipsRequest) (*ListMembershipsResponse, error) {
+	t := s.r.MembershipTables()
+	return &ListMembershipsResponse{
+		Joins:              memberships(t.Joins),
+		Downstream:         memberships(t.Downstream),
+		Static:             memberships(t.Static),
+		ActiveOutInterface: s.r.ActiveOutInterface(),
+	}, nil
+}
+
+func (s *Server) GetQueriers(ctx context.Context, req *GetQueriersRequest) (*GetQueriersResponse, error) {
+	resp := &GetQueriersResponse{}
+	for _, q := range s.r.Queriers() {
+		resp.Queriers = append(resp.Queriers, &Querier{
+			Interface: q.Interface,
+			Side:      q.Side,
+			Addr:      q.Addr.String(),
+			Seen:      timestamppb.New(q.Seen),
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) SelectOutInterface(ctx context.Context, req *SelectOutInterfaceRequest) (*SelectOutInterfaceResponse, error) {
+	old, err := s.r.SelectOutInterface(req.GetInterface())
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	return &SelectOutInterfaceResponse{Interface: s.r.ActiveOutInterface(), Previous: old}, nil
+}
+
+// WatchEvents registers an observer for the stream
+// The observer callbacks must not block, so the events are dropped when the client is slow,
+// and the client is sent an EventsDropped event with the count
+func (s *Server) WatchEvents(req *WatchEventsRequest, stream Control_WatchEventsServer) error {
+
+	o := &streamObserver{events: make(chan *Event, eventBufferCst)}
+	if len(req.GetTypes()) > 0 {
+		o.types = make(map[string]bool)
+		for _, t := range req.GetTypes() {
+			o.types[t] = true
+		}
+	}
+
+	remove := s.r.AddObserver(o)
+	defer remove()
+
+	ctx := stream.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev := <-o.events:
+			if n := o.dropped.Swap(0); n > 0 {
+				if err := stream.Send(&Event{Time: timestamppb.Now(), Type: EventsDropped, Detail: strconv.FormatUint(n, 10)}); err != nil {
+					return err
+				}
+			}
+			if err := stream.Send(ev); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// streamObserver converts the observer events for a WatchEvents stream
+type streamObserver struct {
+	goIGMP.NopObserver
+
+	types   map[string]bool // nil for all
+	events  chan *Event
+	dropped atomic.Uint64
+}
+
+func (o *streamObserver) send(ev goIGMP.Event, typ string, src netip.Addr, items []goIGMP.MembershipItem, detail string) {
+	if o.types != nil && !o.types[typ] {
+		return
+	}
+	e := &Event{
+		Time:        timestamppb.New(ev.Time),
+		Type:        typ,
+		Interface:   ev.Interface,
+		Side:        ev.Side,
+		Memberships: memberships(items),
+		Detail:      detail,
+	}
+	if src.IsValid() {
+		e.Src = src.String()
+	}
+	select {
+	case o.events <- e:
+	default:
+		o.dropped.Add(1)
+	}
+}
+
+func (o *streamObserver) OnQuery(ev goIGMP.QueryEvent) {
+	var items []goIGMP.MembershipItem
+	if ev.Group.IsValid() {
+		items = []goIGMP.MembershipItem{{Group: ev.Group}}
+	}
+	o.send(ev.Event, "query", ev.Querier, items, "")
+}
+
+func (o *streamObserver) OnReport(ev goIGMP.ReportEvent) {
+	o.send(ev.Event, "report", ev.Src, ev.Items, "")
+}
+
+func (o *streamObserver) OnLeave(ev goIGMP.LeaveEvent) {
+	o.send(ev.Event, "leave", ev.Src, ev.Items, "")
+}
+
+func (o *streamObserver) OnProxy(ev goIGMP.ProxyEvent) {
+	o.send(ev.Event, "proxy", ev.Dst, nil, "")
+}
+
+func (o *streamObserver) OnDrop(ev goIGMP.DropEvent) {
+	detail := string(ev.Reason)
+	if ev.Err != nil {
+		detail += ": " + ev.Err.Error()
+	}
+	o.send(ev.Event, "drop", ev.Src, nil, detail)
+}
+
+func (o *streamObserver) OnQuerierChange(ev goIGMP.QuerierChangeEvent) {
+	detail := "old"
+	if ev.Old.IsValid() {
+		detail += " " + ev.Old.String()
+	}
+	o.send(ev.Event, "querierChange", ev.New, nil, detail)
+}
+
+func (o *streamObserver) OnOutInterfaceChange(ev goIGMP.OutInterfaceChangeEvent) {
+	o.send(ev.Event, "outInterfaceChange", netip.Addr{}, nil, ev.Reason+" from "+ev.OldInterface)
+}
+
+// membershipItems parses the request memberships.  The reporter checks they are multicast
+func membershipItems(ms []*Membership) ([]goIGMP.MembershipItem, error) {
+	items := make([]goIGMP.MembershipItem, 0, len(ms))
+	for _, m := range ms {
+		g, err := netip.ParseAddr(m.GetGroup())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "group %q: %v", m.GetGroup(), err)
+		}
+		mi := goIGMP.MembershipItem{Group: g}
+		for _, src := range m.GetSources() {
+			a, err := netip.ParseAddr(src)
+			if err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "source %q: %v", src, err)
+			}
+			mi.Sources = append(mi.Sources, a)
+		}
+		items = append(items, mi)
+	}
+	return items, nil
+}
+
+func memberships(items []goIGMP.MembershipItem) []*Membership {
+	ms := make([]*Membership, 0, len(items))
+	for _, mi := range items {
+		m := &Membership{Group: mi.Group.String()}
+		for _, src := range mi.Sources {
+			m.Sources = append(m.Sources, src.String())
+		}
+		ms = append(ms, m)
+	}
+	return ms
+}
+
+// statusOf maps the goIGMP control errors to the gRPC codes
+func statusOf(err error) error {
+	code := codes.InvalidArgument
+	switch {
+	case errors.Is(err, goIGMP.ErrJoinsOff), errors.Is(err, goIGMP.ErrLeavesOff), errors.Is(err, goIGMP.ErrNoAltOut):
+		code = codes.FailedPrecondition
+	case errors.Is(err, goIGMP.ErrChannelFull):
+		code = codes.ResourceExhausted
+	case errors.Is(err, goIGMP.ErrUnknownInterface):
+		code = codes.NotFound
+	}
+	return status.Error(code, err.Error())
+}
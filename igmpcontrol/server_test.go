@@ -0,0 +1,156 @@
+package igmpcontrol
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/randomizedcoder/goIGMP"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	testIntNameCst = "lo"
+	bufSizeCst     = 1 << 20
+)
+
+var (
+	testReporterOnce sync.Once
+	testReporterR    *goIGMP.IGMPReporter
+)
+
+// testClient runs the service on a ReplayOnly reporter, over an in memory connection
+func testClient(t *testing.T) (*goIGMP.IGMPReporter, ControlClient) {
+	t.Helper()
+
+	if _, err := net.InterfaceByName(testIntNameCst); err != nil {
+		t.Skipf("interface %s is required: %v", testIntNameCst, err)
+	}
+
+	// NewIGMPReporter registers the prometheus metrics, so there can only be one
+	testReporterOnce.Do(func() {
+		testReporterR = goIGMP.NewIGMPReporter(goIGMP.Config{
+			InIntName:                  testIntNameCst,
+			OutIntName:                 testIntNameCst,
+			UnicastDst:                 "127.0.0.1",
+			ProxyOutToIn:               true,
+			QueryNotify:                true,
+			MembershipReportsToNetwork: true,
+			ChannelSize:                1,
+			Testing: goIGMP.TestingOptions{
+				ReplayOnly: true,
+			},
+		})
+	})
+	r := testReporterR
+
+	l := bufconn.Listen(bufSizeCst)
+	s := grpc.NewServer()
+	RegisterControlServer(s, NewServer(r))
+	go func() {
+		_ = s.Serve(l)
+	}()
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return r, NewControlClient(conn)
+}
+
+func TestServer(t *testing.T) {
+
+	r, c := testClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := c.Join(ctx, &JoinRequest{Memberships: []*Membership{{Group: "232.1.1.1", Sources: []string{"10.0.0.1"}}}}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case items := <-r.MembershipReportToNetworkCh:
+		if len(items) != 1 || items[0].Group != netip.MustParseAddr("232.1.1.1") || len(items[0].Sources) != 1 {
+			t.Errorf("items:%v", items)
+		}
+	default:
+		t.Error("nothing on MembershipReportToNetworkCh")
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want codes.Code
+	}{
+		{"unparsable", call(c.Join(ctx, &JoinRequest{Memberships: []*Membership{{Group: "nope"}}})), codes.InvalidArgument},
+		{"unicast", call(c.Join(ctx, &JoinRequest{Memberships: []*Membership{{Group: "10.1.1.1"}}})), codes.InvalidArgument},
+		{"empty", call(c.Join(ctx, &JoinRequest{})), codes.InvalidArgument},
+		{"leave off", call(c.Leave(ctx, &LeaveRequest{Memberships: []*Membership{{Group: "232.1.1.1"}}})), codes.FailedPrecondition},
+		{"no alt", call(c.SelectOutInterface(ctx, &SelectOutInterfaceRequest{Interface: testIntNameCst})), codes.FailedPrecondition},
+	}
+	for _, tt := range tests {
+		if status.Code(tt.err) != tt.want {
+			t.Errorf("%s err:%v want:%s", tt.name, tt.err, tt.want)
+		}
+	}
+
+	ms, err := c.ListMemberships(ctx, &ListMembershipsRequest{})
+	if err != nil || ms.GetActiveOutInterface() != testIntNameCst {
+		t.Errorf("ListMemberships:%v err:%v", ms, err)
+	}
+}
+
+func call[T any](_ T, err error) error {
+	return err
+}
+
+func TestWatchEvents(t *testing.T) {
+
+	r, c := testClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stream, err := c.WatchEvents(ctx, &WatchEventsRequest{Types: []string{"query"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the observer is registered by the server goroutine, so replay until the events arrive
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			_, _ = r.ReplayPcap(ctx, filepath.Join("..", "pcaps", "igmpv2_leaves_2024_03_11.pcap"))
+			select {
+			case <-done:
+				return
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}()
+
+	ev, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.GetType() != "query" || ev.GetSrc() == "" || ev.GetInterface() != testIntNameCst {
+		t.Errorf("event:%v", ev)
+	}
+
+	qs, err := c.GetQueriers(ctx, &GetQueriersRequest{})
+	if err != nil || len(qs.GetQueriers()) == 0 {
+		t.Errorf("GetQueriers:%v err:%v", qs, err)
+	}
+}